@@ -0,0 +1,368 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"kellnhofer.com/tracker/api/mapper"
+	"kellnhofer.com/tracker/config"
+	lModel "kellnhofer.com/tracker/model"
+	"kellnhofer.com/tracker/repo"
+	"kellnhofer.com/tracker/storage"
+)
+
+const maxMultipartMemory = 32 << 20
+
+// maxMultipartOverhead is the size (in bytes) allowed for the multipart headers and other form
+// fields of an upload in addition to the file.
+const maxMultipartOverhead = 1 << 20
+
+type attachmentController struct {
+	conf   *config.Config
+	lRepo  *repo.LocationRepo
+	aRepo  *repo.AttachmentRepo
+	aStore *storage.AttachmentStore
+}
+
+func NewAttachmentController(conf *config.Config, lRepo *repo.LocationRepo,
+	aRepo *repo.AttachmentRepo, aStore *storage.AttachmentStore) *attachmentController {
+	return &attachmentController{conf, lRepo, aRepo, aStore}
+}
+
+// --- Public methods ---
+
+func (c attachmentController) GetAttachmentsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleGetAttachments(w, r)
+	}
+}
+
+func (c attachmentController) CreateAttachmentHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleCreateAttachment(w, r)
+	}
+}
+
+func (c attachmentController) GetAttachmentHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleGetAttachment(w, r)
+	}
+}
+
+func (c attachmentController) GetAttachmentThumbnailHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleGetAttachmentThumbnail(w, r)
+	}
+}
+
+func (c attachmentController) DeleteAttachmentHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleDeleteAttachment(w, r)
+	}
+}
+
+// --- Private methods ---
+
+func (c attachmentController) handleGetAttachments(w http.ResponseWriter, r *http.Request) {
+	locId, ok := c.checkLocation(w, r)
+	if !ok {
+		return
+	}
+
+	lAtts, err := c.aRepo.GetAttachments(locId)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading attachments.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	aAtts := mapper.ToApiAtts(lAtts)
+
+	json, err := json.Marshal(aAtts)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while serializing data.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+func (c attachmentController) handleCreateAttachment(w http.ResponseWriter, r *http.Request) {
+	locId, ok := c.checkLocation(w, r)
+	if !ok {
+		return
+	}
+
+	usage, err := c.aRepo.GetStorageUsage()
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while adding attachment.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	// Stop reading uploads which can't fit into the remaining quota (otherwise they would be
+	// written to disk first)
+	maxSize := c.conf.AttachmentQuota - usage
+	if maxSize < 0 {
+		maxSize = 0
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+maxMultipartOverhead)
+
+	err = r.ParseMultipartForm(maxMultipartMemory)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			log.Printf("Attachment quota exceeded!")
+			http.Error(w, "Request entity too large! (Attachment quota exceeded.)",
+				http.StatusRequestEntityTooLarge)
+			return
+		}
+		log.Printf("Invalid multipart form! ('%s')", err)
+		http.Error(w, "Bad request! (Invalid multipart form.)", http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		log.Printf("Missing file! ('%s')", err)
+		http.Error(w, "Bad request! (Missing file.)", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	if header.Size == 0 {
+		log.Printf("Empty file!")
+		http.Error(w, "Bad request! (Empty file.)", http.StatusBadRequest)
+		return
+	}
+
+	contentType := c.detectContentType(file, header.Header.Get("Content-Type"))
+
+	hash, size, isNew, err := c.aStore.SaveFile(file)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while storing attachment.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	// Check quota (files which are already stored don't use additional space)
+	if isNew && usage+size > c.conf.AttachmentQuota {
+		deleteUnusedAttachmentFile(c.aRepo, c.aStore, hash)
+		log.Printf("Attachment quota exceeded!")
+		http.Error(w, "Request entity too large! (Attachment quota exceeded.)",
+			http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	isImage, width, height, err := c.aStore.CreateThumbnails(hash)
+	if err != nil {
+		log.Print(err)
+	}
+	if !isImage {
+		width = 0
+		height = 0
+	}
+
+	lAtt := &lModel.Attachment{0, locId, hash, filepath.Base(header.Filename), contentType, size,
+		width, height, 0}
+
+	id, ct, err := c.aRepo.AddAttachment(lAtt)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while adding attachment.)",
+			http.StatusInternalServerError)
+		deleteUnusedAttachmentFile(c.aRepo, c.aStore, hash)
+		return
+	}
+
+	lAtt.Id = id
+	lAtt.CreateTime = ct
+
+	aAtt := mapper.ToApiAtt(lAtt)
+
+	json, err := json.Marshal(aAtt)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while serializing data.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+func (c attachmentController) handleGetAttachment(w http.ResponseWriter, r *http.Request) {
+	lAtt, ok := c.getAttachment(w, r)
+	if !ok {
+		return
+	}
+
+	file, err := c.aStore.OpenFile(lAtt.Hash)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading attachment.)",
+			http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", lAtt.ContentType)
+	// Browsers must not interpret the file as another type (e.g. a text file as HTML)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("inline",
+		map[string]string{"filename": lAtt.FileName}))
+	w.Header().Set("ETag", fmt.Sprintf("\"%s\"", lAtt.Hash))
+	http.ServeContent(w, r, lAtt.FileName, time.Unix(lAtt.CreateTime, 0), file)
+}
+
+func (c attachmentController) handleGetAttachmentThumbnail(w http.ResponseWriter,
+	r *http.Request) {
+	lAtt, ok := c.getAttachment(w, r)
+	if !ok {
+		return
+	}
+
+	size := r.FormValue("size")
+	if size == "" {
+		size = "medium"
+	}
+	if _, ok := storage.ThumbnailSizes[size]; !ok {
+		log.Printf("Invalid thumbnail size!")
+		http.Error(w, "Bad request! (Invalid thumbnail size.)", http.StatusBadRequest)
+		return
+	}
+
+	if lAtt.Width == 0 {
+		http.Error(w, "Not found! (Attachment has no thumbnail.)", http.StatusNotFound)
+		return
+	}
+
+	file, err := c.aStore.OpenThumbnail(lAtt.Hash, size)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading thumbnail.)",
+			http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("ETag", fmt.Sprintf("\"%s_%s\"", lAtt.Hash, size))
+	http.ServeContent(w, r, "", time.Unix(lAtt.CreateTime, 0), file)
+}
+
+func (c attachmentController) handleDeleteAttachment(w http.ResponseWriter, r *http.Request) {
+	lAtt, ok := c.getAttachment(w, r)
+	if !ok {
+		return
+	}
+
+	err := c.aRepo.DeleteAttachment(lAtt)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while deleting attachment.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	deleteUnusedAttachmentFile(c.aRepo, c.aStore, lAtt.Hash)
+}
+
+func (c attachmentController) checkLocation(w http.ResponseWriter, r *http.Request) (int64,
+	bool) {
+	locId, err := getId(r)
+	if err != nil {
+		log.Printf("Invalid location ID!")
+		http.Error(w, "Bad request! (Invalid location ID.)", http.StatusBadRequest)
+		return 0, false
+	}
+
+	exists, err := c.lRepo.ExistsLocation(locId)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading location.)",
+			http.StatusInternalServerError)
+		return 0, false
+	}
+	if !exists {
+		http.Error(w, "Not found! (Unknown location ID.)", http.StatusNotFound)
+		return 0, false
+	}
+
+	return locId, true
+}
+
+func (c attachmentController) getAttachment(w http.ResponseWriter,
+	r *http.Request) (*lModel.Attachment, bool) {
+	locId, err := getId(r)
+	if err != nil {
+		log.Printf("Invalid location ID!")
+		http.Error(w, "Bad request! (Invalid location ID.)", http.StatusBadRequest)
+		return nil, false
+	}
+
+	id, err := getAttachmentId(r)
+	if err != nil {
+		log.Printf("Invalid attachment ID!")
+		http.Error(w, "Bad request! (Invalid attachment ID.)", http.StatusBadRequest)
+		return nil, false
+	}
+
+	lAtt, err := c.aRepo.GetAttachment(id)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading attachment.)",
+			http.StatusInternalServerError)
+		return nil, false
+	}
+	if lAtt == nil || lAtt.LocationId != locId {
+		http.Error(w, "Not found! (Unknown attachment ID.)", http.StatusNotFound)
+		return nil, false
+	}
+
+	return lAtt, true
+}
+
+func (c attachmentController) detectContentType(file io.ReadSeeker, declared string) string {
+	buf := make([]byte, 512)
+	n, _ := io.ReadFull(file, buf)
+	file.Seek(0, io.SeekStart)
+
+	contentType := http.DetectContentType(buf[:n])
+	if contentType == "application/octet-stream" && declared != "" {
+		return declared
+	}
+	return contentType
+}
+
+func deleteUnusedAttachmentFile(aRepo *repo.AttachmentRepo, aStore *storage.AttachmentStore,
+	hash string) {
+	used, err := aRepo.ExistsAttachmentHash(hash)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	if used {
+		return
+	}
+
+	err = aStore.DeleteFile(hash)
+	if err != nil {
+		log.Print(err)
+	}
+}
@@ -3,8 +3,12 @@ package controller
 import (
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
+
+	"kellnhofer.com/tracker/constant"
 )
 
 func getId(r *http.Request) (int64, error) {
@@ -13,6 +17,12 @@ func getId(r *http.Request) (int64, error) {
 	return strconv.ParseInt(v, 10, 64)
 }
 
+func getAttachmentId(r *http.Request) (int64, error) {
+	vars := mux.Vars(r)
+	v := vars["attachment_id"]
+	return strconv.ParseInt(v, 10, 64)
+}
+
 func getChangeTime(r *http.Request) (int64, error) {
 	v := r.FormValue("change_time")
 	if v == "" {
@@ -28,3 +38,115 @@ func getDeletionTime(r *http.Request) (int64, error) {
 	}
 	return strconv.ParseInt(v, 10, 64)
 }
+
+func getIntParam(r *http.Request, name string) (int64, error) {
+	v := r.FormValue(name)
+	if v == "" {
+		return int64(0), nil
+	}
+	return strconv.ParseInt(v, 10, 64)
+}
+
+func getFloatParam(r *http.Request, name string) (float64, error) {
+	v := r.FormValue(name)
+	if v == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(v, 64)
+}
+
+// getFloatListParam parses a comma separated list of numbers (e.g. "1.5,2").
+func getFloatListParam(r *http.Request, name string) ([]float64, error) {
+	v := r.FormValue(name)
+	if v == "" {
+		return nil, nil
+	}
+	var fs []float64
+	for _, p := range strings.Split(v, ",") {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return nil, err
+		}
+		fs = append(fs, f)
+	}
+	return fs, nil
+}
+
+func getTimeParam(r *http.Request, name string) (time.Time, error) {
+	v := r.FormValue(name)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+// getDateParam parses a date with the given layout. If the parameter is missing, the current date
+// is returned.
+func getDateParam(r *http.Request, name string, layout string) (time.Time, error) {
+	v := r.FormValue(name)
+	if v == "" {
+		v = time.Now().Format(layout)
+	}
+	return time.Parse(layout, v)
+}
+
+func getTags(r *http.Request) []string {
+	r.ParseForm()
+	var tags []string
+	for _, v := range r.Form["tag"] {
+		if v != "" {
+			tags = append(tags, v)
+		}
+	}
+	return tags
+}
+
+func getIntListParam(r *http.Request, name string) ([]int64, error) {
+	r.ParseForm()
+	var ids []int64
+	for _, v := range r.Form[name] {
+		if v == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func getMeta(r *http.Request) map[string]string {
+	r.ParseForm()
+	meta := map[string]string{}
+	for k, v := range r.Form {
+		if strings.HasPrefix(k, "meta.") && len(k) > len("meta.") && len(v) > 0 {
+			meta[strings.TrimPrefix(k, "meta.")] = v[0]
+		}
+	}
+	return meta
+}
+
+func isValidLocationField(f string) bool {
+	switch f {
+	case constant.LocationFieldName, constant.LocationFieldDescription,
+		constant.LocationFieldEndTime, constant.LocationFieldTimeZone,
+		constant.LocationFieldAltitude, constant.LocationFieldAccuracy,
+		constant.LocationFieldPlace, constant.LocationFieldPersons, constant.LocationFieldTags,
+		constant.LocationFieldAttachments:
+		return true
+	default:
+		return false
+	}
+}
+
+func isValidMetaType(t string) bool {
+	switch t {
+	case constant.MetaTypeString, constant.MetaTypeNumber, constant.MetaTypeBoolean,
+		constant.MetaTypeDate:
+		return true
+	default:
+		return false
+	}
+}
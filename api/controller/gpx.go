@@ -0,0 +1,281 @@
+package controller
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log"
+	"math"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"kellnhofer.com/tracker/api/mapper"
+	aModel "kellnhofer.com/tracker/api/model"
+	"kellnhofer.com/tracker/constant"
+	lModel "kellnhofer.com/tracker/model"
+	"kellnhofer.com/tracker/util"
+)
+
+// --- Public methods ---
+
+func (c locationController) ExportGpxHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleExportGpx(w, r)
+	}
+}
+
+func (c locationController) ImportGpxHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleImportGpx(w, r)
+	}
+}
+
+// --- Private methods ---
+
+func (c locationController) handleExportGpx(w http.ResponseWriter, r *http.Request) {
+	filter, ok := c.parseLocationFilter(w, r)
+	if !ok {
+		return
+	}
+
+	// All matching locations are exported in chronological order
+	filter.Sort = constant.LocationSortTime
+
+	lLocs, err := c.lRepo.GetLocationsByFilter(filter)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading locations.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	aGpx := &aModel.Gpx{xml.Name{}, aModel.GpxNamespace, "1.1",
+		"Tracker " + constant.AppVersion,
+		&aModel.GpxMetadata{"Tracker", time.Now().UTC().Format(time.RFC3339)},
+		[]*aModel.GpxWaypoint{}, []*aModel.GpxTrack{}}
+	for _, lLoc := range lLocs {
+		aGpx.Waypoints = append(aGpx.Waypoints, mapper.ToGpxWaypoint(lLoc))
+	}
+
+	if r.FormValue("tracks") != "false" {
+		aGpx.Tracks, ok = c.getGpxTracks(w, filter)
+		if !ok {
+			return
+		}
+	}
+
+	out, err := xml.MarshalIndent(aGpx, "", "  ")
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while serializing data.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/gpx+xml")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment",
+		map[string]string{"filename": "tracker.gpx"}))
+	w.Write([]byte(xml.Header))
+	w.Write(out)
+}
+
+func (c locationController) handleImportGpx(w http.ResponseWriter, r *http.Request) {
+	var aGpx aModel.Gpx
+
+	decoder := xml.NewDecoder(http.MaxBytesReader(w, r.Body, maxImportSize))
+	err := decoder.Decode(&aGpx)
+	if err != nil {
+		log.Printf("Invalid GPX! ('%s')", err)
+		http.Error(w, "Bad request! (Invalid GPX)", http.StatusBadRequest)
+		return
+	}
+
+	aResult := &aModel.ImportResult{0, 0, 0, []*aModel.ImportElement{}}
+
+	for i, aWpt := range aGpx.Waypoints {
+		aElem := &aModel.ImportElement{constant.ImportElementWaypoint, i, aWpt.Name, "", 0, ""}
+		aLoc, msg := parseGpxWaypoint(aWpt)
+		if msg != "" {
+			setImportError(aElem, msg)
+		} else {
+			c.importLocation(aLoc, aElem)
+		}
+		addImportElement(aResult, aElem)
+	}
+
+	for i, aTrack := range aGpx.Tracks {
+		aElem := &aModel.ImportElement{constant.ImportElementTrack, i, aTrack.Name, "", 0, ""}
+		lPoints, msg := parseGpxTrackPoints(aTrack)
+		if msg != "" {
+			setImportError(aElem, msg)
+		} else {
+			lTrack := &lModel.Track{0, 0, strings.TrimSpace(aTrack.Name),
+				strings.TrimSpace(aTrack.Description), 0, time.Time{}, time.Time{}}
+			c.importTrack(lTrack, lPoints, aElem)
+		}
+		addImportElement(aResult, aElem)
+	}
+
+	writeImportResult(w, aResult)
+}
+
+// getGpxTracks returns the tracks with their points within the time range and the area of the
+// filter. Tracks without such points are omitted. Since tracks only have times and coordinates,
+// no tracks are returned if the filter contains other criteria (e.g. persons or tags).
+func (c locationController) getGpxTracks(w http.ResponseWriter,
+	filter *lModel.LocationFilter) ([]*aModel.GpxTrack, bool) {
+	if hasLocationOnlyFilter(filter) {
+		return []*aModel.GpxTrack{}, true
+	}
+
+	lTracks, err := c.tRepo.GetTracksByChangeTime(0)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading tracks.)",
+			http.StatusInternalServerError)
+		return nil, false
+	}
+
+	aTracks := []*aModel.GpxTrack{}
+	for _, lTrack := range lTracks {
+		lPoints, err := c.tRepo.GetTrackPoints(lTrack.Id, filter.From, filter.To)
+		if err != nil {
+			log.Print(err)
+			http.Error(w, "Internal server error! (Error while reading track points.)",
+				http.StatusInternalServerError)
+			return nil, false
+		}
+		lPoints = filterTrackPoints(lPoints, filter)
+		if len(lPoints) > 0 {
+			aTracks = append(aTracks, mapper.ToGpxTrack(lTrack, lPoints))
+		}
+	}
+
+	return aTracks, true
+}
+
+// hasLocationOnlyFilter checks whether a filter contains criteria which only apply to locations.
+func hasLocationOnlyFilter(filter *lModel.LocationFilter) bool {
+	return !filter.OverlapFrom.IsZero() || !filter.OverlapTo.IsZero() || len(filter.Tags) > 0 ||
+		filter.TripId != 0 || filter.PlaceId != 0 || filter.GroupId != 0 ||
+		len(filter.PersonIds) > 0 || filter.PersonName != "" || filter.Name != "" ||
+		filter.Description != "" || len(filter.Missing) > 0 || len(filter.Meta) > 0
+}
+
+// filterTrackPoints returns the track points within the bounding box and the circle of the
+// filter.
+func filterTrackPoints(lPoints []*lModel.TrackPoint,
+	filter *lModel.LocationFilter) []*lModel.TrackPoint {
+	if filter.BBox == nil && filter.Near == nil {
+		return lPoints
+	}
+
+	var filtered []*lModel.TrackPoint
+	for _, p := range lPoints {
+		if filter.BBox != nil && !isInBoundingBox(filter.BBox, p.Lat, p.Lng) {
+			continue
+		}
+		if filter.Near != nil && util.Distance(filter.Near.Lat, filter.Near.Lng, p.Lat,
+			p.Lng) > filter.Near.Radius {
+			continue
+		}
+		filtered = append(filtered, p)
+	}
+	return filtered
+}
+
+// isInBoundingBox checks whether a coordinate is within a bounding box. The bounding box may
+// cross the antimeridian.
+func isInBoundingBox(b *lModel.BoundingBox, lat float64, lng float64) bool {
+	if lat < b.MinLat || lat > b.MaxLat {
+		return false
+	}
+	if b.MinLng <= b.MaxLng {
+		return lng >= b.MinLng && lng <= b.MaxLng
+	}
+	return lng >= b.MinLng || lng <= b.MaxLng
+}
+
+// parseGpxWaypoint converts a GPX waypoint into a location. If the waypoint is invalid, an error
+// message is returned.
+func parseGpxWaypoint(aWpt *aModel.GpxWaypoint) (*aModel.Location, string) {
+	lat, lng, alt, msg := parseGpxCoordinate(aWpt)
+	if msg != "" {
+		return nil, msg
+	}
+
+	if strings.TrimSpace(aWpt.Time) == "" {
+		return nil, "Missing time."
+	}
+	t, err := parseImportTime(aWpt.Time)
+	if err != nil {
+		return nil, "Invalid time."
+	}
+
+	aPers := []*aModel.Person{}
+	if aWpt.Extensions != nil && aWpt.Extensions.Persons != nil {
+		for _, aPer := range aWpt.Extensions.Persons.Persons {
+			aPers = addImportPerson(aPers, aPer.FirstName, aPer.LastName)
+		}
+	}
+
+	return &aModel.Location{Name: strings.TrimSpace(aWpt.Name), Time: t, Lat: lat, Lng: lng,
+		Altitude: alt, Description: strings.TrimSpace(aWpt.Description), Persons: aPers}, ""
+}
+
+// parseGpxTrackPoints returns the points of all segments of a GPX track ordered by time. If a
+// point is invalid, an error message is returned.
+func parseGpxTrackPoints(aTrack *aModel.GpxTrack) ([]*lModel.TrackPoint, string) {
+	lPoints := []*lModel.TrackPoint{}
+	for _, aSeg := range aTrack.Segments {
+		for _, aPoint := range aSeg.Points {
+			lat, lng, alt, msg := parseGpxCoordinate(aPoint)
+			if msg == "" && strings.TrimSpace(aPoint.Time) == "" {
+				msg = "Missing time."
+			}
+			t, err := parseImportTime(aPoint.Time)
+			if msg == "" && err != nil {
+				msg = "Invalid time."
+			}
+			if msg != "" {
+				return nil, fmt.Sprintf("Invalid track point at index %d. (%s)", len(lPoints),
+					msg)
+			}
+			lPoints = append(lPoints, &lModel.TrackPoint{t, lat, lng, alt, nil, nil, nil})
+		}
+	}
+	if len(lPoints) == 0 {
+		return nil, "Track has no points."
+	}
+
+	sort.SliceStable(lPoints, func(i, j int) bool {
+		return lPoints[i].Time.Before(lPoints[j].Time)
+	})
+
+	return lPoints, ""
+}
+
+// parseGpxCoordinate parses the coordinate and the optional elevation of a waypoint or track
+// point. If a value is invalid, an error message is returned.
+func parseGpxCoordinate(aWpt *aModel.GpxWaypoint) (float64, float64, *float64, string) {
+	lat, err := strconv.ParseFloat(strings.TrimSpace(aWpt.Lat), 64)
+	if err != nil {
+		return 0, 0, nil, "Invalid coordinate."
+	}
+	lng, err := strconv.ParseFloat(strings.TrimSpace(aWpt.Lng), 64)
+	if err != nil || !util.IsValidCoordinate(lat, lng) {
+		return 0, 0, nil, "Invalid coordinate."
+	}
+
+	if strings.TrimSpace(aWpt.Elevation) == "" {
+		return lat, lng, nil, ""
+	}
+	alt, err := strconv.ParseFloat(strings.TrimSpace(aWpt.Elevation), 64)
+	if err != nil || math.IsNaN(alt) || math.IsInf(alt, 0) {
+		return 0, 0, nil, "Invalid elevation."
+	}
+	return lat, lng, &alt, ""
+}
@@ -0,0 +1,295 @@
+package controller
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"kellnhofer.com/tracker/api/mapper"
+	aModel "kellnhofer.com/tracker/api/model"
+	"kellnhofer.com/tracker/repo"
+)
+
+type groupController struct {
+	gRepo *repo.GroupRepo
+	pRepo *repo.PersonRepo
+}
+
+func NewGroupController(gRepo *repo.GroupRepo, pRepo *repo.PersonRepo) *groupController {
+	return &groupController{gRepo, pRepo}
+}
+
+// --- Public methods ---
+
+func (c groupController) GetGroupsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleGetGroups(w, r)
+	}
+}
+
+func (c groupController) CreateGroupHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleCreateGroup(w, r)
+	}
+}
+
+func (c groupController) GetGroupHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleGetGroup(w, r)
+	}
+}
+
+func (c groupController) ChangeGroupHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleChangeGroup(w, r)
+	}
+}
+
+func (c groupController) DeleteGroupHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleDeleteGroup(w, r)
+	}
+}
+
+func (c groupController) GetDeletedGroupIdsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleGetDeletedGroupIds(w, r)
+	}
+}
+
+// --- Private methods ---
+
+func (c groupController) handleGetGroups(w http.ResponseWriter, r *http.Request) {
+	ct, err := getChangeTime(r)
+	if err != nil {
+		log.Printf("Invalid change time!")
+		http.Error(w, "Bad request! (Invalid change time.)", http.StatusBadRequest)
+		return
+	}
+
+	lGroups, err := c.gRepo.GetGroupsByChangeTime(ct)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading groups.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	aGroups := mapper.ToApiGroups(lGroups)
+
+	json, err := json.Marshal(aGroups)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while serializing data.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+func (c groupController) handleCreateGroup(w http.ResponseWriter, r *http.Request) {
+	var aGroup aModel.Group
+
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&aGroup)
+	if err != nil {
+		log.Printf("Invalid JSON! ('%s')", err)
+		http.Error(w, "Bad request! (Invalid JSON)", http.StatusBadRequest)
+		return
+	}
+
+	if !c.validateGroup(w, &aGroup) {
+		return
+	}
+
+	lGroup := mapper.ToLogicGroup(&aGroup)
+
+	id, _, err := c.gRepo.AddGroup(lGroup)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while adding group.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	c.writeGroup(w, id)
+}
+
+func (c groupController) handleGetGroup(w http.ResponseWriter, r *http.Request) {
+	id, err := getId(r)
+	if err != nil {
+		log.Printf("Invalid group ID!")
+		http.Error(w, "Bad request! (Invalid group ID.)", http.StatusBadRequest)
+		return
+	}
+
+	exists, err := c.gRepo.ExistsGroup(id)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading group.)",
+			http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Not found! (Unknown group ID.)", http.StatusNotFound)
+		return
+	}
+
+	c.writeGroup(w, id)
+}
+
+func (c groupController) handleChangeGroup(w http.ResponseWriter, r *http.Request) {
+	id, err := getId(r)
+	if err != nil {
+		log.Printf("Invalid group ID!")
+		http.Error(w, "Bad request! (Invalid group ID.)", http.StatusBadRequest)
+		return
+	}
+
+	var aGroup aModel.Group
+
+	decoder := json.NewDecoder(r.Body)
+	err = decoder.Decode(&aGroup)
+	if err != nil {
+		log.Printf("Invalid JSON! ('%s')", err)
+		http.Error(w, "Bad request! (Invalid JSON)", http.StatusBadRequest)
+		return
+	}
+
+	exists, err := c.gRepo.ExistsGroup(id)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while changing group.)",
+			http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Not found! (Unknown group ID.)", http.StatusNotFound)
+		return
+	}
+
+	if !c.validateGroup(w, &aGroup) {
+		return
+	}
+
+	aGroup.Id = id
+
+	lGroup := mapper.ToLogicGroup(&aGroup)
+
+	_, err = c.gRepo.ChangeGroup(lGroup)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while changing group.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	c.writeGroup(w, id)
+}
+
+func (c groupController) handleDeleteGroup(w http.ResponseWriter, r *http.Request) {
+	id, err := getId(r)
+	if err != nil {
+		log.Printf("Invalid group ID!")
+		http.Error(w, "Bad request! (Invalid group ID.)", http.StatusBadRequest)
+		return
+	}
+
+	exists, err := c.gRepo.ExistsGroup(id)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while deleting group.)",
+			http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Not found! (Unknown group ID.)", http.StatusNotFound)
+		return
+	}
+
+	err = c.gRepo.DeleteGroup(id)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while deleting group.)",
+			http.StatusInternalServerError)
+		return
+	}
+}
+
+func (c groupController) handleGetDeletedGroupIds(w http.ResponseWriter, r *http.Request) {
+	dt, err := getDeletionTime(r)
+	if err != nil {
+		log.Printf("Invalid deletion time!")
+		http.Error(w, "Bad request! (Invalid deletion time.)", http.StatusBadRequest)
+		return
+	}
+
+	ids, err := c.gRepo.GetDeletedGroupIdsByDeletionTime(dt)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading groups.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	json, err := json.Marshal(ids)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while serializing data.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+func (c groupController) validateGroup(w http.ResponseWriter, aGroup *aModel.Group) bool {
+	if aGroup.Name == "" {
+		log.Printf("Missing group name!")
+		http.Error(w, "Bad request! (Missing group name.)", http.StatusBadRequest)
+		return false
+	}
+
+	for _, perId := range aGroup.PersonIds {
+		exists, err := c.pRepo.ExistsPerson(perId)
+		if err != nil {
+			log.Print(err)
+			http.Error(w, "Internal server error! (Error while reading person.)",
+				http.StatusInternalServerError)
+			return false
+		}
+		if !exists {
+			log.Printf("Unknown group person ID!")
+			http.Error(w, "Bad request! (Unknown person ID.)", http.StatusBadRequest)
+			return false
+		}
+	}
+
+	return true
+}
+
+func (c groupController) writeGroup(w http.ResponseWriter, id int64) {
+	lGroup, err := c.gRepo.GetGroup(id)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading group.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	aGroup := mapper.ToApiGroup(lGroup)
+
+	json, err := json.Marshal(aGroup)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while serializing data.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
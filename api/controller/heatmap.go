@@ -0,0 +1,177 @@
+package controller
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image/png"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	lModel "kellnhofer.com/tracker/model"
+	"kellnhofer.com/tracker/repo"
+	"kellnhofer.com/tracker/storage"
+	"kellnhofer.com/tracker/util"
+)
+
+const (
+	maxHeatmapZoom  = 20
+	heatmapSigma    = 6.0
+	heatmapMaxBytes = 32 * 1024 * 1024
+)
+
+type heatmapController struct {
+	hRepo *repo.HeatmapRepo
+	cache *storage.TileCache
+}
+
+func NewHeatmapController(hRepo *repo.HeatmapRepo) *heatmapController {
+	return &heatmapController{hRepo, storage.NewTileCache(heatmapMaxBytes)}
+}
+
+// --- Public methods ---
+
+func (c heatmapController) GetHeatmapTileHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleGetHeatmapTile(w, r)
+	}
+}
+
+// --- Private methods ---
+
+func (c heatmapController) handleGetHeatmapTile(w http.ResponseWriter, r *http.Request) {
+	z, x, y, ok := getTile(r)
+	if !ok || z > maxHeatmapZoom {
+		log.Printf("Invalid tile!")
+		http.Error(w, "Bad request! (Invalid tile.)", http.StatusBadRequest)
+		return
+	}
+
+	from, err := getTimeParam(r, "from")
+	if err != nil {
+		log.Printf("Invalid start time!")
+		http.Error(w, "Bad request! (Invalid start time.)", http.StatusBadRequest)
+		return
+	}
+
+	to, err := getTimeParam(r, "to")
+	if err != nil {
+		log.Printf("Invalid end time!")
+		http.Error(w, "Bad request! (Invalid end time.)", http.StatusBadRequest)
+		return
+	}
+
+	perIds, err := getIntListParam(r, "person")
+	if err != nil {
+		log.Printf("Invalid person ID!")
+		http.Error(w, "Bad request! (Invalid person ID.)", http.StatusBadRequest)
+		return
+	}
+
+	withTracks := r.FormValue("tracks") != "false"
+
+	rev, err := c.hRepo.GetRevision()
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading heatmap.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	key := fmt.Sprintf("%d/%d/%d?%s", z, x, y, r.URL.Query().Encode())
+	etag := heatmapETag(rev, key)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	data := c.cache.Get(rev, key)
+	if data == nil {
+		margin := 3 * heatmapSigma
+		minLat, minLng, maxLat, maxLng := util.TileBoundingBox(z, x, y, margin)
+		filter := &lModel.LocationFilter{From: from, To: to, PersonIds: perIds,
+			BBox: &lModel.BoundingBox{minLng, minLat, maxLng, maxLat}}
+
+		// Points are aggregated into cells of about one pixel (much smaller than the kernel)
+		cellSize := 360 / util.WorldSize(z)
+		points, err := c.hRepo.GetHeatmapPoints(filter, withTracks, cellSize)
+		if err != nil {
+			log.Print(err)
+			http.Error(w, "Internal server error! (Error while reading heatmap.)",
+				http.StatusInternalServerError)
+			return
+		}
+
+		data, err = renderHeatmapTile(points, z, x, y)
+		if err != nil {
+			log.Print(err)
+			http.Error(w, "Internal server error! (Error while rendering heatmap.)",
+				http.StatusInternalServerError)
+			return
+		}
+		c.cache.Put(rev, key, data)
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("ETag", etag)
+	w.Write(data)
+}
+
+func getTile(r *http.Request) (int, int, int, bool) {
+	vars := mux.Vars(r)
+	z, errZ := strconv.Atoi(vars["z"])
+	x, errX := strconv.Atoi(vars["x"])
+	y, errY := strconv.Atoi(vars["y"])
+	if errZ != nil || errX != nil || errY != nil || z < 0 || z > 30 {
+		return 0, 0, 0, false
+	}
+	n := 1 << uint(z)
+	if x < 0 || x >= n || y < 0 || y >= n {
+		return 0, 0, 0, false
+	}
+	return z, x, y, true
+}
+
+// renderHeatmapTile renders the points into a PNG tile. Points which are more than half a world
+// away from the tile center (i.e. on the other side of the antimeridian) are shifted by the world
+// size.
+func renderHeatmapTile(points []*lModel.HeatmapPoint, z int, x int, y int) ([]byte, error) {
+	size := util.WorldSize(z)
+	left := float64(x * util.TileSize)
+	top := float64(y * util.TileSize)
+
+	xs := make([]float64, 0, len(points))
+	ys := make([]float64, 0, len(points))
+	weights := make([]float64, 0, len(points))
+	for _, p := range points {
+		px, py := util.ToWorldPixel(p.Lat, p.Lng, z)
+		px -= left
+		if dx := px - util.TileSize/2; dx > size/2 {
+			px -= size
+		} else if dx < -size/2 {
+			px += size
+		}
+		xs = append(xs, px)
+		ys = append(ys, py-top)
+		weights = append(weights, float64(p.Weight))
+	}
+
+	img := util.RenderHeatmap(xs, ys, weights, util.TileSize, heatmapSigma)
+
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func heatmapETag(rev string, key string) string {
+	sum := sha256.Sum256([]byte(rev + "|" + key))
+	return "\"" + hex.EncodeToString(sum[:8]) + "\""
+}
@@ -0,0 +1,156 @@
+package controller
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"kellnhofer.com/tracker/api/mapper"
+	aModel "kellnhofer.com/tracker/api/model"
+	"kellnhofer.com/tracker/constant"
+	"kellnhofer.com/tracker/data"
+	lModel "kellnhofer.com/tracker/model"
+)
+
+// maxImportSize is the maximum size (in bytes) of an imported file.
+const maxImportSize = 32 << 20
+
+// importTimeFormats are the accepted time formats of imported files. Times without offset are
+// interpreted as UTC.
+var importTimeFormats = []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05", "2006-01-02"}
+
+// importLocation adds an imported location. Like on creation, the time zone, the place and the
+// city are derived from the coordinate. If a location with the same time and coordinate already
+// exists, the element is reported as duplicate instead. If the location can't be stored, the
+// element is reported as error.
+func (c locationController) importLocation(aLoc *aModel.Location, aElem *aModel.ImportElement) {
+	dupId, err := c.lRepo.GetLocationIdByTimeAndCoordinate(aLoc.Time, aLoc.Lat, aLoc.Lng)
+	if err != nil {
+		log.Print(err)
+		setImportError(aElem, "Error while reading locations.")
+		return
+	}
+	if dupId != 0 {
+		aElem.Status = constant.ImportStatusDuplicate
+		aElem.Id = dupId
+		return
+	}
+
+	// The time zone has already been checked by findTimeZone
+	aLoc.TimeZone = c.findTimeZone(aLoc.Lat, aLoc.Lng)
+	if aLoc.TimeZone != "" {
+		loc, _ := data.LoadTimeZone(aLoc.TimeZone)
+		setLocationTimeZone(aLoc, loc)
+	}
+
+	err = c.assignPlace(aLoc)
+	if err != nil {
+		log.Print(err)
+		setImportError(aElem, "Error while reading places.")
+		return
+	}
+
+	c.geocodeLocation(aLoc)
+
+	id, _, err := c.lRepo.AddLocation(mapper.ToLogicLoc(aLoc))
+	if err != nil {
+		log.Print(err)
+		setImportError(aElem, "Error while adding location.")
+		return
+	}
+
+	aElem.Status = constant.ImportStatusImported
+	aElem.Id = id
+}
+
+// importTrack adds an imported track with its points. The points must be ordered by time. If a
+// track with the same time range already exists, the element is reported as duplicate instead. If
+// the track can't be stored, nothing is stored and the element is reported as error.
+func (c locationController) importTrack(lTrack *lModel.Track, lPoints []*lModel.TrackPoint,
+	aElem *aModel.ImportElement) {
+	dupId, err := c.tRepo.GetTrackIdByTimeRange(lPoints[0].Time, lPoints[len(lPoints)-1].Time)
+	if err != nil {
+		log.Print(err)
+		setImportError(aElem, "Error while reading tracks.")
+		return
+	}
+	if dupId != 0 {
+		aElem.Status = constant.ImportStatusDuplicate
+		aElem.Id = dupId
+		return
+	}
+
+	id, _, err := c.tRepo.AddTrackWithPoints(lTrack, lPoints)
+	if err != nil {
+		log.Print(err)
+		setImportError(aElem, "Error while adding track.")
+		return
+	}
+
+	aElem.Status = constant.ImportStatusImported
+	aElem.Id = id
+}
+
+func writeImportResult(w http.ResponseWriter, aResult *aModel.ImportResult) {
+	json, err := json.Marshal(aResult)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while serializing data.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+// setImportError reports an element of an import as error.
+func setImportError(aElem *aModel.ImportElement, msg string) {
+	aElem.Status = constant.ImportStatusError
+	aElem.Error = msg
+}
+
+// addImportElement adds the element to the import result and updates the counts.
+func addImportElement(aResult *aModel.ImportResult, aElem *aModel.ImportElement) {
+	switch aElem.Status {
+	case constant.ImportStatusImported:
+		aResult.Imported++
+	case constant.ImportStatusDuplicate:
+		aResult.Duplicates++
+	case constant.ImportStatusError:
+		aResult.Errors++
+	}
+	aResult.Elements = append(aResult.Elements, aElem)
+}
+
+func parseImportTime(v string) (time.Time, error) {
+	var t time.Time
+	var err error
+	for _, layout := range importTimeFormats {
+		t, err = time.ParseInLocation(layout, strings.TrimSpace(v), time.UTC)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return t, err
+}
+
+// addImportPerson adds a person to the persons of an imported location unless the person is
+// already contained or has no name.
+func addImportPerson(aPers []*aModel.Person, firstName string, lastName string) []*aModel.Person {
+	firstName = strings.TrimSpace(firstName)
+	lastName = strings.TrimSpace(lastName)
+	if firstName == "" && lastName == "" {
+		return aPers
+	}
+	for _, aPer := range aPers {
+		if strings.EqualFold(aPer.FirstName, firstName) &&
+			strings.EqualFold(aPer.LastName, lastName) {
+			return aPers
+		}
+	}
+	return append(aPers, &aModel.Person{FirstName: firstName, LastName: lastName})
+}
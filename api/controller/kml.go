@@ -0,0 +1,525 @@
+package controller
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"mime"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"kellnhofer.com/tracker/api/mapper"
+	aModel "kellnhofer.com/tracker/api/model"
+	"kellnhofer.com/tracker/constant"
+	lModel "kellnhofer.com/tracker/model"
+	"kellnhofer.com/tracker/util"
+)
+
+// kmlIconHref is the icon of exported placemarks. It is white, so it can be colored per folder.
+const kmlIconHref = "https://maps.google.com/mapfiles/kml/paddle/wht-blank.png"
+
+// kmlPersonSeparators separate the person names of imported placemarks.
+const kmlPersonSeparators = ",;\n"
+
+// kmlIconColors are the icon colors of the folders. (KML colors are written as aabbggrr.)
+var kmlIconColors = []string{"ff3643f4", "fff39621", "ff50af4c", "ff0098ff", "ffb0279c",
+	"ffd4bc00", "ff631ee9", "ff485579"}
+
+// --- Public methods ---
+
+func (c locationController) ExportKmlHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleExportKml(w, r, false)
+	}
+}
+
+func (c locationController) ExportKmzHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleExportKml(w, r, true)
+	}
+}
+
+func (c locationController) ImportKmlHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleImportKml(w, r)
+	}
+}
+
+// --- Private methods ---
+
+func (c locationController) handleExportKml(w http.ResponseWriter, r *http.Request, kmz bool) {
+	folders := r.FormValue("folders")
+	switch folders {
+	case "":
+		folders = constant.ExportFolderYear
+	case constant.ExportFolderYear, constant.ExportFolderTrip:
+	default:
+		log.Printf("Invalid folders!")
+		http.Error(w, "Bad request! (Invalid folders.)", http.StatusBadRequest)
+		return
+	}
+
+	filter, ok := c.parseLocationFilter(w, r)
+	if !ok {
+		return
+	}
+
+	// All matching locations are exported in chronological order
+	filter.Sort = constant.LocationSortTime
+
+	lLocs, err := c.lRepo.GetLocationsByFilter(filter)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading locations.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	var names []string
+	var groups [][]*lModel.Location
+	if folders == constant.ExportFolderTrip {
+		names, groups, ok = c.groupLocationsByTrip(w, lLocs)
+		if !ok {
+			return
+		}
+	} else {
+		names, groups = groupLocationsByYear(lLocs)
+	}
+
+	aDoc := &aModel.KmlDocument{"Tracker", []*aModel.KmlStyle{}, []*aModel.KmlFolder{}}
+	for i, name := range names {
+		styleId := fmt.Sprintf("folder-%d", i+1)
+		aDoc.Styles = append(aDoc.Styles, &aModel.KmlStyle{styleId,
+			kmlIconColors[i%len(kmlIconColors)], kmlIconHref})
+
+		aFolder := &aModel.KmlFolder{name, []*aModel.KmlPlacemark{}}
+		for _, lLoc := range groups[i] {
+			aFolder.Placemarks = append(aFolder.Placemarks,
+				mapper.ToKmlPlacemark(lLoc, "#"+styleId))
+		}
+		aDoc.Folders = append(aDoc.Folders, aFolder)
+	}
+
+	out, err := xml.MarshalIndent(&aModel.Kml{xml.Name{}, aModel.KmlNamespace, aDoc}, "", "  ")
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while serializing data.)",
+			http.StatusInternalServerError)
+		return
+	}
+	out = append([]byte(xml.Header), out...)
+
+	if !kmz {
+		w.Header().Set("Content-Type", "application/vnd.google-earth.kml+xml")
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment",
+			map[string]string{"filename": "tracker.kml"}))
+		w.Write(out)
+		return
+	}
+
+	// A KMZ file is a ZIP archive with the document as "doc.kml"
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	fw, err := zw.Create("doc.kml")
+	if err == nil {
+		_, err = fw.Write(out)
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while serializing data.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.google-earth.kmz")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment",
+		map[string]string{"filename": "tracker.kmz"}))
+	w.Write(buf.Bytes())
+}
+
+func (c locationController) handleImportKml(w http.ResponseWriter, r *http.Request) {
+	// The body must be read before the form is parsed
+	content, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImportSize))
+	if err != nil {
+		log.Printf("Could not read KML! ('%s')", err)
+		http.Error(w, fmt.Sprintf("Bad request! (File must not be larger than %d MB.)",
+			maxImportSize>>20), http.StatusBadRequest)
+		return
+	}
+
+	defaultTime, err := getTimeParam(r, "default_time")
+	if err != nil {
+		log.Printf("Invalid default time!")
+		http.Error(w, "Bad request! (Invalid default time.)", http.StatusBadRequest)
+		return
+	}
+
+	aPms, err := parseKmlPlacemarks(content)
+	if err != nil {
+		log.Printf("Invalid KML! ('%s')", err)
+		http.Error(w, "Bad request! (Invalid KML or KMZ)", http.StatusBadRequest)
+		return
+	}
+
+	aResult := &aModel.ImportResult{0, 0, 0, []*aModel.ImportElement{}}
+
+	for i, aPm := range aPms {
+		aElem := &aModel.ImportElement{constant.ImportElementPlacemark, i,
+			strings.TrimSpace(aPm.Name), "", 0, ""}
+		aLoc, perNames, msg := parseKmlPlacemark(aPm, defaultTime)
+		if msg != "" {
+			setImportError(aElem, msg)
+			addImportElement(aResult, aElem)
+			continue
+		}
+
+		aPers, err := c.getKmlPersons(perNames)
+		if err != nil {
+			log.Print(err)
+			setImportError(aElem, "Error while reading persons.")
+			addImportElement(aResult, aElem)
+			continue
+		}
+		aLoc.Persons = aPers
+
+		c.importLocation(aLoc, aElem)
+		addImportElement(aResult, aElem)
+	}
+
+	writeImportResult(w, aResult)
+}
+
+// groupLocationsByTrip groups the locations by their trips. Locations of several trips are
+// contained in each of them. Locations without trip are grouped at the end.
+func (c locationController) groupLocationsByTrip(w http.ResponseWriter,
+	lLocs []*lModel.Location) ([]string, [][]*lModel.Location, bool) {
+	lTrips, err := c.trRepo.GetTripsByChangeTime(0)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading trips.)",
+			http.StatusInternalServerError)
+		return nil, nil, false
+	}
+
+	byId := map[int64]*lModel.Location{}
+	for _, lLoc := range lLocs {
+		byId[lLoc.Id] = lLoc
+	}
+
+	var names []string
+	var groups [][]*lModel.Location
+	inTrip := map[int64]bool{}
+	for _, lTrip := range lTrips {
+		var group []*lModel.Location
+		for _, locId := range lTrip.LocationIds {
+			if lLoc, ok := byId[locId]; ok {
+				group = append(group, lLoc)
+				inTrip[locId] = true
+			}
+		}
+		if len(group) > 0 {
+			names = append(names, lTrip.Name)
+			groups = append(groups, group)
+		}
+	}
+
+	var others []*lModel.Location
+	for _, lLoc := range lLocs {
+		if !inTrip[lLoc.Id] {
+			others = append(others, lLoc)
+		}
+	}
+	if len(others) > 0 {
+		names = append(names, "Other locations")
+		groups = append(groups, others)
+	}
+
+	return names, groups, true
+}
+
+// getKmlPersons returns the persons of an imported placemark. Names of existing persons are
+// matched by their full name, other names are split into first and last name at the last space.
+func (c locationController) getKmlPersons(names []string) ([]*aModel.Person, error) {
+	aPers := []*aModel.Person{}
+	for _, name := range names {
+		firstName, lastName, err := c.lRepo.GetPersonNameByFullName(name)
+		if err != nil {
+			return nil, err
+		}
+		if firstName == "" && lastName == "" {
+			firstName = name
+			if i := strings.LastIndex(name, " "); i > 0 {
+				firstName, lastName = name[:i], name[i+1:]
+			}
+		}
+		aPers = addImportPerson(aPers, firstName, lastName)
+	}
+	return aPers, nil
+}
+
+// groupLocationsByYear groups the locations by the year of their local time.
+func groupLocationsByYear(lLocs []*lModel.Location) ([]string, [][]*lModel.Location) {
+	byYear := map[int][]*lModel.Location{}
+	for _, lLoc := range lLocs {
+		byYear[lLoc.Time.Year()] = append(byYear[lLoc.Time.Year()], lLoc)
+	}
+
+	years := []int{}
+	for year := range byYear {
+		years = append(years, year)
+	}
+	sort.Ints(years)
+
+	var names []string
+	var groups [][]*lModel.Location
+	for _, year := range years {
+		names = append(names, strconv.Itoa(year))
+		groups = append(groups, byYear[year])
+	}
+	return names, groups
+}
+
+// parseKmlPlacemarks returns all placemarks of a KML document or KMZ archive. Placemarks may be
+// nested in documents and folders.
+func parseKmlPlacemarks(content []byte) ([]*aModel.KmlPlacemark, error) {
+	// KMZ files are ZIP archives
+	if bytes.HasPrefix(content, []byte("PK\x03\x04")) {
+		var err error
+		content, err = readKmzDocument(content)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	aPms := []*aModel.KmlPlacemark{}
+	root := true
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if root && start.Name.Local != "kml" {
+			return nil, errors.New("Root element is not 'kml'.")
+		}
+		root = false
+		if start.Name.Local != "Placemark" {
+			continue
+		}
+
+		var aPm aModel.KmlPlacemark
+		err = decoder.DecodeElement(&aPm, &start)
+		if err != nil {
+			return nil, err
+		}
+		aPms = append(aPms, &aPm)
+	}
+	if root {
+		return nil, errors.New("Missing root element.")
+	}
+
+	return aPms, nil
+}
+
+// readKmzDocument returns the main document of a KMZ archive. This is "doc.kml" or else the first
+// KML file of the archive.
+func readKmzDocument(content []byte) ([]byte, error) {
+	zr, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, err
+	}
+
+	var doc *zip.File
+	for _, f := range zr.File {
+		if f.Name == "doc.kml" {
+			doc = f
+			break
+		}
+		if doc == nil && strings.EqualFold(path.Ext(f.Name), ".kml") {
+			doc = f
+		}
+	}
+	if doc == nil {
+		return nil, errors.New("Archive contains no KML file.")
+	}
+
+	fr, err := doc.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer fr.Close()
+
+	docContent, err := io.ReadAll(io.LimitReader(fr, maxImportSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(docContent) > maxImportSize {
+		return nil, errors.New("KML file is too large.")
+	}
+	return docContent, nil
+}
+
+// parseKmlPlacemark converts a KML placemark into a location. The persons of the extended data are
+// returned as names. If the placemark is invalid, an error message is returned.
+func parseKmlPlacemark(aPm *aModel.KmlPlacemark, defaultTime time.Time) (*aModel.Location,
+	[]string, string) {
+	if aPm.Point == nil {
+		return nil, nil, "Placemark is not a point."
+	}
+	lat, lng, alt, msg := parseKmlCoordinates(aPm.Point.Coordinates)
+	if msg != "" {
+		return nil, nil, msg
+	}
+
+	t, et, msg := parseKmlTime(aPm, defaultTime)
+	if msg != "" {
+		return nil, nil, msg
+	}
+
+	// Persons are taken from the extended data, all other values are added to the description
+	desc := strings.TrimSpace(aPm.Description)
+	var perNames []string
+	var lines []string
+	if aPm.ExtendedData != nil {
+		for _, aData := range aPm.ExtendedData.Data {
+			label := aData.DisplayName
+			if label == "" {
+				label = aData.Name
+			}
+			perNames, lines = addKmlData(perNames, lines, aData.Name, label, aData.Value)
+		}
+		for _, aSchemaData := range aPm.ExtendedData.SchemaData {
+			for _, aData := range aSchemaData.SimpleData {
+				perNames, lines = addKmlData(perNames, lines, aData.Name, aData.Name, aData.Value)
+			}
+		}
+	}
+	if len(lines) > 0 {
+		if desc != "" {
+			desc += "\n\n"
+		}
+		desc += strings.Join(lines, "\n")
+	}
+
+	aLoc := &aModel.Location{Name: strings.TrimSpace(aPm.Name), Time: t, Lat: lat, Lng: lng,
+		Altitude: alt, Description: desc}
+	if !et.IsZero() {
+		aLoc.EndTime = &et
+	}
+	return aLoc, perNames, ""
+}
+
+// parseKmlCoordinates parses KML coordinates ("lng,lat[,alt]"). If there are several
+// coordinates, the first one is used. If a value is invalid, an error message is returned.
+func parseKmlCoordinates(v string) (float64, float64, *float64, string) {
+	fields := strings.Fields(v)
+	if len(fields) == 0 {
+		return 0, 0, nil, "Missing coordinate."
+	}
+	parts := strings.Split(fields[0], ",")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, 0, nil, "Invalid coordinate."
+	}
+
+	lng, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return 0, 0, nil, "Invalid coordinate."
+	}
+	lat, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil || !util.IsValidCoordinate(lat, lng) {
+		return 0, 0, nil, "Invalid coordinate."
+	}
+
+	if len(parts) < 3 {
+		return lat, lng, nil, ""
+	}
+	alt, err := strconv.ParseFloat(parts[2], 64)
+	if err != nil || math.IsNaN(alt) || math.IsInf(alt, 0) {
+		return 0, 0, nil, "Invalid altitude."
+	}
+	return lat, lng, &alt, ""
+}
+
+// parseKmlTime returns the time and the optional end time of a placemark. Placemarks without
+// TimeStamp or TimeSpan get the default time (if set). If a time is invalid, an error message is
+// returned.
+func parseKmlTime(aPm *aModel.KmlPlacemark, defaultTime time.Time) (time.Time, time.Time,
+	string) {
+	var begin string
+	var end string
+	switch {
+	case aPm.TimeStamp != nil:
+		begin = strings.TrimSpace(aPm.TimeStamp.When)
+	case aPm.TimeSpan != nil:
+		begin = strings.TrimSpace(aPm.TimeSpan.Begin)
+		end = strings.TrimSpace(aPm.TimeSpan.End)
+	}
+
+	if begin == "" {
+		if defaultTime.IsZero() {
+			return time.Time{}, time.Time{}, "Missing time."
+		}
+		return defaultTime, time.Time{}, ""
+	}
+	t, err := parseImportTime(begin)
+	if err != nil {
+		return time.Time{}, time.Time{}, "Invalid time."
+	}
+
+	if end == "" {
+		return t, time.Time{}, ""
+	}
+	et, err := parseImportTime(end)
+	if err != nil {
+		return time.Time{}, time.Time{}, "Invalid end time."
+	}
+	if et.Before(t) {
+		return time.Time{}, time.Time{}, "End time is before time."
+	}
+	return t, et, ""
+}
+
+// addKmlData adds a value of the extended data either to the person names or to the description
+// lines.
+func addKmlData(perNames []string, lines []string, name string, label string,
+	value string) ([]string, []string) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return perNames, lines
+	}
+
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "persons", "person":
+		for _, perName := range strings.FieldsFunc(value, func(r rune) bool {
+			return strings.ContainsRune(kmlPersonSeparators, r)
+		}) {
+			if perName = strings.Join(strings.Fields(perName), " "); perName != "" {
+				perNames = append(perNames, perName)
+			}
+		}
+	case "description":
+		lines = append(lines, value)
+	default:
+		lines = append(lines, strings.TrimSpace(label)+": "+value)
+	}
+	return perNames, lines
+}
@@ -1,22 +1,56 @@
 package controller
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
 	"kellnhofer.com/tracker/api/mapper"
 	aModel "kellnhofer.com/tracker/api/model"
+	"kellnhofer.com/tracker/constant"
+	"kellnhofer.com/tracker/data"
 	lModel "kellnhofer.com/tracker/model"
 	"kellnhofer.com/tracker/repo"
+	"kellnhofer.com/tracker/storage"
+	"kellnhofer.com/tracker/util"
 )
 
+const (
+	defaultLocationPageSize = 100
+	maxLocationPageSize     = 1000
+)
+
+// zoomGeohashPrecisions contains the geohash precision of clusters per map zoom level. (A cell is
+// about an eighth of a map tile.) From zoom level len(zoomGeohashPrecisions) on, locations are
+// not clustered anymore.
+var zoomGeohashPrecisions = []int{1, 2, 2, 3, 3, 3, 4, 4, 5, 5, 5, 6, 6, 7, 7, 7, 8}
+
+const maxMapZoom = 22
+
 type locationController struct {
-	lRepo *repo.LocationRepo
+	lRepo  *repo.LocationRepo
+	aRepo  *repo.AttachmentRepo
+	mRepo  *repo.MetaRepo
+	pRepo  *repo.PlaceRepo
+	tRepo  *repo.TrackRepo
+	trRepo *repo.TripRepo
+	aStore *storage.AttachmentStore
+	cStore *storage.CityStore
+	bStore *storage.BoundaryStore
 }
 
-func NewLocationController(lRepo *repo.LocationRepo) *locationController {
-	return &locationController{lRepo}
+func NewLocationController(lRepo *repo.LocationRepo, aRepo *repo.AttachmentRepo,
+	mRepo *repo.MetaRepo, pRepo *repo.PlaceRepo, tRepo *repo.TrackRepo,
+	trRepo *repo.TripRepo, aStore *storage.AttachmentStore, cStore *storage.CityStore,
+	bStore *storage.BoundaryStore) *locationController {
+	return &locationController{lRepo, aRepo, mRepo, pRepo, tRepo, trRepo, aStore, cStore,
+		bStore}
 }
 
 // --- Public methods ---
@@ -27,6 +61,12 @@ func (c locationController) GetLocationsHandler() http.HandlerFunc {
 	}
 }
 
+func (c locationController) GetLocationClustersHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleGetLocationClusters(w, r)
+	}
+}
+
 func (c locationController) CreateLocationHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		c.handleCreateLocation(w, r)
@@ -51,6 +91,12 @@ func (c locationController) DeleteLocationHandler() http.HandlerFunc {
 	}
 }
 
+func (c locationController) GeocodeLocationsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleGeocodeLocations(w, r)
+	}
+}
+
 func (c locationController) GetDeletedLocationIdsHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		c.handleGetDeletedLocationIds(w, r)
@@ -60,19 +106,16 @@ func (c locationController) GetDeletedLocationIdsHandler() http.HandlerFunc {
 // --- Private methods ---
 
 func (c locationController) handleGetLocations(w http.ResponseWriter, r *http.Request) {
-	ct, err := getChangeTime(r)
-	if err != nil {
-		log.Printf("Invalid change time!")
-		http.Error(w, "Bad request! (Invalid change time.)", http.StatusBadRequest)
+	filter, ok := c.parseLocationFilter(w, r)
+	if !ok {
 		return
 	}
 
-	var lLocs []*lModel.Location
-	if ct > 0 {
-		lLocs, err = c.lRepo.GetLocationsByChangeTime(ct)
-	} else {
-		lLocs, err = c.lRepo.GetLocations()
+	if !c.parsePaging(w, r, filter) {
+		return
 	}
+
+	lLocs, next, err := c.lRepo.GetLocationPageByFilter(filter)
 	if err != nil {
 		log.Print(err)
 		http.Error(w, "Internal server error! (Error while reading locations.)",
@@ -80,6 +123,10 @@ func (c locationController) handleGetLocations(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	if next != nil {
+		c.writeNextPageLink(w, r, filter, next)
+	}
+
 	aLocs := mapper.ToApiLocs(lLocs)
 
 	json, err := json.Marshal(aLocs)
@@ -94,6 +141,65 @@ func (c locationController) handleGetLocations(w http.ResponseWriter, r *http.Re
 	w.Write(json)
 }
 
+func (c locationController) handleGetLocationClusters(w http.ResponseWriter, r *http.Request) {
+	if r.FormValue("zoom") == "" {
+		log.Printf("Missing zoom level!")
+		http.Error(w, "Bad request! (Missing zoom level.)", http.StatusBadRequest)
+		return
+	}
+
+	zoom, err := getIntParam(r, "zoom")
+	if err != nil || zoom < 0 || zoom > maxMapZoom {
+		log.Printf("Invalid zoom level!")
+		http.Error(w, "Bad request! (Invalid zoom level.)", http.StatusBadRequest)
+		return
+	}
+
+	bbox, err := getFloatListParam(r, "bbox")
+	if err != nil || (bbox != nil && !isValidBoundingBox(bbox)) {
+		log.Printf("Invalid bounding box!")
+		http.Error(w, "Bad request! (Invalid bounding box.)", http.StatusBadRequest)
+		return
+	}
+
+	filter := &lModel.LocationFilter{}
+	if bbox != nil {
+		filter.BBox = &lModel.BoundingBox{bbox[0], bbox[1], bbox[2], bbox[3]}
+	}
+
+	aClusters := &aModel.LocationClusters{[]*aModel.LocationCluster{}, []*aModel.Location{}}
+	if int(zoom) < len(zoomGeohashPrecisions) {
+		lClusters, err := c.lRepo.GetLocationClusters(filter, zoomGeohashPrecisions[zoom])
+		if err != nil {
+			log.Print(err)
+			http.Error(w, "Internal server error! (Error while reading locations.)",
+				http.StatusInternalServerError)
+			return
+		}
+		aClusters.Clusters = mapper.ToApiClusters(lClusters)
+	} else {
+		lLocs, err := c.lRepo.GetLocationsByFilter(filter)
+		if err != nil {
+			log.Print(err)
+			http.Error(w, "Internal server error! (Error while reading locations.)",
+				http.StatusInternalServerError)
+			return
+		}
+		aClusters.Locations = mapper.ToApiLocs(lLocs)
+	}
+
+	json, err := json.Marshal(aClusters)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while serializing data.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
 func (c locationController) handleCreateLocation(w http.ResponseWriter, r *http.Request) {
 	var aLoc aModel.Location
 
@@ -105,19 +211,64 @@ func (c locationController) handleCreateLocation(w http.ResponseWriter, r *http.
 		return
 	}
 
+	if !c.validateMetadata(w, &aLoc) {
+		return
+	}
+
+	if !c.validateCoordinate(w, &aLoc) {
+		return
+	}
+
+	if !c.validateEndTime(w, &aLoc) {
+		return
+	}
+
+	// Derive the time zone from the coordinate (unless disabled by the client)
+	if aLoc.TimeZone == "" && r.FormValue("auto_time_zone") != "false" {
+		aLoc.TimeZone = c.findTimeZone(aLoc.Lat, aLoc.Lng)
+	}
+
+	if !c.validateTimeZone(w, &aLoc) {
+		return
+	}
+
+	if !c.validatePlace(w, &aLoc) {
+		return
+	}
+
+	// Assign the nearest matching place (unless disabled by the client)
+	if aLoc.PlaceId == 0 && r.FormValue("auto_place") != "false" {
+		err = c.assignPlace(&aLoc)
+		if err != nil {
+			log.Print(err)
+			http.Error(w, "Internal server error! (Error while reading places.)",
+				http.StatusInternalServerError)
+			return
+		}
+	}
+
+	c.geocodeLocation(&aLoc)
+
 	lLoc := mapper.ToLogicLoc(&aLoc)
 
-	id, ct, err := c.lRepo.AddLocation(lLoc)
+	id, _, err := c.lRepo.AddLocation(lLoc)
 	if err != nil {
 		log.Print(err)
 		http.Error(w, "Internal server error! (Error while adding location.)",
 			http.StatusInternalServerError)
+		return
 	}
 
-	aLoc.Id = id
-	aLoc.ChangeTime = ct
+	// Read the stored location (incl. places, metadata, etc.)
+	lLoc, err = c.lRepo.GetLocation(id)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading location.)",
+			http.StatusInternalServerError)
+		return
+	}
 
-	json, err := json.Marshal(aLoc)
+	json, err := json.Marshal(mapper.ToApiLoc(lLoc))
 	if err != nil {
 		log.Print(err)
 		http.Error(w, "Internal server error! (Error while serializing data.)",
@@ -192,20 +343,55 @@ func (c locationController) handleChangeLocation(w http.ResponseWriter, r *http.
 		return
 	}
 
+	if !c.validateMetadata(w, &aLoc) {
+		return
+	}
+
+	if !c.validateCoordinate(w, &aLoc) {
+		return
+	}
+
+	if !c.validateEndTime(w, &aLoc) {
+		return
+	}
+
+	// Derive the time zone from the coordinate (unless disabled by the client)
+	if aLoc.TimeZone == "" && r.FormValue("auto_time_zone") != "false" {
+		aLoc.TimeZone = c.findTimeZone(aLoc.Lat, aLoc.Lng)
+	}
+
+	if !c.validateTimeZone(w, &aLoc) {
+		return
+	}
+
+	if !c.validatePlace(w, &aLoc) {
+		return
+	}
+
 	aLoc.Id = id
 
+	c.geocodeLocation(&aLoc)
+
 	lLoc := mapper.ToLogicLoc(&aLoc)
 
-	ct, err := c.lRepo.ChangeLocation(lLoc)
+	_, err = c.lRepo.ChangeLocation(lLoc)
 	if err != nil {
 		log.Print(err)
 		http.Error(w, "Internal server error! (Error while changeing location.)",
 			http.StatusInternalServerError)
+		return
 	}
 
-	aLoc.ChangeTime = ct
+	// Read the stored location (incl. places, metadata, etc.)
+	lLoc, err = c.lRepo.GetLocation(id)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading location.)",
+			http.StatusInternalServerError)
+		return
+	}
 
-	json, err := json.Marshal(aLoc)
+	json, err := json.Marshal(mapper.ToApiLoc(lLoc))
 	if err != nil {
 		log.Print(err)
 		http.Error(w, "Internal server error! (Error while serializing data.)",
@@ -236,6 +422,14 @@ func (c locationController) handleDeleteLocation(w http.ResponseWriter, r *http.
 		return
 	}
 
+	lAtts, err := c.aRepo.GetAttachments(id)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while deleting location.)",
+			http.StatusInternalServerError)
+		return
+	}
+
 	err = c.lRepo.DeleteLocation(id)
 	if err != nil {
 		log.Print(err)
@@ -243,6 +437,72 @@ func (c locationController) handleDeleteLocation(w http.ResponseWriter, r *http.
 			http.StatusInternalServerError)
 		return
 	}
+
+	// Delete attachment files which are not used anymore
+	for _, lAtt := range lAtts {
+		deleteUnusedAttachmentFile(c.aRepo, c.aStore, lAtt.Hash)
+	}
+}
+
+func (c locationController) handleGeocodeLocations(w http.ResponseWriter, r *http.Request) {
+	if c.cStore.IsEmpty() && !c.bStore.HasTimeZones() {
+		log.Printf("Reverse geocoding is disabled!")
+		http.Error(w, "Service unavailable! (No city or time zone data available.)",
+			http.StatusServiceUnavailable)
+		return
+	}
+
+	all := r.FormValue("all") == "true"
+
+	lLocs, err := c.lRepo.GetLocationGeocodes(!all)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading locations.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	// Only update locations whose values have changed
+	var changed []*lModel.Location
+	for _, lLoc := range lLocs {
+		country, region, city := lLoc.Country, lLoc.Region, lLoc.City
+		if fCountry, fRegion, fCity := c.findCity(lLoc.Lat, lLoc.Lng); fCity != "" {
+			country, region, city = fCountry, fRegion, fCity
+		}
+		tz := lLoc.TimeZone
+		if tz == "" {
+			tz = c.findTimeZone(lLoc.Lat, lLoc.Lng)
+		}
+		if country != lLoc.Country || region != lLoc.Region || city != lLoc.City ||
+			tz != lLoc.TimeZone {
+			lLoc.Country = country
+			lLoc.Region = region
+			lLoc.City = city
+			lLoc.TimeZone = tz
+			changed = append(changed, lLoc)
+		}
+	}
+
+	err = c.lRepo.ChangeLocationGeocodes(changed)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while changing locations.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	aResult := &aModel.GeocodeResult{int64(len(changed))}
+
+	json, err := json.Marshal(aResult)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while serializing data.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
 }
 
 func (c locationController) handleGetDeletedLocationIds(w http.ResponseWriter, r *http.Request) {
@@ -272,3 +532,448 @@ func (c locationController) handleGetDeletedLocationIds(w http.ResponseWriter, r
 	w.Header().Set("Content-Type", "application/json")
 	w.Write(json)
 }
+
+// parseLocationFilter reads the filter parameters of a location list request.
+func (c locationController) parseLocationFilter(w http.ResponseWriter,
+	r *http.Request) (*lModel.LocationFilter, bool) {
+	ct, err := getChangeTime(r)
+	if err != nil {
+		log.Printf("Invalid change time!")
+		http.Error(w, "Bad request! (Invalid change time.)", http.StatusBadRequest)
+		return nil, false
+	}
+
+	placeId, err := getIntParam(r, "place")
+	if err != nil {
+		log.Printf("Invalid place ID!")
+		http.Error(w, "Bad request! (Invalid place ID.)", http.StatusBadRequest)
+		return nil, false
+	}
+
+	groupId, err := getIntParam(r, "group")
+	if err != nil {
+		log.Printf("Invalid group ID!")
+		http.Error(w, "Bad request! (Invalid group ID.)", http.StatusBadRequest)
+		return nil, false
+	}
+
+	overlapFrom, err := getTimeParam(r, "overlap_from")
+	if err != nil {
+		log.Printf("Invalid overlap start time!")
+		http.Error(w, "Bad request! (Invalid overlap start time.)", http.StatusBadRequest)
+		return nil, false
+	}
+
+	overlapTo, err := getTimeParam(r, "overlap_to")
+	if err != nil {
+		log.Printf("Invalid overlap end time!")
+		http.Error(w, "Bad request! (Invalid overlap end time.)", http.StatusBadRequest)
+		return nil, false
+	}
+
+	from, err := getTimeParam(r, "from")
+	if err != nil {
+		log.Printf("Invalid start time!")
+		http.Error(w, "Bad request! (Invalid start time.)", http.StatusBadRequest)
+		return nil, false
+	}
+
+	to, err := getTimeParam(r, "to")
+	if err != nil {
+		log.Printf("Invalid end time!")
+		http.Error(w, "Bad request! (Invalid end time.)", http.StatusBadRequest)
+		return nil, false
+	}
+
+	perIds, err := getIntListParam(r, "person")
+	if err != nil {
+		log.Printf("Invalid person ID!")
+		http.Error(w, "Bad request! (Invalid person ID.)", http.StatusBadRequest)
+		return nil, false
+	}
+
+	var missing []string
+	for _, field := range r.Form["missing"] {
+		if !isValidLocationField(field) {
+			log.Printf("Invalid missing field!")
+			http.Error(w, fmt.Sprintf("Bad request! (Invalid missing field '%s'.)", field),
+				http.StatusBadRequest)
+			return nil, false
+		}
+		missing = append(missing, field)
+	}
+
+	var matchAny bool
+	switch r.FormValue("match") {
+	case "", "all":
+		matchAny = false
+	case "any":
+		matchAny = true
+	default:
+		log.Printf("Invalid match mode!")
+		http.Error(w, "Bad request! (Invalid match mode.)", http.StatusBadRequest)
+		return nil, false
+	}
+
+	filter := &lModel.LocationFilter{ChangeTime: ct, From: from, To: to,
+		OverlapFrom: overlapFrom, OverlapTo: overlapTo, Tags: getTags(r), PlaceId: placeId,
+		GroupId: groupId, PersonIds: perIds, PersonName: r.FormValue("person_name"),
+		Name: r.FormValue("name"), Description: r.FormValue("description"), Missing: missing,
+		Meta: getMeta(r), MatchAny: matchAny}
+
+	if !c.parseArea(w, r, filter) {
+		return nil, false
+	}
+
+	return filter, true
+}
+
+// parseArea reads the bounding box ("bbox=minLng,minLat,maxLng,maxLat") and the circle
+// ("near=lat,lng&radius=meters") of a location list request.
+func (c locationController) parseArea(w http.ResponseWriter, r *http.Request,
+	filter *lModel.LocationFilter) bool {
+	bbox, err := getFloatListParam(r, "bbox")
+	if err != nil || (bbox != nil && !isValidBoundingBox(bbox)) {
+		log.Printf("Invalid bounding box!")
+		http.Error(w, "Bad request! (Invalid bounding box.)", http.StatusBadRequest)
+		return false
+	}
+	if bbox != nil {
+		filter.BBox = &lModel.BoundingBox{bbox[0], bbox[1], bbox[2], bbox[3]}
+	}
+
+	near, err := getFloatListParam(r, "near")
+	if err != nil || (near != nil && (len(near) != 2 || !util.IsValidCoordinate(near[0],
+		near[1]))) {
+		log.Printf("Invalid near coordinate!")
+		http.Error(w, "Bad request! (Invalid near coordinate.)", http.StatusBadRequest)
+		return false
+	}
+
+	radius, err := getFloatParam(r, "radius")
+	if err != nil || radius < 0 || math.IsNaN(radius) || math.IsInf(radius, 0) {
+		log.Printf("Invalid radius!")
+		http.Error(w, "Bad request! (Invalid radius.)", http.StatusBadRequest)
+		return false
+	}
+	if near != nil && radius == 0 {
+		log.Printf("Missing radius!")
+		http.Error(w, "Bad request! (Missing radius.)", http.StatusBadRequest)
+		return false
+	}
+	if near != nil {
+		filter.Near = &lModel.Circle{near[0], near[1], radius}
+	}
+
+	return true
+}
+
+// parsePaging reads the sort order, the page size and the cursor of a location list request.
+func (c locationController) parsePaging(w http.ResponseWriter, r *http.Request,
+	filter *lModel.LocationFilter) bool {
+	filter.Sort = r.FormValue("sort")
+	switch {
+	case filter.Sort == "" && filter.Near != nil:
+		filter.Sort = constant.LocationSortDistance
+	case filter.Sort == "":
+		filter.Sort = constant.LocationSortTime
+	case filter.Sort == constant.LocationSortDistance && filter.Near != nil:
+	case filter.Sort == constant.LocationSortTime, filter.Sort == constant.LocationSortChangeTime,
+		filter.Sort == constant.LocationSortName, filter.Sort == constant.LocationSortId:
+	default:
+		log.Printf("Invalid sort field!")
+		http.Error(w, "Bad request! (Invalid sort field.)", http.StatusBadRequest)
+		return false
+	}
+
+	order := r.FormValue("order")
+	switch order {
+	case "", "asc":
+		filter.Descending = false
+	case "desc":
+		filter.Descending = true
+	default:
+		log.Printf("Invalid sort order!")
+		http.Error(w, "Bad request! (Invalid sort order.)", http.StatusBadRequest)
+		return false
+	}
+
+	limit, err := getIntParam(r, "limit")
+	if err != nil || limit < 0 || limit > maxLocationPageSize {
+		log.Printf("Invalid limit!")
+		http.Error(w, fmt.Sprintf("Bad request! (Limit must be between 0 and %d.)",
+			maxLocationPageSize), http.StatusBadRequest)
+		return false
+	}
+	filter.Limit = int(limit)
+
+	v := r.FormValue("cursor")
+	if v == "" {
+		return true
+	}
+	cur, err := decodeLocationCursor(v)
+	if err != nil || cur.Sort != filter.Sort || cur.Descending != filter.Descending {
+		log.Printf("Invalid cursor!")
+		http.Error(w, "Bad request! (Invalid cursor.)", http.StatusBadRequest)
+		return false
+	}
+	filter.After = &lModel.LocationCursor{cur.Value, cur.Id}
+	if filter.Limit == 0 {
+		filter.Limit = defaultLocationPageSize
+	}
+
+	return true
+}
+
+// writeNextPageLink adds a "Link" header which points to the next page. All other query
+// parameters of the request are kept.
+func (c locationController) writeNextPageLink(w http.ResponseWriter, r *http.Request,
+	filter *lModel.LocationFilter, next *lModel.LocationCursor) {
+	cur := &locationCursor{filter.Sort, filter.Descending, next.Value, next.Id}
+
+	q := r.URL.Query()
+	q.Set("cursor", encodeLocationCursor(cur))
+	q.Set("limit", strconv.Itoa(filter.Limit))
+	u := url.URL{Path: r.URL.Path, RawQuery: q.Encode()}
+
+	w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", u.String()))
+}
+
+func (c locationController) validateMetadata(w http.ResponseWriter, aLoc *aModel.Location) bool {
+	for key, aMeta := range aLoc.Metadata {
+		if key == "" || aMeta == nil || !isValidMetaType(aMeta.Type) ||
+			!isValidMetaValue(aMeta.Type, aMeta.Value) {
+			log.Printf("Invalid metadata value for key '%s'!", key)
+			http.Error(w, fmt.Sprintf("Bad request! (Invalid metadata value for key '%s'.)",
+				key), http.StatusBadRequest)
+			return false
+		}
+	}
+
+	lFields, err := c.mRepo.GetMetaFields()
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading metadata fields.)",
+			http.StatusInternalServerError)
+		return false
+	}
+
+	for _, lField := range lFields {
+		aMeta, ok := aLoc.Metadata[lField.Key]
+		if !ok {
+			if lField.Required {
+				log.Printf("Missing required metadata key '%s'!", lField.Key)
+				http.Error(w, fmt.Sprintf("Bad request! (Missing required metadata key '%s'.)",
+					lField.Key), http.StatusBadRequest)
+				return false
+			}
+			continue
+		}
+		if aMeta.Type != lField.Type {
+			log.Printf("Invalid metadata type for key '%s'!", lField.Key)
+			http.Error(w, fmt.Sprintf("Bad request! (Metadata key '%s' must be of type '%s'.)",
+				lField.Key, lField.Type), http.StatusBadRequest)
+			return false
+		}
+	}
+
+	return true
+}
+
+func (c locationController) validateCoordinate(w http.ResponseWriter,
+	aLoc *aModel.Location) bool {
+	if !util.IsValidCoordinate(aLoc.Lat, aLoc.Lng) {
+		log.Printf("Invalid location coordinate!")
+		http.Error(w, "Bad request! (Invalid coordinate.)", http.StatusBadRequest)
+		return false
+	}
+
+	if aLoc.Altitude != nil && (math.IsNaN(*aLoc.Altitude) || math.IsInf(*aLoc.Altitude, 0)) {
+		log.Printf("Invalid location altitude!")
+		http.Error(w, "Bad request! (Invalid altitude.)", http.StatusBadRequest)
+		return false
+	}
+
+	if aLoc.Accuracy != nil && (math.IsNaN(*aLoc.Accuracy) || math.IsInf(*aLoc.Accuracy, 0) ||
+		*aLoc.Accuracy < 0) {
+		log.Printf("Invalid location accuracy!")
+		http.Error(w, "Bad request! (Invalid accuracy.)", http.StatusBadRequest)
+		return false
+	}
+
+	return true
+}
+
+// validateEndTime checks that the end time of a location (if set) is not before its time and
+// calculates the duration.
+func (c locationController) validateEndTime(w http.ResponseWriter, aLoc *aModel.Location) bool {
+	aLoc.Duration = 0
+	if aLoc.EndTime == nil || aLoc.EndTime.IsZero() {
+		aLoc.EndTime = nil
+		return true
+	}
+
+	if aLoc.EndTime.Before(aLoc.Time) {
+		log.Printf("Invalid location end time!")
+		http.Error(w, "Bad request! (End time is before time.)", http.StatusBadRequest)
+		return false
+	}
+	aLoc.Duration = int64(aLoc.EndTime.Sub(aLoc.Time).Seconds())
+
+	return true
+}
+
+// validateTimeZone checks the IANA time zone name of a location (if set) and converts the location
+// time into this time zone.
+func (c locationController) validateTimeZone(w http.ResponseWriter, aLoc *aModel.Location) bool {
+	if aLoc.TimeZone == "" {
+		return true
+	}
+
+	loc, err := data.LoadTimeZone(aLoc.TimeZone)
+	if err != nil {
+		log.Printf("Invalid time zone '%s'!", aLoc.TimeZone)
+		http.Error(w, "Bad request! (Invalid time zone.)", http.StatusBadRequest)
+		return false
+	}
+	setLocationTimeZone(aLoc, loc)
+
+	return true
+}
+
+// setLocationTimeZone converts the time and the end time (if set) of a location into a time zone.
+func setLocationTimeZone(aLoc *aModel.Location, loc *time.Location) {
+	aLoc.Time = aLoc.Time.In(loc)
+	if aLoc.EndTime != nil {
+		endTime := aLoc.EndTime.In(loc)
+		aLoc.EndTime = &endTime
+	}
+}
+
+func (c locationController) validatePlace(w http.ResponseWriter, aLoc *aModel.Location) bool {
+	if aLoc.PlaceId == 0 {
+		return true
+	}
+
+	exists, err := c.pRepo.ExistsPlace(aLoc.PlaceId)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading place.)",
+			http.StatusInternalServerError)
+		return false
+	}
+	if !exists {
+		log.Printf("Unknown location place ID!")
+		http.Error(w, "Bad request! (Unknown place ID.)", http.StatusBadRequest)
+		return false
+	}
+
+	return true
+}
+
+// assignPlace assigns the nearest place whose radius contains the coordinate of a location. If the
+// location has no name, the place name is used.
+func (c locationController) assignPlace(aLoc *aModel.Location) error {
+	lMatches, err := c.pRepo.GetMatchingPlaces(aLoc.Lat, aLoc.Lng)
+	if err != nil {
+		return err
+	}
+	if len(lMatches) == 0 {
+		return nil
+	}
+
+	lPlace := lMatches[0].Place
+	aLoc.PlaceId = lPlace.Id
+	if aLoc.Name == "" {
+		aLoc.Name = lPlace.Name
+	}
+
+	return nil
+}
+
+// geocodeLocation sets the country, region and city of a location from the nearest known city.
+// If the client has set one of these fields, the location is not changed.
+func (c locationController) geocodeLocation(aLoc *aModel.Location) {
+	if aLoc.Country != "" || aLoc.Region != "" || aLoc.City != "" {
+		return
+	}
+	aLoc.Country, aLoc.Region, aLoc.City = c.findCity(aLoc.Lat, aLoc.Lng)
+}
+
+// findTimeZone returns the time zone of a coordinate. If there are no time zone boundaries for
+// the coordinate, the time zone of the nearest city is used.
+func (c locationController) findTimeZone(lat float64, lng float64) string {
+	tz := c.bStore.FindTimeZone(lat, lng)
+	if tz == "" {
+		if city := c.cStore.FindNearestCity(lat, lng); city != nil {
+			tz = city.TimeZone
+		}
+	}
+	if _, err := data.LoadTimeZone(tz); err != nil {
+		return ""
+	}
+	return tz
+}
+
+func (c locationController) findCity(lat float64, lng float64) (string, string, string) {
+	city := c.cStore.FindNearestCity(lat, lng)
+	if city == nil {
+		return "", "", ""
+	}
+	return city.Country, city.Region, city.Name
+}
+
+// isValidBoundingBox checks a bounding box "minLng,minLat,maxLng,maxLat". (minLng may be greater
+// than maxLng if the box crosses the antimeridian.)
+func isValidBoundingBox(b []float64) bool {
+	return len(b) == 4 && util.IsValidCoordinate(b[1], b[0]) && util.IsValidCoordinate(b[3], b[2]) &&
+		b[1] <= b[3]
+}
+
+func isValidMetaValue(t string, v interface{}) bool {
+	switch t {
+	case constant.MetaTypeNumber:
+		_, ok := v.(float64)
+		return ok
+	case constant.MetaTypeBoolean:
+		_, ok := v.(bool)
+		return ok
+	case constant.MetaTypeDate:
+		s, ok := v.(string)
+		if !ok {
+			return false
+		}
+		_, err := time.Parse(time.RFC3339, s)
+		return err == nil
+	default:
+		_, ok := v.(string)
+		return ok
+	}
+}
+
+// locationCursor is the content of an (opaque) location page cursor. The sort order is part of
+// the cursor, so that a cursor can't be used with a different order.
+type locationCursor struct {
+	Sort       string `json:"s"`
+	Descending bool   `json:"d"`
+	Value      string `json:"v"`
+	Id         int64  `json:"i"`
+}
+
+func encodeLocationCursor(cur *locationCursor) string {
+	b, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeLocationCursor(v string) (*locationCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(v)
+	if err != nil {
+		return nil, err
+	}
+	var cur locationCursor
+	err = json.Unmarshal(b, &cur)
+	if err != nil {
+		return nil, err
+	}
+	return &cur, nil
+}
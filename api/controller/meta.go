@@ -0,0 +1,133 @@
+package controller
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"kellnhofer.com/tracker/api/mapper"
+	aModel "kellnhofer.com/tracker/api/model"
+	"kellnhofer.com/tracker/repo"
+)
+
+type metaController struct {
+	mRepo *repo.MetaRepo
+}
+
+func NewMetaController(mRepo *repo.MetaRepo) *metaController {
+	return &metaController{mRepo}
+}
+
+// --- Public methods ---
+
+func (c metaController) GetMetaFieldsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleGetMetaFields(w, r)
+	}
+}
+
+func (c metaController) SaveMetaFieldHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleSaveMetaField(w, r)
+	}
+}
+
+func (c metaController) DeleteMetaFieldHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleDeleteMetaField(w, r)
+	}
+}
+
+// --- Private methods ---
+
+func (c metaController) handleGetMetaFields(w http.ResponseWriter, r *http.Request) {
+	lFields, err := c.mRepo.GetMetaFields()
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading metadata fields.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	aFields := mapper.ToApiMetaFields(lFields)
+
+	json, err := json.Marshal(aFields)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while serializing data.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+func (c metaController) handleSaveMetaField(w http.ResponseWriter, r *http.Request) {
+	key := mux.Vars(r)["key"]
+
+	var aField aModel.MetaField
+
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&aField)
+	if err != nil {
+		log.Printf("Invalid JSON! ('%s')", err)
+		http.Error(w, "Bad request! (Invalid JSON)", http.StatusBadRequest)
+		return
+	}
+
+	if !isValidMetaType(aField.Type) {
+		log.Printf("Invalid metadata type!")
+		http.Error(w, "Bad request! (Invalid metadata type.)", http.StatusBadRequest)
+		return
+	}
+
+	aField.Key = key
+
+	lField := mapper.ToLogicMetaField(&aField)
+
+	err = c.mRepo.SaveMetaField(lField)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while saving metadata field.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	json, err := json.Marshal(aField)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while serializing data.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+func (c metaController) handleDeleteMetaField(w http.ResponseWriter, r *http.Request) {
+	key := mux.Vars(r)["key"]
+
+	lField, err := c.mRepo.GetMetaField(key)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while deleting metadata field.)",
+			http.StatusInternalServerError)
+		return
+	}
+	if lField == nil {
+		http.Error(w, "Not found! (Unknown metadata field.)", http.StatusNotFound)
+		return
+	}
+
+	err = c.mRepo.DeleteMetaField(key)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while deleting metadata field.)",
+			http.StatusInternalServerError)
+		return
+	}
+}
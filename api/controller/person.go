@@ -0,0 +1,721 @@
+package controller
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"net/mail"
+	"time"
+
+	"kellnhofer.com/tracker/api/mapper"
+	aModel "kellnhofer.com/tracker/api/model"
+	"kellnhofer.com/tracker/config"
+	"kellnhofer.com/tracker/constant"
+	lModel "kellnhofer.com/tracker/model"
+	"kellnhofer.com/tracker/repo"
+	"kellnhofer.com/tracker/storage"
+)
+
+const (
+	defaultPersonCompanions = 20
+	maxPersonCompanions     = 100
+)
+
+type personController struct {
+	conf   *config.Config
+	pRepo  *repo.PersonRepo
+	aRepo  *repo.AttachmentRepo
+	aStore *storage.AttachmentStore
+}
+
+func NewPersonController(conf *config.Config, pRepo *repo.PersonRepo, aRepo *repo.AttachmentRepo,
+	aStore *storage.AttachmentStore) *personController {
+	return &personController{conf, pRepo, aRepo, aStore}
+}
+
+// --- Public methods ---
+
+func (c personController) GetPersonsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleGetPersons(w, r)
+	}
+}
+
+func (c personController) CreatePersonHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleCreatePerson(w, r)
+	}
+}
+
+func (c personController) GetPersonHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleGetPerson(w, r)
+	}
+}
+
+func (c personController) ChangePersonHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleChangePerson(w, r)
+	}
+}
+
+func (c personController) GetPersonAvatarHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleGetPersonAvatar(w, r)
+	}
+}
+
+func (c personController) ChangePersonAvatarHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleChangePersonAvatar(w, r)
+	}
+}
+
+func (c personController) DeletePersonAvatarHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleDeletePersonAvatar(w, r)
+	}
+}
+
+func (c personController) GetDuplicatePersonsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleGetDuplicatePersons(w, r)
+	}
+}
+
+func (c personController) MergePersonsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleMergePersons(w, r)
+	}
+}
+
+func (c personController) GetDeletedPersonIdsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleGetDeletedPersonIds(w, r)
+	}
+}
+
+func (c personController) GetPersonCompanionsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleGetPersonCompanions(w, r)
+	}
+}
+
+func (c personController) GetPersonGraphHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleGetPersonGraph(w, r)
+	}
+}
+
+// --- Private methods ---
+
+func (c personController) handleGetPersons(w http.ResponseWriter, r *http.Request) {
+	ct, err := getChangeTime(r)
+	if err != nil {
+		log.Printf("Invalid change time!")
+		http.Error(w, "Bad request! (Invalid change time.)", http.StatusBadRequest)
+		return
+	}
+
+	lPers, err := c.pRepo.GetPersonsByChangeTime(ct)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading persons.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	aPers := mapper.ToApiPers(lPers)
+
+	json, err := json.Marshal(aPers)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while serializing data.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+func (c personController) handleCreatePerson(w http.ResponseWriter, r *http.Request) {
+	var aPer aModel.Person
+
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&aPer)
+	if err != nil {
+		log.Printf("Invalid JSON! ('%s')", err)
+		http.Error(w, "Bad request! (Invalid JSON)", http.StatusBadRequest)
+		return
+	}
+
+	if !c.validatePerson(w, &aPer, 0) {
+		return
+	}
+
+	lPer := mapper.ToLogicPer(&aPer)
+
+	id, _, err := c.pRepo.AddPerson(lPer)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while adding person.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	c.writePerson(w, id)
+}
+
+func (c personController) handleGetPerson(w http.ResponseWriter, r *http.Request) {
+	lPer, ok := c.getPerson(w, r)
+	if !ok {
+		return
+	}
+
+	aPer := mapper.ToApiPer(lPer)
+
+	json, err := json.Marshal(aPer)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while serializing data.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+func (c personController) handleChangePerson(w http.ResponseWriter, r *http.Request) {
+	id, err := getId(r)
+	if err != nil {
+		log.Printf("Invalid person ID!")
+		http.Error(w, "Bad request! (Invalid person ID.)", http.StatusBadRequest)
+		return
+	}
+
+	var aPer aModel.Person
+
+	decoder := json.NewDecoder(r.Body)
+	err = decoder.Decode(&aPer)
+	if err != nil {
+		log.Printf("Invalid JSON! ('%s')", err)
+		http.Error(w, "Bad request! (Invalid JSON)", http.StatusBadRequest)
+		return
+	}
+
+	exists, err := c.pRepo.ExistsPerson(id)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while changing person.)",
+			http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Not found! (Unknown person ID.)", http.StatusNotFound)
+		return
+	}
+
+	if !c.validatePerson(w, &aPer, id) {
+		return
+	}
+
+	aPer.Id = id
+
+	lPer := mapper.ToLogicPer(&aPer)
+
+	_, err = c.pRepo.ChangePerson(lPer)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while changing person.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	c.writePerson(w, id)
+}
+
+func (c personController) handleGetPersonAvatar(w http.ResponseWriter, r *http.Request) {
+	lPer, ok := c.getPerson(w, r)
+	if !ok {
+		return
+	}
+
+	if lPer.AvatarHash == "" {
+		http.Error(w, "Not found! (Person has no avatar.)", http.StatusNotFound)
+		return
+	}
+
+	size := r.FormValue("size")
+	if size == "" {
+		size = "small"
+	}
+	if _, ok := storage.ThumbnailSizes[size]; !ok {
+		log.Printf("Invalid avatar size!")
+		http.Error(w, "Bad request! (Invalid avatar size.)", http.StatusBadRequest)
+		return
+	}
+
+	file, err := c.aStore.OpenThumbnail(lPer.AvatarHash, size)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading avatar.)",
+			http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("ETag", fmt.Sprintf("\"%s_%s\"", lPer.AvatarHash, size))
+	http.ServeContent(w, r, "", time.Unix(lPer.ChangeTime, 0), file)
+}
+
+func (c personController) handleChangePersonAvatar(w http.ResponseWriter, r *http.Request) {
+	lPer, ok := c.getPerson(w, r)
+	if !ok {
+		return
+	}
+
+	err := r.ParseMultipartForm(maxMultipartMemory)
+	if err != nil {
+		log.Printf("Invalid multipart form! ('%s')", err)
+		http.Error(w, "Bad request! (Invalid multipart form.)", http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		log.Printf("Missing file! ('%s')", err)
+		http.Error(w, "Bad request! (Missing file.)", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	usage, err := c.aRepo.GetStorageUsage()
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while changing avatar.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	hash, size, isNew, err := c.aStore.SaveFile(file)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while storing avatar.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	// Check quota (files which are already stored don't use additional space)
+	if isNew && usage+size > c.conf.AttachmentQuota {
+		deleteUnusedAttachmentFile(c.aRepo, c.aStore, hash)
+		log.Printf("Attachment quota exceeded!")
+		http.Error(w, "Request entity too large! (Attachment quota exceeded.)",
+			http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	isImage, _, _, err := c.aStore.CreateThumbnails(hash)
+	if err != nil {
+		log.Print(err)
+	}
+	if !isImage {
+		deleteUnusedAttachmentFile(c.aRepo, c.aStore, hash)
+		log.Printf("Invalid avatar image!")
+		http.Error(w, "Bad request! (Avatar must be an image.)", http.StatusBadRequest)
+		return
+	}
+
+	_, err = c.pRepo.ChangePersonAvatar(lPer.Id, hash, size)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while changing avatar.)",
+			http.StatusInternalServerError)
+		deleteUnusedAttachmentFile(c.aRepo, c.aStore, hash)
+		return
+	}
+
+	// Delete previous avatar file if it is not used anymore
+	if lPer.AvatarHash != "" && lPer.AvatarHash != hash {
+		deleteUnusedAttachmentFile(c.aRepo, c.aStore, lPer.AvatarHash)
+	}
+
+	c.writePerson(w, lPer.Id)
+}
+
+func (c personController) handleDeletePersonAvatar(w http.ResponseWriter, r *http.Request) {
+	lPer, ok := c.getPerson(w, r)
+	if !ok {
+		return
+	}
+
+	if lPer.AvatarHash == "" {
+		return
+	}
+
+	_, err := c.pRepo.ChangePersonAvatar(lPer.Id, "", 0)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while deleting avatar.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	deleteUnusedAttachmentFile(c.aRepo, c.aStore, lPer.AvatarHash)
+}
+
+func (c personController) handleGetDuplicatePersons(w http.ResponseWriter, r *http.Request) {
+	lDups, err := c.pRepo.GetDuplicatePersons()
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading persons.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	aDups := mapper.ToApiPerDups(lDups)
+
+	json, err := json.Marshal(aDups)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while serializing data.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+func (c personController) handleMergePersons(w http.ResponseWriter, r *http.Request) {
+	var aMerge aModel.PersonMerge
+
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&aMerge)
+	if err != nil {
+		log.Printf("Invalid JSON! ('%s')", err)
+		http.Error(w, "Bad request! (Invalid JSON)", http.StatusBadRequest)
+		return
+	}
+
+	if len(aMerge.SourceIds) == 0 {
+		log.Printf("Missing source person IDs!")
+		http.Error(w, "Bad request! (Missing source person IDs.)", http.StatusBadRequest)
+		return
+	}
+	for _, id := range aMerge.SourceIds {
+		if id == aMerge.TargetId {
+			log.Printf("Target person is also a source person!")
+			http.Error(w, "Bad request! (Target person is also a source person.)",
+				http.StatusBadRequest)
+			return
+		}
+	}
+
+	var avatarHashes []string
+	ids := append([]int64{aMerge.TargetId}, aMerge.SourceIds...)
+	for _, id := range ids {
+		lPer, err := c.pRepo.GetPerson(id)
+		if err != nil {
+			log.Print(err)
+			http.Error(w, "Internal server error! (Error while merging persons.)",
+				http.StatusInternalServerError)
+			return
+		}
+		if lPer == nil {
+			http.Error(w, "Not found! (Unknown person ID.)", http.StatusNotFound)
+			return
+		}
+		if id != aMerge.TargetId && lPer.AvatarHash != "" {
+			avatarHashes = append(avatarHashes, lPer.AvatarHash)
+		}
+	}
+
+	err = c.pRepo.MergePersons(aMerge.TargetId, aMerge.SourceIds)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while merging persons.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	// Delete avatar files of merged persons which are not used anymore
+	for _, hash := range avatarHashes {
+		deleteUnusedAttachmentFile(c.aRepo, c.aStore, hash)
+	}
+
+	lPer, err := c.pRepo.GetPerson(aMerge.TargetId)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading person.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	aPer := mapper.ToApiPer(lPer)
+
+	json, err := json.Marshal(aPer)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while serializing data.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+func (c personController) handleGetDeletedPersonIds(w http.ResponseWriter, r *http.Request) {
+	dt, err := getDeletionTime(r)
+	if err != nil {
+		log.Printf("Invalid deletion time!")
+		http.Error(w, "Bad request! (Invalid deletion time.)", http.StatusBadRequest)
+		return
+	}
+
+	ids, err := c.pRepo.GetDeletedPersonIdsByDeletionTime(dt)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading persons.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	json, err := json.Marshal(ids)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while serializing data.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+func (c personController) handleGetPersonCompanions(w http.ResponseWriter, r *http.Request) {
+	lPer, ok := c.getPerson(w, r)
+	if !ok {
+		return
+	}
+
+	limit, err := getIntParam(r, "limit")
+	if err != nil || limit < 0 || limit > maxPersonCompanions {
+		log.Printf("Invalid limit!")
+		http.Error(w, fmt.Sprintf("Bad request! (Limit must not be greater than %d.)",
+			maxPersonCompanions), http.StatusBadRequest)
+		return
+	}
+	if limit == 0 {
+		limit = defaultPersonCompanions
+	}
+
+	filter, ok := getPersonLocationFilter(w, r)
+	if !ok {
+		return
+	}
+
+	lComps, err := c.pRepo.GetPersonCompanions(lPer.Id, filter, int(limit))
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading companions.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	aComps := mapper.ToApiPersonCompanions(lComps)
+
+	json, err := json.Marshal(aComps)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while serializing data.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+func (c personController) handleGetPersonGraph(w http.ResponseWriter, r *http.Request) {
+	format := r.FormValue("format")
+	switch format {
+	case "":
+		format = constant.GraphFormatJson
+	case constant.GraphFormatJson, constant.GraphFormatGraphML:
+	default:
+		log.Printf("Invalid graph format!")
+		http.Error(w, "Bad request! (Invalid format.)", http.StatusBadRequest)
+		return
+	}
+
+	minWeight, err := getIntParam(r, "min_weight")
+	if err != nil || minWeight < 0 {
+		log.Printf("Invalid minimum weight!")
+		http.Error(w, "Bad request! (Invalid minimum weight.)", http.StatusBadRequest)
+		return
+	}
+	if minWeight == 0 {
+		minWeight = 1
+	}
+
+	filter, ok := getPersonLocationFilter(w, r)
+	if !ok {
+		return
+	}
+
+	lGraph, err := c.pRepo.GetPersonGraph(filter, int(minWeight))
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading person graph.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	if format == constant.GraphFormatGraphML {
+		out, err := xml.MarshalIndent(mapper.ToGraphMLPersonGraph(lGraph), "", "  ")
+		if err != nil {
+			log.Print(err)
+			http.Error(w, "Internal server error! (Error while serializing data.)",
+				http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/graphml+xml")
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment",
+			map[string]string{"filename": "persons.graphml"}))
+		w.Write([]byte(xml.Header))
+		w.Write(out)
+		return
+	}
+
+	aGraph := mapper.ToApiPersonGraph(lGraph)
+
+	json, err := json.Marshal(aGraph)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while serializing data.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+func (c personController) getPerson(w http.ResponseWriter, r *http.Request) (*lModel.Person,
+	bool) {
+	id, err := getId(r)
+	if err != nil {
+		log.Printf("Invalid person ID!")
+		http.Error(w, "Bad request! (Invalid person ID.)", http.StatusBadRequest)
+		return nil, false
+	}
+
+	lPer, err := c.pRepo.GetPerson(id)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading person.)",
+			http.StatusInternalServerError)
+		return nil, false
+	}
+	if lPer == nil {
+		http.Error(w, "Not found! (Unknown person ID.)", http.StatusNotFound)
+		return nil, false
+	}
+
+	return lPer, true
+}
+
+func (c personController) validatePerson(w http.ResponseWriter, aPer *aModel.Person,
+	id int64) bool {
+	if aPer.FirstName == "" && aPer.LastName == "" {
+		log.Printf("Missing person name!")
+		http.Error(w, "Bad request! (Missing person name.)", http.StatusBadRequest)
+		return false
+	}
+
+	if aPer.Email != "" {
+		if _, err := mail.ParseAddress(aPer.Email); err != nil {
+			log.Printf("Invalid person email!")
+			http.Error(w, "Bad request! (Invalid email address.)", http.StatusBadRequest)
+			return false
+		}
+	}
+
+	if aPer.Birthday != "" {
+		if _, err := time.Parse(constant.ApiDayFormat, aPer.Birthday); err != nil {
+			log.Printf("Invalid person birthday!")
+			http.Error(w, "Bad request! (Invalid birthday. Expected format: YYYY-MM-DD.)",
+				http.StatusBadRequest)
+			return false
+		}
+	}
+
+	// Persons are identified by name when locations are saved
+	perId, err := c.pRepo.GetPersonIdByName(aPer.FirstName, aPer.LastName)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading person.)",
+			http.StatusInternalServerError)
+		return false
+	}
+	if perId != 0 && perId != id {
+		http.Error(w, "Conflict! (Person name already exists. Use merge instead.)",
+			http.StatusConflict)
+		return false
+	}
+
+	return true
+}
+
+func (c personController) writePerson(w http.ResponseWriter, id int64) {
+	lPer, err := c.pRepo.GetPerson(id)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading person.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	aPer := mapper.ToApiPer(lPer)
+
+	json, err := json.Marshal(aPer)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while serializing data.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+// getPersonLocationFilter reads the time range of the locations which are considered for
+// co-occurrences.
+func getPersonLocationFilter(w http.ResponseWriter, r *http.Request) (*lModel.LocationFilter,
+	bool) {
+	from, err := getTimeParam(r, "from")
+	if err != nil {
+		log.Printf("Invalid start time!")
+		http.Error(w, "Bad request! (Invalid start time.)", http.StatusBadRequest)
+		return nil, false
+	}
+
+	to, err := getTimeParam(r, "to")
+	if err != nil {
+		log.Printf("Invalid end time!")
+		http.Error(w, "Bad request! (Invalid end time.)", http.StatusBadRequest)
+		return nil, false
+	}
+
+	return &lModel.LocationFilter{From: from, To: to}, true
+}
@@ -0,0 +1,360 @@
+package controller
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"kellnhofer.com/tracker/api/mapper"
+	aModel "kellnhofer.com/tracker/api/model"
+	lModel "kellnhofer.com/tracker/model"
+	"kellnhofer.com/tracker/repo"
+	"kellnhofer.com/tracker/util"
+)
+
+type placeController struct {
+	pRepo *repo.PlaceRepo
+	lRepo *repo.LocationRepo
+}
+
+func NewPlaceController(pRepo *repo.PlaceRepo, lRepo *repo.LocationRepo) *placeController {
+	return &placeController{pRepo, lRepo}
+}
+
+// --- Public methods ---
+
+func (c placeController) GetPlacesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleGetPlaces(w, r)
+	}
+}
+
+func (c placeController) CreatePlaceHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleCreatePlace(w, r)
+	}
+}
+
+func (c placeController) MatchPlacesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleMatchPlaces(w, r)
+	}
+}
+
+func (c placeController) GetPlaceHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleGetPlace(w, r)
+	}
+}
+
+func (c placeController) ChangePlaceHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleChangePlace(w, r)
+	}
+}
+
+func (c placeController) DeletePlaceHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleDeletePlace(w, r)
+	}
+}
+
+func (c placeController) GetDeletedPlaceIdsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleGetDeletedPlaceIds(w, r)
+	}
+}
+
+// --- Private methods ---
+
+func (c placeController) handleGetPlaces(w http.ResponseWriter, r *http.Request) {
+	ct, err := getChangeTime(r)
+	if err != nil {
+		log.Printf("Invalid change time!")
+		http.Error(w, "Bad request! (Invalid change time.)", http.StatusBadRequest)
+		return
+	}
+
+	lPlaces, err := c.pRepo.GetPlacesByChangeTime(ct)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading places.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	aPlaces := mapper.ToApiPlaces(lPlaces)
+
+	json, err := json.Marshal(aPlaces)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while serializing data.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+func (c placeController) handleCreatePlace(w http.ResponseWriter, r *http.Request) {
+	var aPlace aModel.Place
+
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&aPlace)
+	if err != nil {
+		log.Printf("Invalid JSON! ('%s')", err)
+		http.Error(w, "Bad request! (Invalid JSON)", http.StatusBadRequest)
+		return
+	}
+
+	if !c.validatePlace(w, &aPlace) {
+		return
+	}
+
+	lPlace := mapper.ToLogicPlace(&aPlace)
+
+	id, _, err := c.pRepo.AddPlace(lPlace)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while adding place.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	c.writePlace(w, id)
+}
+
+func (c placeController) handleMatchPlaces(w http.ResponseWriter, r *http.Request) {
+	lat, err := getFloatParam(r, "lat")
+	if err != nil {
+		log.Printf("Invalid latitude!")
+		http.Error(w, "Bad request! (Invalid latitude.)", http.StatusBadRequest)
+		return
+	}
+	lng, err := getFloatParam(r, "lng")
+	if err != nil {
+		log.Printf("Invalid longitude!")
+		http.Error(w, "Bad request! (Invalid longitude.)", http.StatusBadRequest)
+		return
+	}
+	if !util.IsValidCoordinate(lat, lng) {
+		log.Printf("Invalid coordinate!")
+		http.Error(w, "Bad request! (Invalid coordinate.)", http.StatusBadRequest)
+		return
+	}
+
+	lMatches, err := c.pRepo.GetMatchingPlaces(lat, lng)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading places.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	aMatches := mapper.ToApiPlaceMatches(lMatches)
+
+	json, err := json.Marshal(aMatches)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while serializing data.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+func (c placeController) handleGetPlace(w http.ResponseWriter, r *http.Request) {
+	id, err := getId(r)
+	if err != nil {
+		log.Printf("Invalid place ID!")
+		http.Error(w, "Bad request! (Invalid place ID.)", http.StatusBadRequest)
+		return
+	}
+
+	lPlace, err := c.pRepo.GetPlace(id)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading place.)",
+			http.StatusInternalServerError)
+		return
+	}
+	if lPlace == nil {
+		http.Error(w, "Not found! (Unknown place ID.)", http.StatusNotFound)
+		return
+	}
+
+	lLocs, err := c.lRepo.GetLocationsByFilter(&lModel.LocationFilter{PlaceId: id})
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading locations.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	aDetails := &aModel.PlaceDetails{mapper.ToApiPlace(lPlace), mapper.ToApiLocs(lLocs)}
+
+	json, err := json.Marshal(aDetails)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while serializing data.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+func (c placeController) handleChangePlace(w http.ResponseWriter, r *http.Request) {
+	id, err := getId(r)
+	if err != nil {
+		log.Printf("Invalid place ID!")
+		http.Error(w, "Bad request! (Invalid place ID.)", http.StatusBadRequest)
+		return
+	}
+
+	var aPlace aModel.Place
+
+	decoder := json.NewDecoder(r.Body)
+	err = decoder.Decode(&aPlace)
+	if err != nil {
+		log.Printf("Invalid JSON! ('%s')", err)
+		http.Error(w, "Bad request! (Invalid JSON)", http.StatusBadRequest)
+		return
+	}
+
+	exists, err := c.pRepo.ExistsPlace(id)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while changing place.)",
+			http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Not found! (Unknown place ID.)", http.StatusNotFound)
+		return
+	}
+
+	if !c.validatePlace(w, &aPlace) {
+		return
+	}
+
+	aPlace.Id = id
+
+	lPlace := mapper.ToLogicPlace(&aPlace)
+
+	_, err = c.pRepo.ChangePlace(lPlace)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while changing place.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	c.writePlace(w, id)
+}
+
+func (c placeController) handleDeletePlace(w http.ResponseWriter, r *http.Request) {
+	id, err := getId(r)
+	if err != nil {
+		log.Printf("Invalid place ID!")
+		http.Error(w, "Bad request! (Invalid place ID.)", http.StatusBadRequest)
+		return
+	}
+
+	exists, err := c.pRepo.ExistsPlace(id)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while deleting place.)",
+			http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Not found! (Unknown place ID.)", http.StatusNotFound)
+		return
+	}
+
+	err = c.pRepo.DeletePlace(id)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while deleting place.)",
+			http.StatusInternalServerError)
+		return
+	}
+}
+
+func (c placeController) handleGetDeletedPlaceIds(w http.ResponseWriter, r *http.Request) {
+	dt, err := getDeletionTime(r)
+	if err != nil {
+		log.Printf("Invalid deletion time!")
+		http.Error(w, "Bad request! (Invalid deletion time.)", http.StatusBadRequest)
+		return
+	}
+
+	ids, err := c.pRepo.GetDeletedPlaceIdsByDeletionTime(dt)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading places.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	json, err := json.Marshal(ids)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while serializing data.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+func (c placeController) validatePlace(w http.ResponseWriter, aPlace *aModel.Place) bool {
+	if aPlace.Name == "" {
+		log.Printf("Missing place name!")
+		http.Error(w, "Bad request! (Missing place name.)", http.StatusBadRequest)
+		return false
+	}
+
+	if !util.IsValidCoordinate(aPlace.Lat, aPlace.Lng) {
+		log.Printf("Invalid place coordinate!")
+		http.Error(w, "Bad request! (Invalid coordinate.)", http.StatusBadRequest)
+		return false
+	}
+
+	if aPlace.Radius <= 0 {
+		log.Printf("Invalid place radius!")
+		http.Error(w, "Bad request! (Radius must be greater than zero.)", http.StatusBadRequest)
+		return false
+	}
+
+	return true
+}
+
+func (c placeController) writePlace(w http.ResponseWriter, id int64) {
+	lPlace, err := c.pRepo.GetPlace(id)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading place.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	aPlace := mapper.ToApiPlace(lPlace)
+
+	json, err := json.Marshal(aPlace)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while serializing data.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
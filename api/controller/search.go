@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"kellnhofer.com/tracker/api/mapper"
+	"kellnhofer.com/tracker/repo"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+type searchController struct {
+	lRepo *repo.LocationRepo
+}
+
+func NewSearchController(lRepo *repo.LocationRepo) *searchController {
+	return &searchController{lRepo}
+}
+
+// --- Public methods ---
+
+func (c searchController) SearchHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleSearch(w, r)
+	}
+}
+
+// --- Private methods ---
+
+func (c searchController) handleSearch(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.FormValue("q"))
+	if q == "" {
+		log.Printf("Missing search query!")
+		http.Error(w, "Bad request! (Missing search query.)", http.StatusBadRequest)
+		return
+	}
+
+	limit, err := getIntParam(r, "limit")
+	if err != nil || limit < 0 || limit > maxSearchLimit {
+		log.Printf("Invalid limit!")
+		http.Error(w, fmt.Sprintf("Bad request! (Limit must not be greater than %d.)",
+			maxSearchLimit), http.StatusBadRequest)
+		return
+	}
+	if limit == 0 {
+		limit = defaultSearchLimit
+	}
+
+	lResults, err := c.lRepo.SearchLocations(q, int(limit))
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while searching locations.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	aResults := mapper.ToApiSearchResults(lResults)
+
+	json, err := json.Marshal(aResults)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while serializing data.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
@@ -0,0 +1,191 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"kellnhofer.com/tracker/api/mapper"
+	"kellnhofer.com/tracker/constant"
+	lModel "kellnhofer.com/tracker/model"
+	"kellnhofer.com/tracker/repo"
+	"kellnhofer.com/tracker/storage"
+)
+
+const (
+	defaultStatsTopPersons = 10
+	maxStatsTopPersons     = 100
+)
+
+type statsController struct {
+	lRepo  *repo.LocationRepo
+	bStore *storage.BoundaryStore
+}
+
+func NewStatsController(lRepo *repo.LocationRepo,
+	bStore *storage.BoundaryStore) *statsController {
+	return &statsController{lRepo, bStore}
+}
+
+// --- Public methods ---
+
+func (c statsController) GetStatsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleGetStats(w, r)
+	}
+}
+
+func (c statsController) GetCountryStatsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleGetCountryStats(w, r)
+	}
+}
+
+// --- Private methods ---
+
+func (c statsController) handleGetStats(w http.ResponseWriter, r *http.Request) {
+	period := r.FormValue("period")
+	switch period {
+	case "":
+		period = constant.StatsPeriodMonth
+	case constant.StatsPeriodDay, constant.StatsPeriodWeek, constant.StatsPeriodMonth,
+		constant.StatsPeriodYear:
+	default:
+		log.Printf("Invalid period!")
+		http.Error(w, "Bad request! (Invalid period.)", http.StatusBadRequest)
+		return
+	}
+
+	top, err := getIntParam(r, "top")
+	if err != nil || top < 0 || top > maxStatsTopPersons {
+		log.Printf("Invalid top persons count!")
+		http.Error(w, fmt.Sprintf("Bad request! (Top persons count must not be greater than "+
+			"%d.)", maxStatsTopPersons), http.StatusBadRequest)
+		return
+	}
+	if top == 0 {
+		top = defaultStatsTopPersons
+	}
+
+	from, err := getTimeParam(r, "from")
+	if err != nil {
+		log.Printf("Invalid start time!")
+		http.Error(w, "Bad request! (Invalid start time.)", http.StatusBadRequest)
+		return
+	}
+
+	to, err := getTimeParam(r, "to")
+	if err != nil {
+		log.Printf("Invalid end time!")
+		http.Error(w, "Bad request! (Invalid end time.)", http.StatusBadRequest)
+		return
+	}
+
+	perIds, err := getIntListParam(r, "person")
+	if err != nil {
+		log.Printf("Invalid person ID!")
+		http.Error(w, "Bad request! (Invalid person ID.)", http.StatusBadRequest)
+		return
+	}
+
+	filter := &lModel.LocationFilter{From: from, To: to, PersonIds: perIds}
+
+	lStats, err := c.lRepo.GetLocationStats(filter, period, int(top))
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading stats.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	aStats := mapper.ToApiStats(lStats)
+
+	json, err := json.Marshal(aStats)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while serializing data.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+func (c statsController) handleGetCountryStats(w http.ResponseWriter, r *http.Request) {
+	from, err := getTimeParam(r, "from")
+	if err != nil {
+		log.Printf("Invalid start time!")
+		http.Error(w, "Bad request! (Invalid start time.)", http.StatusBadRequest)
+		return
+	}
+
+	to, err := getTimeParam(r, "to")
+	if err != nil {
+		log.Printf("Invalid end time!")
+		http.Error(w, "Bad request! (Invalid end time.)", http.StatusBadRequest)
+		return
+	}
+
+	perIds, err := getIntListParam(r, "person")
+	if err != nil {
+		log.Printf("Invalid person ID!")
+		http.Error(w, "Bad request! (Invalid person ID.)", http.StatusBadRequest)
+		return
+	}
+
+	err = c.updateLocationBoundaries()
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while updating location countries.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	filter := &lModel.LocationFilter{From: from, To: to, PersonIds: perIds}
+
+	lCountries, err := c.lRepo.GetCountryVisits(filter)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading stats.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	for _, lCountry := range lCountries {
+		lCountry.Name = c.bStore.GetName(lCountry.Code)
+		for _, lSubdivision := range lCountry.Subdivisions {
+			lSubdivision.Name = c.bStore.GetName(lSubdivision.Code)
+		}
+	}
+
+	aCountries := mapper.ToApiCountryVisits(lCountries)
+
+	json, err := json.Marshal(aCountries)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while serializing data.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+// updateLocationBoundaries determines the country and subdivision of new locations and of
+// locations whose coordinate has changed.
+func (c statsController) updateLocationBoundaries() error {
+	lBounds, err := c.lRepo.GetStaleLocationBoundaries()
+	if err != nil {
+		return err
+	}
+
+	for _, lBound := range lBounds {
+		lBound.CountryCode, lBound.SubdivisionCode = c.bStore.FindBoundaries(lBound.Lat,
+			lBound.Lng)
+	}
+
+	return c.lRepo.SaveLocationBoundaries(lBounds)
+}
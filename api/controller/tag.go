@@ -0,0 +1,387 @@
+package controller
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"kellnhofer.com/tracker/api/mapper"
+	aModel "kellnhofer.com/tracker/api/model"
+	"kellnhofer.com/tracker/repo"
+	"kellnhofer.com/tracker/util"
+)
+
+type tagController struct {
+	tRepo *repo.TagRepo
+}
+
+func NewTagController(tRepo *repo.TagRepo) *tagController {
+	return &tagController{tRepo}
+}
+
+// --- Public methods ---
+
+func (c tagController) GetTagsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleGetTags(w, r)
+	}
+}
+
+func (c tagController) CreateTagHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleCreateTag(w, r)
+	}
+}
+
+func (c tagController) GetTagHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleGetTag(w, r)
+	}
+}
+
+func (c tagController) ChangeTagHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleChangeTag(w, r)
+	}
+}
+
+func (c tagController) DeleteTagHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleDeleteTag(w, r)
+	}
+}
+
+func (c tagController) MergeTagsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleMergeTags(w, r)
+	}
+}
+
+func (c tagController) GetDeletedTagIdsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleGetDeletedTagIds(w, r)
+	}
+}
+
+// --- Private methods ---
+
+func (c tagController) handleGetTags(w http.ResponseWriter, r *http.Request) {
+	ct, err := getChangeTime(r)
+	if err != nil {
+		log.Printf("Invalid change time!")
+		http.Error(w, "Bad request! (Invalid change time.)", http.StatusBadRequest)
+		return
+	}
+
+	lTags, err := c.tRepo.GetTagsByChangeTime(ct)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading tags.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	aTags := mapper.ToApiTags(lTags)
+
+	json, err := json.Marshal(aTags)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while serializing data.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+func (c tagController) handleCreateTag(w http.ResponseWriter, r *http.Request) {
+	var aTag aModel.Tag
+
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&aTag)
+	if err != nil {
+		log.Printf("Invalid JSON! ('%s')", err)
+		http.Error(w, "Bad request! (Invalid JSON)", http.StatusBadRequest)
+		return
+	}
+
+	aTag.Name = util.CleanTagName(aTag.Name)
+	if aTag.Name == "" {
+		log.Printf("Missing tag name!")
+		http.Error(w, "Bad request! (Missing tag name.)", http.StatusBadRequest)
+		return
+	}
+
+	if !c.checkTagNameAvailable(w, aTag.Name, 0) {
+		return
+	}
+
+	lTag := mapper.ToLogicTag(&aTag)
+
+	id, ct, err := c.tRepo.AddTag(lTag)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while adding tag.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	aTag.Id = id
+	aTag.ChangeTime = ct
+
+	json, err := json.Marshal(aTag)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while serializing data.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+func (c tagController) handleGetTag(w http.ResponseWriter, r *http.Request) {
+	id, err := getId(r)
+	if err != nil {
+		log.Printf("Invalid tag ID!")
+		http.Error(w, "Bad request! (Invalid tag ID.)", http.StatusBadRequest)
+		return
+	}
+
+	lTag, err := c.tRepo.GetTag(id)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading tag.)",
+			http.StatusInternalServerError)
+		return
+	}
+	if lTag == nil {
+		http.Error(w, "Not found! (Unknown tag ID.)", http.StatusNotFound)
+		return
+	}
+
+	aTag := mapper.ToApiTag(lTag)
+
+	json, err := json.Marshal(aTag)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while serializing data.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+func (c tagController) handleChangeTag(w http.ResponseWriter, r *http.Request) {
+	id, err := getId(r)
+	if err != nil {
+		log.Printf("Invalid tag ID!")
+		http.Error(w, "Bad request! (Invalid tag ID.)", http.StatusBadRequest)
+		return
+	}
+
+	var aTag aModel.Tag
+
+	decoder := json.NewDecoder(r.Body)
+	err = decoder.Decode(&aTag)
+	if err != nil {
+		log.Printf("Invalid JSON! ('%s')", err)
+		http.Error(w, "Bad request! (Invalid JSON)", http.StatusBadRequest)
+		return
+	}
+
+	aTag.Name = util.CleanTagName(aTag.Name)
+	if aTag.Name == "" {
+		log.Printf("Missing tag name!")
+		http.Error(w, "Bad request! (Missing tag name.)", http.StatusBadRequest)
+		return
+	}
+
+	exists, err := c.tRepo.ExistsTag(id)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while changing tag.)",
+			http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Not found! (Unknown tag ID.)", http.StatusNotFound)
+		return
+	}
+
+	if !c.checkTagNameAvailable(w, aTag.Name, id) {
+		return
+	}
+
+	aTag.Id = id
+
+	lTag := mapper.ToLogicTag(&aTag)
+
+	ct, err := c.tRepo.ChangeTag(lTag)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while changing tag.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	aTag.ChangeTime = ct
+
+	json, err := json.Marshal(aTag)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while serializing data.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+func (c tagController) handleDeleteTag(w http.ResponseWriter, r *http.Request) {
+	id, err := getId(r)
+	if err != nil {
+		log.Printf("Invalid tag ID!")
+		http.Error(w, "Bad request! (Invalid tag ID.)", http.StatusBadRequest)
+		return
+	}
+
+	exists, err := c.tRepo.ExistsTag(id)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while deleting tag.)",
+			http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Not found! (Unknown tag ID.)", http.StatusNotFound)
+		return
+	}
+
+	err = c.tRepo.DeleteTag(id)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while deleting tag.)",
+			http.StatusInternalServerError)
+		return
+	}
+}
+
+func (c tagController) handleMergeTags(w http.ResponseWriter, r *http.Request) {
+	var aMerge aModel.TagMerge
+
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&aMerge)
+	if err != nil {
+		log.Printf("Invalid JSON! ('%s')", err)
+		http.Error(w, "Bad request! (Invalid JSON)", http.StatusBadRequest)
+		return
+	}
+
+	if len(aMerge.SourceIds) == 0 {
+		log.Printf("Missing source tag IDs!")
+		http.Error(w, "Bad request! (Missing source tag IDs.)", http.StatusBadRequest)
+		return
+	}
+	for _, id := range aMerge.SourceIds {
+		if id == aMerge.TargetId {
+			log.Printf("Target tag is also a source tag!")
+			http.Error(w, "Bad request! (Target tag is also a source tag.)",
+				http.StatusBadRequest)
+			return
+		}
+	}
+
+	ids := append([]int64{aMerge.TargetId}, aMerge.SourceIds...)
+	for _, id := range ids {
+		exists, err := c.tRepo.ExistsTag(id)
+		if err != nil {
+			log.Print(err)
+			http.Error(w, "Internal server error! (Error while merging tags.)",
+				http.StatusInternalServerError)
+			return
+		}
+		if !exists {
+			http.Error(w, "Not found! (Unknown tag ID.)", http.StatusNotFound)
+			return
+		}
+	}
+
+	err = c.tRepo.MergeTags(aMerge.TargetId, aMerge.SourceIds)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while merging tags.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	lTag, err := c.tRepo.GetTag(aMerge.TargetId)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading tag.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	aTag := mapper.ToApiTag(lTag)
+
+	json, err := json.Marshal(aTag)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while serializing data.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+func (c tagController) handleGetDeletedTagIds(w http.ResponseWriter, r *http.Request) {
+	dt, err := getDeletionTime(r)
+	if err != nil {
+		log.Printf("Invalid deletion time!")
+		http.Error(w, "Bad request! (Invalid deletion time.)", http.StatusBadRequest)
+		return
+	}
+
+	ids, err := c.tRepo.GetDeletedTagIdsByDeletionTime(dt)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading tags.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	json, err := json.Marshal(ids)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while serializing data.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+func (c tagController) checkTagNameAvailable(w http.ResponseWriter, name string, id int64) bool {
+	lTag, err := c.tRepo.GetTagByName(name)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading tag.)",
+			http.StatusInternalServerError)
+		return false
+	}
+	if lTag != nil && lTag.Id != id {
+		http.Error(w, "Conflict! (Tag name already exists. Use merge instead.)",
+			http.StatusConflict)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"kellnhofer.com/tracker/api/mapper"
+	"kellnhofer.com/tracker/constant"
+	lModel "kellnhofer.com/tracker/model"
+	"kellnhofer.com/tracker/repo"
+)
+
+const (
+	maxTimelineDays  = 31
+	memoryDateFormat = "01-02"
+)
+
+type timelineController struct {
+	lRepo *repo.LocationRepo
+}
+
+func NewTimelineController(lRepo *repo.LocationRepo) *timelineController {
+	return &timelineController{lRepo}
+}
+
+// --- Public methods ---
+
+func (c timelineController) GetTimelineHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleGetTimeline(w, r)
+	}
+}
+
+func (c timelineController) GetMemoriesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleGetMemories(w, r)
+	}
+}
+
+// --- Private methods ---
+
+func (c timelineController) handleGetTimeline(w http.ResponseWriter, r *http.Request) {
+	start, err := getDateParam(r, "date", constant.ApiDayFormat)
+	if err != nil {
+		log.Printf("Invalid date!")
+		http.Error(w, "Bad request! (Invalid date.)", http.StatusBadRequest)
+		return
+	}
+
+	days, err := getIntParam(r, "days")
+	if err != nil || days < 0 || days > maxTimelineDays {
+		log.Printf("Invalid day count!")
+		http.Error(w, fmt.Sprintf("Bad request! (Day count must not be greater than %d.)",
+			maxTimelineDays), http.StatusBadRequest)
+		return
+	}
+	if days == 0 {
+		days = 1
+	}
+
+	perIds, err := getIntListParam(r, "person")
+	if err != nil {
+		log.Printf("Invalid person ID!")
+		http.Error(w, "Bad request! (Invalid person ID.)", http.StatusBadRequest)
+		return
+	}
+
+	filter := &lModel.LocationFilter{PersonIds: perIds}
+
+	lDays, err := c.lRepo.GetTimeline(filter, start, int(days))
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading timeline.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	aDays := mapper.ToApiTimeline(lDays)
+
+	json, err := json.Marshal(aDays)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while serializing data.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+func (c timelineController) handleGetMemories(w http.ResponseWriter, r *http.Request) {
+	date, err := getDateParam(r, "date", memoryDateFormat)
+	if err != nil {
+		log.Printf("Invalid date!")
+		http.Error(w, "Bad request! (Invalid date.)", http.StatusBadRequest)
+		return
+	}
+
+	perIds, err := getIntListParam(r, "person")
+	if err != nil {
+		log.Printf("Invalid person ID!")
+		http.Error(w, "Bad request! (Invalid person ID.)", http.StatusBadRequest)
+		return
+	}
+
+	filter := &lModel.LocationFilter{PersonIds: perIds}
+
+	lYears, err := c.lRepo.GetMemories(filter, date.Month(), date.Day(), time.Now().Year())
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading memories.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	aYears := mapper.ToApiMemories(lYears)
+
+	json, err := json.Marshal(aYears)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while serializing data.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
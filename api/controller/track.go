@@ -0,0 +1,452 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+
+	"kellnhofer.com/tracker/api/mapper"
+	aModel "kellnhofer.com/tracker/api/model"
+	lModel "kellnhofer.com/tracker/model"
+	"kellnhofer.com/tracker/repo"
+	"kellnhofer.com/tracker/util"
+)
+
+const maxTrackPointsPerRequest = 100000
+
+type trackController struct {
+	tRepo *repo.TrackRepo
+}
+
+func NewTrackController(tRepo *repo.TrackRepo) *trackController {
+	return &trackController{tRepo}
+}
+
+// --- Public methods ---
+
+func (c trackController) GetTracksHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleGetTracks(w, r)
+	}
+}
+
+func (c trackController) CreateTrackHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleCreateTrack(w, r)
+	}
+}
+
+func (c trackController) GetTrackHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleGetTrack(w, r)
+	}
+}
+
+func (c trackController) ChangeTrackHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleChangeTrack(w, r)
+	}
+}
+
+func (c trackController) DeleteTrackHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleDeleteTrack(w, r)
+	}
+}
+
+func (c trackController) GetDeletedTrackIdsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleGetDeletedTrackIds(w, r)
+	}
+}
+
+func (c trackController) GetTrackPointsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleGetTrackPoints(w, r)
+	}
+}
+
+func (c trackController) CreateTrackPointsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleCreateTrackPoints(w, r)
+	}
+}
+
+// --- Private methods ---
+
+func (c trackController) handleGetTracks(w http.ResponseWriter, r *http.Request) {
+	ct, err := getChangeTime(r)
+	if err != nil {
+		log.Printf("Invalid change time!")
+		http.Error(w, "Bad request! (Invalid change time.)", http.StatusBadRequest)
+		return
+	}
+
+	lTracks, err := c.tRepo.GetTracksByChangeTime(ct)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading tracks.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	aTracks := mapper.ToApiTracks(lTracks)
+
+	json, err := json.Marshal(aTracks)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while serializing data.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+func (c trackController) handleCreateTrack(w http.ResponseWriter, r *http.Request) {
+	var aTrack aModel.Track
+
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&aTrack)
+	if err != nil {
+		log.Printf("Invalid JSON! ('%s')", err)
+		http.Error(w, "Bad request! (Invalid JSON)", http.StatusBadRequest)
+		return
+	}
+
+	lTrack := mapper.ToLogicTrack(&aTrack)
+
+	id, _, err := c.tRepo.AddTrack(lTrack)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while adding track.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	c.writeTrack(w, id)
+}
+
+func (c trackController) handleGetTrack(w http.ResponseWriter, r *http.Request) {
+	id, err := getId(r)
+	if err != nil {
+		log.Printf("Invalid track ID!")
+		http.Error(w, "Bad request! (Invalid track ID.)", http.StatusBadRequest)
+		return
+	}
+
+	c.writeTrack(w, id)
+}
+
+func (c trackController) handleChangeTrack(w http.ResponseWriter, r *http.Request) {
+	id, err := getId(r)
+	if err != nil {
+		log.Printf("Invalid track ID!")
+		http.Error(w, "Bad request! (Invalid track ID.)", http.StatusBadRequest)
+		return
+	}
+
+	var aTrack aModel.Track
+
+	decoder := json.NewDecoder(r.Body)
+	err = decoder.Decode(&aTrack)
+	if err != nil {
+		log.Printf("Invalid JSON! ('%s')", err)
+		http.Error(w, "Bad request! (Invalid JSON)", http.StatusBadRequest)
+		return
+	}
+
+	if !c.checkTrack(w, id) {
+		return
+	}
+
+	aTrack.Id = id
+
+	lTrack := mapper.ToLogicTrack(&aTrack)
+
+	_, err = c.tRepo.ChangeTrack(lTrack)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while changing track.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	c.writeTrack(w, id)
+}
+
+func (c trackController) handleDeleteTrack(w http.ResponseWriter, r *http.Request) {
+	id, err := getId(r)
+	if err != nil {
+		log.Printf("Invalid track ID!")
+		http.Error(w, "Bad request! (Invalid track ID.)", http.StatusBadRequest)
+		return
+	}
+
+	if !c.checkTrack(w, id) {
+		return
+	}
+
+	err = c.tRepo.DeleteTrack(id)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while deleting track.)",
+			http.StatusInternalServerError)
+		return
+	}
+}
+
+func (c trackController) handleGetDeletedTrackIds(w http.ResponseWriter, r *http.Request) {
+	dt, err := getDeletionTime(r)
+	if err != nil {
+		log.Printf("Invalid deletion time!")
+		http.Error(w, "Bad request! (Invalid deletion time.)", http.StatusBadRequest)
+		return
+	}
+
+	ids, err := c.tRepo.GetDeletedTrackIdsByDeletionTime(dt)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading tracks.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	json, err := json.Marshal(ids)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while serializing data.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+func (c trackController) handleGetTrackPoints(w http.ResponseWriter, r *http.Request) {
+	id, err := getId(r)
+	if err != nil {
+		log.Printf("Invalid track ID!")
+		http.Error(w, "Bad request! (Invalid track ID.)", http.StatusBadRequest)
+		return
+	}
+
+	from, err := getTimeParam(r, "from")
+	if err != nil {
+		log.Printf("Invalid from time!")
+		http.Error(w, "Bad request! (Invalid from time.)", http.StatusBadRequest)
+		return
+	}
+	to, err := getTimeParam(r, "to")
+	if err != nil {
+		log.Printf("Invalid to time!")
+		http.Error(w, "Bad request! (Invalid to time.)", http.StatusBadRequest)
+		return
+	}
+	tolerance, err := getFloatParam(r, "tolerance")
+	if err != nil || tolerance < 0 {
+		log.Printf("Invalid tolerance!")
+		http.Error(w, "Bad request! (Invalid tolerance.)", http.StatusBadRequest)
+		return
+	}
+	maxPoints, err := getIntParam(r, "max_points")
+	if err != nil || maxPoints < 0 {
+		log.Printf("Invalid max points!")
+		http.Error(w, "Bad request! (Invalid max points.)", http.StatusBadRequest)
+		return
+	}
+
+	if !c.checkTrack(w, id) {
+		return
+	}
+
+	lPoints, err := c.tRepo.GetTrackPoints(id, from, to)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading track points.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	if tolerance > 0 {
+		lPoints = simplifyTrackPoints(lPoints, tolerance)
+	}
+	if maxPoints > 0 {
+		lPoints = thinTrackPoints(lPoints, int(maxPoints))
+	}
+
+	aPoints := mapper.ToApiTrackPoints(lPoints)
+
+	json, err := json.Marshal(aPoints)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while serializing data.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+func (c trackController) handleCreateTrackPoints(w http.ResponseWriter, r *http.Request) {
+	id, err := getId(r)
+	if err != nil {
+		log.Printf("Invalid track ID!")
+		http.Error(w, "Bad request! (Invalid track ID.)", http.StatusBadRequest)
+		return
+	}
+
+	var aPoints []*aModel.TrackPoint
+
+	decoder := json.NewDecoder(r.Body)
+	err = decoder.Decode(&aPoints)
+	if err != nil {
+		log.Printf("Invalid JSON! ('%s')", err)
+		http.Error(w, "Bad request! (Invalid JSON)", http.StatusBadRequest)
+		return
+	}
+
+	if len(aPoints) > maxTrackPointsPerRequest {
+		log.Printf("Too many track points!")
+		http.Error(w, fmt.Sprintf("Bad request! (More than %d track points.)",
+			maxTrackPointsPerRequest), http.StatusBadRequest)
+		return
+	}
+	for i, aPoint := range aPoints {
+		if !isValidTrackPoint(aPoint) {
+			log.Printf("Invalid track point!")
+			http.Error(w, fmt.Sprintf("Bad request! (Invalid track point at index %d.)", i),
+				http.StatusBadRequest)
+			return
+		}
+	}
+
+	if !c.checkTrack(w, id) {
+		return
+	}
+
+	lPoints := mapper.ToLogicTrackPoints(aPoints)
+
+	n, err := c.tRepo.AddTrackPoints(id, lPoints)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while adding track points.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	aImport := &aModel.TrackPointImport{len(aPoints), n}
+
+	json, err := json.Marshal(aImport)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while serializing data.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+func (c trackController) checkTrack(w http.ResponseWriter, id int64) bool {
+	exists, err := c.tRepo.ExistsTrack(id)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading track.)",
+			http.StatusInternalServerError)
+		return false
+	}
+	if !exists {
+		http.Error(w, "Not found! (Unknown track ID.)", http.StatusNotFound)
+		return false
+	}
+	return true
+}
+
+func (c trackController) writeTrack(w http.ResponseWriter, id int64) {
+	lTrack, err := c.tRepo.GetTrack(id)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading track.)",
+			http.StatusInternalServerError)
+		return
+	}
+	if lTrack == nil {
+		http.Error(w, "Not found! (Unknown track ID.)", http.StatusNotFound)
+		return
+	}
+
+	aTrack := mapper.ToApiTrack(lTrack)
+
+	json, err := json.Marshal(aTrack)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while serializing data.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+func isValidTrackPoint(aPoint *aModel.TrackPoint) bool {
+	if aPoint == nil || aPoint.Time.IsZero() || !util.IsValidCoordinate(aPoint.Lat, aPoint.Lng) {
+		return false
+	}
+	for _, v := range []*float64{aPoint.Altitude, aPoint.Accuracy, aPoint.Speed, aPoint.Bearing} {
+		if v != nil && (math.IsNaN(*v) || math.IsInf(*v, 0)) {
+			return false
+		}
+	}
+	if aPoint.Accuracy != nil && *aPoint.Accuracy < 0 {
+		return false
+	}
+	if aPoint.Speed != nil && *aPoint.Speed < 0 {
+		return false
+	}
+	if aPoint.Bearing != nil && (*aPoint.Bearing < 0 || *aPoint.Bearing >= 360) {
+		return false
+	}
+	return true
+}
+
+// simplifyTrackPoints drops points which deviate less than tolerance meters from the path.
+func simplifyTrackPoints(lPoints []*lModel.TrackPoint, tolerance float64) []*lModel.TrackPoint {
+	lats := make([]float64, len(lPoints))
+	lngs := make([]float64, len(lPoints))
+	for i, lPoint := range lPoints {
+		lats[i] = lPoint.Lat
+		lngs[i] = lPoint.Lng
+	}
+
+	var oPoints []*lModel.TrackPoint
+	for _, i := range util.SimplifyPath(lats, lngs, tolerance) {
+		oPoints = append(oPoints, lPoints[i])
+	}
+	return oPoints
+}
+
+// thinTrackPoints reduces the points to at most maxPoints evenly distributed points. The first and
+// the last point are always kept.
+func thinTrackPoints(lPoints []*lModel.TrackPoint, maxPoints int) []*lModel.TrackPoint {
+	n := len(lPoints)
+	if n <= maxPoints {
+		return lPoints
+	}
+	if maxPoints == 1 {
+		return lPoints[:1]
+	}
+
+	oPoints := make([]*lModel.TrackPoint, maxPoints)
+	for i := 0; i < maxPoints; i++ {
+		oPoints[i] = lPoints[i*(n-1)/(maxPoints-1)]
+	}
+	return oPoints
+}
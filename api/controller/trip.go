@@ -0,0 +1,374 @@
+package controller
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"kellnhofer.com/tracker/api/mapper"
+	aModel "kellnhofer.com/tracker/api/model"
+	lModel "kellnhofer.com/tracker/model"
+	"kellnhofer.com/tracker/repo"
+	"kellnhofer.com/tracker/util"
+)
+
+type tripController struct {
+	tRepo *repo.TripRepo
+	lRepo *repo.LocationRepo
+	aRepo *repo.AttachmentRepo
+}
+
+func NewTripController(tRepo *repo.TripRepo, lRepo *repo.LocationRepo,
+	aRepo *repo.AttachmentRepo) *tripController {
+	return &tripController{tRepo, lRepo, aRepo}
+}
+
+// --- Public methods ---
+
+func (c tripController) GetTripsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleGetTrips(w, r)
+	}
+}
+
+func (c tripController) CreateTripHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleCreateTrip(w, r)
+	}
+}
+
+func (c tripController) GetTripHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleGetTrip(w, r)
+	}
+}
+
+func (c tripController) ChangeTripHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleChangeTrip(w, r)
+	}
+}
+
+func (c tripController) DeleteTripHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleDeleteTrip(w, r)
+	}
+}
+
+func (c tripController) GetDeletedTripIdsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.handleGetDeletedTripIds(w, r)
+	}
+}
+
+// --- Private methods ---
+
+func (c tripController) handleGetTrips(w http.ResponseWriter, r *http.Request) {
+	ct, err := getChangeTime(r)
+	if err != nil {
+		log.Printf("Invalid change time!")
+		http.Error(w, "Bad request! (Invalid change time.)", http.StatusBadRequest)
+		return
+	}
+
+	lTrips, err := c.tRepo.GetTripsByChangeTime(ct)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading trips.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	aTrips := mapper.ToApiTrips(lTrips)
+
+	json, err := json.Marshal(aTrips)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while serializing data.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+func (c tripController) handleCreateTrip(w http.ResponseWriter, r *http.Request) {
+	var aTrip aModel.Trip
+
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&aTrip)
+	if err != nil {
+		log.Printf("Invalid JSON! ('%s')", err)
+		http.Error(w, "Bad request! (Invalid JSON)", http.StatusBadRequest)
+		return
+	}
+
+	if !c.validateTrip(w, &aTrip) {
+		return
+	}
+
+	lTrip := mapper.ToLogicTrip(&aTrip)
+
+	id, ct, err := c.tRepo.AddTrip(lTrip)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while adding trip.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	c.writeTrip(w, id, ct)
+}
+
+func (c tripController) handleGetTrip(w http.ResponseWriter, r *http.Request) {
+	id, err := getId(r)
+	if err != nil {
+		log.Printf("Invalid trip ID!")
+		http.Error(w, "Bad request! (Invalid trip ID.)", http.StatusBadRequest)
+		return
+	}
+
+	lTrip, err := c.tRepo.GetTrip(id)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading trip.)",
+			http.StatusInternalServerError)
+		return
+	}
+	if lTrip == nil {
+		http.Error(w, "Not found! (Unknown trip ID.)", http.StatusNotFound)
+		return
+	}
+
+	lLocs, err := c.lRepo.GetLocationsByFilter(&lModel.LocationFilter{TripId: id})
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading locations.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	aDetails := &aModel.TripDetails{mapper.ToApiTrip(lTrip), mapper.ToApiLocs(lLocs),
+		getTripDistance(lLocs), getTripDuration(lLocs)}
+
+	json, err := json.Marshal(aDetails)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while serializing data.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+func (c tripController) handleChangeTrip(w http.ResponseWriter, r *http.Request) {
+	id, err := getId(r)
+	if err != nil {
+		log.Printf("Invalid trip ID!")
+		http.Error(w, "Bad request! (Invalid trip ID.)", http.StatusBadRequest)
+		return
+	}
+
+	var aTrip aModel.Trip
+
+	decoder := json.NewDecoder(r.Body)
+	err = decoder.Decode(&aTrip)
+	if err != nil {
+		log.Printf("Invalid JSON! ('%s')", err)
+		http.Error(w, "Bad request! (Invalid JSON)", http.StatusBadRequest)
+		return
+	}
+
+	exists, err := c.tRepo.ExistsTrip(id)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while changing trip.)",
+			http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Not found! (Unknown trip ID.)", http.StatusNotFound)
+		return
+	}
+
+	if !c.validateTrip(w, &aTrip) {
+		return
+	}
+
+	aTrip.Id = id
+
+	lTrip := mapper.ToLogicTrip(&aTrip)
+
+	ct, err := c.tRepo.ChangeTrip(lTrip)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while changing trip.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	c.writeTrip(w, id, ct)
+}
+
+func (c tripController) handleDeleteTrip(w http.ResponseWriter, r *http.Request) {
+	id, err := getId(r)
+	if err != nil {
+		log.Printf("Invalid trip ID!")
+		http.Error(w, "Bad request! (Invalid trip ID.)", http.StatusBadRequest)
+		return
+	}
+
+	exists, err := c.tRepo.ExistsTrip(id)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while deleting trip.)",
+			http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Not found! (Unknown trip ID.)", http.StatusNotFound)
+		return
+	}
+
+	err = c.tRepo.DeleteTrip(id)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while deleting trip.)",
+			http.StatusInternalServerError)
+		return
+	}
+}
+
+func (c tripController) handleGetDeletedTripIds(w http.ResponseWriter, r *http.Request) {
+	dt, err := getDeletionTime(r)
+	if err != nil {
+		log.Printf("Invalid deletion time!")
+		http.Error(w, "Bad request! (Invalid deletion time.)", http.StatusBadRequest)
+		return
+	}
+
+	ids, err := c.tRepo.GetDeletedTripIdsByDeletionTime(dt)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading trips.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	json, err := json.Marshal(ids)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while serializing data.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+func (c tripController) validateTrip(w http.ResponseWriter, aTrip *aModel.Trip) bool {
+	if aTrip.Name == "" {
+		log.Printf("Missing trip name!")
+		http.Error(w, "Bad request! (Missing trip name.)", http.StatusBadRequest)
+		return false
+	}
+
+	if !aTrip.StartTime.IsZero() && !aTrip.EndTime.IsZero() &&
+		aTrip.EndTime.Before(aTrip.StartTime) {
+		log.Printf("Invalid trip date range!")
+		http.Error(w, "Bad request! (End time is before start time.)", http.StatusBadRequest)
+		return false
+	}
+
+	for _, locId := range aTrip.LocationIds {
+		exists, err := c.lRepo.ExistsLocation(locId)
+		if err != nil {
+			log.Print(err)
+			http.Error(w, "Internal server error! (Error while reading location.)",
+				http.StatusInternalServerError)
+			return false
+		}
+		if !exists {
+			log.Printf("Unknown trip location ID!")
+			http.Error(w, "Bad request! (Unknown location ID.)", http.StatusBadRequest)
+			return false
+		}
+	}
+
+	if aTrip.CoverId != 0 {
+		lAtt, err := c.aRepo.GetAttachment(aTrip.CoverId)
+		if err != nil {
+			log.Print(err)
+			http.Error(w, "Internal server error! (Error while reading attachment.)",
+				http.StatusInternalServerError)
+			return false
+		}
+		if lAtt == nil {
+			log.Printf("Unknown trip cover ID!")
+			http.Error(w, "Bad request! (Unknown cover attachment ID.)", http.StatusBadRequest)
+			return false
+		}
+	}
+
+	return true
+}
+
+func (c tripController) writeTrip(w http.ResponseWriter, id int64, ct int64) {
+	lTrip, err := c.tRepo.GetTrip(id)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while reading trip.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	aTrip := mapper.ToApiTrip(lTrip)
+	aTrip.ChangeTime = ct
+
+	json, err := json.Marshal(aTrip)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Internal server error! (Error while serializing data.)",
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+// getTripDistance returns the great-circle distance in meters along the (time ordered) locations.
+func getTripDistance(lLocs []*lModel.Location) float64 {
+	dist := 0.0
+	for i := 1; i < len(lLocs); i++ {
+		prev := lLocs[i-1]
+		cur := lLocs[i]
+		dist += util.Distance(prev.Lat, prev.Lng, cur.Lat, cur.Lng)
+	}
+	return dist
+}
+
+// getTripDuration returns the time in seconds between the first location and the latest end of
+// all locations. The end of a location is its end time or, if it has none, its time. (A long visit
+// may end after later locations.)
+func getTripDuration(lLocs []*lModel.Location) int64 {
+	if len(lLocs) == 0 {
+		return 0
+	}
+	var end time.Time
+	for _, lLoc := range lLocs {
+		locEnd := lLoc.Time
+		if !lLoc.EndTime.IsZero() {
+			locEnd = lLoc.EndTime
+		}
+		if locEnd.After(end) {
+			end = locEnd
+		}
+	}
+	return int64(end.Sub(lLocs[0].Time).Seconds())
+}
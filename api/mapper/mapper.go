@@ -1,7 +1,14 @@
 package mapper
 
 import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
 	aModel "kellnhofer.com/tracker/api/model"
+	"kellnhofer.com/tracker/constant"
 	lModel "kellnhofer.com/tracker/model"
 )
 
@@ -14,8 +21,16 @@ func ToApiLocs(iLocs []*lModel.Location) []*aModel.Location {
 }
 
 func ToApiLoc(iLoc *lModel.Location) *aModel.Location {
-	return &aModel.Location{iLoc.Id, iLoc.ChangeTime, iLoc.Name, iLoc.Time, iLoc.Lat, iLoc.Lng,
-		iLoc.Description, ToApiPers(iLoc.Persons)}
+	var endTime *time.Time
+	if !iLoc.EndTime.IsZero() {
+		endTime = &iLoc.EndTime
+	}
+	return &aModel.Location{iLoc.Id, iLoc.ChangeTime, iLoc.Name, iLoc.Time, endTime,
+		int64(iLoc.Duration().Seconds()), iLoc.TimeZone,
+		iLoc.Time.Format(constant.ApiLocalFormat), iLoc.Lat, iLoc.Lng, iLoc.Altitude,
+		iLoc.Accuracy, iLoc.Description, iLoc.PlaceId, iLoc.Country, iLoc.Region, iLoc.City,
+		ToApiPers(iLoc.Persons), ToApiTagNames(iLoc.Tags), ToApiAtts(iLoc.Attachments),
+		ToApiMetas(iLoc.Metadata)}
 }
 
 func ToApiPers(iPers []*lModel.Person) []*aModel.Person {
@@ -27,12 +42,354 @@ func ToApiPers(iPers []*lModel.Person) []*aModel.Person {
 }
 
 func ToApiPer(iPer *lModel.Person) *aModel.Person {
-	return &aModel.Person{iPer.FirstName, iPer.LastName}
+	birthday := ""
+	if !iPer.Birthday.IsZero() {
+		birthday = iPer.Birthday.Format(constant.ApiDayFormat)
+	}
+	groupIds := iPer.GroupIds
+	if groupIds == nil {
+		groupIds = []int64{}
+	}
+	return &aModel.Person{iPer.Id, iPer.ChangeTime, iPer.FirstName, iPer.LastName, iPer.Nickname,
+		iPer.Email, iPer.Phone, birthday, iPer.Notes, iPer.AvatarHash != "", groupIds}
+}
+
+func ToApiPerDups(iDups []*lModel.PersonDuplicates) []*aModel.PersonDuplicates {
+	oDups := []*aModel.PersonDuplicates{}
+	for _, iDup := range iDups {
+		oDups = append(oDups, ToApiPerDup(iDup))
+	}
+	return oDups
+}
+
+func ToApiPerDup(iDup *lModel.PersonDuplicates) *aModel.PersonDuplicates {
+	return &aModel.PersonDuplicates{ToApiPers(iDup.Persons), iDup.Exact}
+}
+
+func ToApiTags(iTags []*lModel.Tag) []*aModel.Tag {
+	oTags := []*aModel.Tag{}
+	for _, iTag := range iTags {
+		oTags = append(oTags, ToApiTag(iTag))
+	}
+	return oTags
+}
+
+func ToApiTag(iTag *lModel.Tag) *aModel.Tag {
+	return &aModel.Tag{iTag.Id, iTag.ChangeTime, iTag.Name}
+}
+
+func ToApiTagNames(iTags []*lModel.Tag) []string {
+	oNames := []string{}
+	for _, iTag := range iTags {
+		oNames = append(oNames, iTag.Name)
+	}
+	return oNames
+}
+
+func ToApiAtts(iAtts []*lModel.Attachment) []*aModel.Attachment {
+	oAtts := []*aModel.Attachment{}
+	for _, iAtt := range iAtts {
+		oAtts = append(oAtts, ToApiAtt(iAtt))
+	}
+	return oAtts
+}
+
+func ToApiAtt(iAtt *lModel.Attachment) *aModel.Attachment {
+	return &aModel.Attachment{iAtt.Id, iAtt.Hash, iAtt.FileName, iAtt.ContentType, iAtt.Size,
+		iAtt.Width, iAtt.Height, iAtt.CreateTime}
+}
+
+func ToApiTrips(iTrips []*lModel.Trip) []*aModel.Trip {
+	oTrips := []*aModel.Trip{}
+	for _, iTrip := range iTrips {
+		oTrips = append(oTrips, ToApiTrip(iTrip))
+	}
+	return oTrips
+}
+
+func ToApiTrip(iTrip *lModel.Trip) *aModel.Trip {
+	locIds := iTrip.LocationIds
+	if locIds == nil {
+		locIds = []int64{}
+	}
+	return &aModel.Trip{iTrip.Id, iTrip.ChangeTime, iTrip.Name, iTrip.StartTime, iTrip.EndTime,
+		iTrip.Description, iTrip.CoverId, locIds}
+}
+
+func ToApiGroups(iGroups []*lModel.Group) []*aModel.Group {
+	oGroups := []*aModel.Group{}
+	for _, iGroup := range iGroups {
+		oGroups = append(oGroups, ToApiGroup(iGroup))
+	}
+	return oGroups
+}
+
+func ToApiGroup(iGroup *lModel.Group) *aModel.Group {
+	perIds := iGroup.PersonIds
+	if perIds == nil {
+		perIds = []int64{}
+	}
+	return &aModel.Group{iGroup.Id, iGroup.ChangeTime, iGroup.Name, iGroup.Description, perIds}
+}
+
+func ToApiMetas(iMetas map[string]*lModel.MetaValue) map[string]*aModel.MetaValue {
+	oMetas := map[string]*aModel.MetaValue{}
+	for key, iMeta := range iMetas {
+		oMetas[key] = &aModel.MetaValue{iMeta.Type, iMeta.Value}
+	}
+	return oMetas
+}
+
+func ToApiMetaFields(iFields []*lModel.MetaField) []*aModel.MetaField {
+	oFields := []*aModel.MetaField{}
+	for _, iField := range iFields {
+		oFields = append(oFields, ToApiMetaField(iField))
+	}
+	return oFields
+}
+
+func ToApiMetaField(iField *lModel.MetaField) *aModel.MetaField {
+	return &aModel.MetaField{iField.Key, iField.Type, iField.Required, iField.Description}
+}
+
+func ToApiTracks(iTracks []*lModel.Track) []*aModel.Track {
+	oTracks := []*aModel.Track{}
+	for _, iTrack := range iTracks {
+		oTracks = append(oTracks, ToApiTrack(iTrack))
+	}
+	return oTracks
+}
+
+func ToApiTrack(iTrack *lModel.Track) *aModel.Track {
+	return &aModel.Track{iTrack.Id, iTrack.ChangeTime, iTrack.Name, iTrack.Description,
+		iTrack.PointCount, iTrack.StartTime, iTrack.EndTime}
+}
+
+func ToApiTrackPoints(iPoints []*lModel.TrackPoint) []*aModel.TrackPoint {
+	oPoints := []*aModel.TrackPoint{}
+	for _, iPoint := range iPoints {
+		oPoints = append(oPoints, ToApiTrackPoint(iPoint))
+	}
+	return oPoints
+}
+
+func ToApiTrackPoint(iPoint *lModel.TrackPoint) *aModel.TrackPoint {
+	return &aModel.TrackPoint{iPoint.Time, iPoint.Lat, iPoint.Lng, iPoint.Altitude,
+		iPoint.Accuracy, iPoint.Speed, iPoint.Bearing}
+}
+
+func ToApiPlaces(iPlaces []*lModel.Place) []*aModel.Place {
+	oPlaces := []*aModel.Place{}
+	for _, iPlace := range iPlaces {
+		oPlaces = append(oPlaces, ToApiPlace(iPlace))
+	}
+	return oPlaces
+}
+
+func ToApiPlace(iPlace *lModel.Place) *aModel.Place {
+	return &aModel.Place{iPlace.Id, iPlace.ChangeTime, iPlace.Name, iPlace.Lat, iPlace.Lng,
+		iPlace.Radius, iPlace.Description, iPlace.VisitCount}
+}
+
+func ToApiPlaceMatches(iMatches []*lModel.PlaceMatch) []*aModel.PlaceMatch {
+	oMatches := []*aModel.PlaceMatch{}
+	for _, iMatch := range iMatches {
+		oMatches = append(oMatches, &aModel.PlaceMatch{ToApiPlace(iMatch.Place),
+			iMatch.Distance})
+	}
+	return oMatches
+}
+
+func ToApiSearchResults(iResults []*lModel.LocationSearchResult) []*aModel.SearchResult {
+	oResults := []*aModel.SearchResult{}
+	for _, iResult := range iResults {
+		oResults = append(oResults, &aModel.SearchResult{ToApiLoc(iResult.Location),
+			iResult.Score, iResult.HighlightedName, iResult.Snippet})
+	}
+	return oResults
+}
+
+func ToApiClusters(iClusters []*lModel.LocationCluster) []*aModel.LocationCluster {
+	oClusters := []*aModel.LocationCluster{}
+	for _, iCluster := range iClusters {
+		oClusters = append(oClusters, &aModel.LocationCluster{iCluster.Geohash, iCluster.Count,
+			iCluster.Lat, iCluster.Lng, iCluster.SampleIds})
+	}
+	return oClusters
+}
+
+func ToApiStats(iStats *lModel.LocationStats) *aModel.Stats {
+	oPeriods := []*aModel.PeriodCount{}
+	for _, iPeriod := range iStats.Periods {
+		oPeriods = append(oPeriods, &aModel.PeriodCount{iPeriod.Period, iPeriod.Count})
+	}
+	oPersons := []*aModel.PersonCount{}
+	for _, iPerson := range iStats.TopPersons {
+		oPersons = append(oPersons, &aModel.PersonCount{ToApiPer(iPerson.Person), iPerson.Count})
+	}
+	return &aModel.Stats{iStats.LocationCount, iStats.PlaceCount, iStats.Distance, oPeriods,
+		oPersons}
+}
+
+func ToApiTimeline(iDays []*lModel.TimelineDay) []*aModel.TimelineDay {
+	oDays := []*aModel.TimelineDay{}
+	for _, iDay := range iDays {
+		oLegs := []*aModel.TimelineLeg{}
+		for _, iLeg := range iDay.Legs {
+			oLegs = append(oLegs, &aModel.TimelineLeg{iLeg.FromId, iLeg.ToId, iLeg.Distance,
+				int64(iLeg.Duration.Seconds()), iLeg.Gap})
+		}
+		oDays = append(oDays, &aModel.TimelineDay{iDay.Date, iDay.Distance,
+			ToApiLocs(iDay.Locations), oLegs})
+	}
+	return oDays
+}
+
+func ToApiMemories(iYears []*lModel.MemoryYear) []*aModel.MemoryYear {
+	oYears := []*aModel.MemoryYear{}
+	for _, iYear := range iYears {
+		oYears = append(oYears, &aModel.MemoryYear{iYear.Year, ToApiLocs(iYear.Locations)})
+	}
+	return oYears
+}
+
+func ToApiCountryVisits(iCountries []*lModel.AreaVisits) []*aModel.CountryVisits {
+	oCountries := []*aModel.CountryVisits{}
+	for _, iCountry := range iCountries {
+		oSubdivisions := []*aModel.AreaVisits{}
+		for _, iSubdivision := range iCountry.Subdivisions {
+			oSubdivisions = append(oSubdivisions, ToApiAreaVisits(iSubdivision))
+		}
+		oCountries = append(oCountries, &aModel.CountryVisits{ToApiAreaVisits(iCountry),
+			oSubdivisions})
+	}
+	return oCountries
+}
+
+func ToApiAreaVisits(iVisits *lModel.AreaVisits) *aModel.AreaVisits {
+	return &aModel.AreaVisits{iVisits.Code, iVisits.Name, iVisits.LocationCount, iVisits.DayCount,
+		iVisits.FirstTime, iVisits.LastTime}
+}
+
+func ToApiPersonCompanions(iComps []*lModel.PersonCompanion) []*aModel.PersonCompanion {
+	oComps := []*aModel.PersonCompanion{}
+	for _, iComp := range iComps {
+		oComps = append(oComps, &aModel.PersonCompanion{ToApiPer(iComp.Person), iComp.Count,
+			iComp.LastLocationId, iComp.LastTime})
+	}
+	return oComps
+}
+
+func ToApiPersonGraph(iGraph *lModel.PersonGraph) *aModel.PersonGraph {
+	oNodes := []*aModel.PersonCount{}
+	for _, iNode := range iGraph.Nodes {
+		oNodes = append(oNodes, &aModel.PersonCount{ToApiPer(iNode.Person), iNode.Count})
+	}
+	oEdges := []*aModel.PersonGraphEdge{}
+	for _, iEdge := range iGraph.Edges {
+		oEdges = append(oEdges, &aModel.PersonGraphEdge{iEdge.SourceId, iEdge.TargetId,
+			iEdge.Weight, iEdge.LastTime})
+	}
+	return &aModel.PersonGraph{oNodes, oEdges}
+}
+
+func ToGraphMLPersonGraph(iGraph *lModel.PersonGraph) *aModel.GraphML {
+	keys := []*aModel.GraphMLKey{
+		{"name", "node", "name", "string"},
+		{"nickname", "node", "nickname", "string"},
+		{"locationCount", "node", "locationCount", "long"},
+		{"weight", "edge", "weight", "long"},
+		{"lastVisit", "edge", "lastVisit", "string"},
+	}
+	oGraph := &aModel.GraphMLGraph{"persons", "undirected", []*aModel.GraphMLNode{},
+		[]*aModel.GraphMLEdge{}}
+	for _, iNode := range iGraph.Nodes {
+		name := strings.TrimSpace(iNode.Person.FirstName + " " + iNode.Person.LastName)
+		data := []*aModel.GraphMLData{
+			{"name", name},
+			{"nickname", iNode.Person.Nickname},
+			{"locationCount", strconv.FormatInt(iNode.Count, 10)},
+		}
+		oGraph.Nodes = append(oGraph.Nodes, &aModel.GraphMLNode{
+			fmt.Sprintf("p%d", iNode.Person.Id), data})
+	}
+	for i, iEdge := range iGraph.Edges {
+		data := []*aModel.GraphMLData{
+			{"weight", strconv.FormatInt(iEdge.Weight, 10)},
+			{"lastVisit", iEdge.LastTime.Format(time.RFC3339)},
+		}
+		oGraph.Edges = append(oGraph.Edges, &aModel.GraphMLEdge{fmt.Sprintf("e%d", i+1),
+			fmt.Sprintf("p%d", iEdge.SourceId), fmt.Sprintf("p%d", iEdge.TargetId), data})
+	}
+	return &aModel.GraphML{xml.Name{}, aModel.GraphMLNamespace, keys, oGraph}
+}
+
+func ToGpxWaypoint(iLoc *lModel.Location) *aModel.GpxWaypoint {
+	oWpt := &aModel.GpxWaypoint{strconv.FormatFloat(iLoc.Lat, 'f', -1, 64),
+		strconv.FormatFloat(iLoc.Lng, 'f', -1, 64), "", iLoc.Time.UTC().Format(time.RFC3339Nano),
+		iLoc.Name, iLoc.Description, nil}
+	if iLoc.Altitude != nil {
+		oWpt.Elevation = strconv.FormatFloat(*iLoc.Altitude, 'f', -1, 64)
+	}
+	if len(iLoc.Persons) > 0 {
+		oPers := []*aModel.GpxPerson{}
+		for _, iPer := range iLoc.Persons {
+			oPers = append(oPers, &aModel.GpxPerson{iPer.FirstName, iPer.LastName})
+		}
+		oWpt.Extensions = &aModel.GpxExtensions{&aModel.GpxPersons{oPers}}
+	}
+	return oWpt
+}
+
+func ToGpxTrack(iTrack *lModel.Track, iPoints []*lModel.TrackPoint) *aModel.GpxTrack {
+	oPoints := []*aModel.GpxWaypoint{}
+	for _, iPoint := range iPoints {
+		oPoint := &aModel.GpxWaypoint{strconv.FormatFloat(iPoint.Lat, 'f', -1, 64),
+			strconv.FormatFloat(iPoint.Lng, 'f', -1, 64), "",
+			iPoint.Time.UTC().Format(time.RFC3339Nano), "", "", nil}
+		if iPoint.Altitude != nil {
+			oPoint.Elevation = strconv.FormatFloat(*iPoint.Altitude, 'f', -1, 64)
+		}
+		oPoints = append(oPoints, oPoint)
+	}
+	return &aModel.GpxTrack{iTrack.Name, iTrack.Description,
+		[]*aModel.GpxTrackSegment{{oPoints}}}
+}
+
+func ToKmlPlacemark(iLoc *lModel.Location, styleUrl string) *aModel.KmlPlacemark {
+	coords := strconv.FormatFloat(iLoc.Lng, 'f', -1, 64) + "," +
+		strconv.FormatFloat(iLoc.Lat, 'f', -1, 64)
+	if iLoc.Altitude != nil {
+		coords += "," + strconv.FormatFloat(*iLoc.Altitude, 'f', -1, 64)
+	}
+	oPm := &aModel.KmlPlacemark{iLoc.Name, iLoc.Description, nil, nil, styleUrl, nil,
+		&aModel.KmlPoint{coords}}
+	if iLoc.EndTime.IsZero() {
+		oPm.TimeStamp = &aModel.KmlTimeStamp{iLoc.Time.Format(time.RFC3339)}
+	} else {
+		oPm.TimeSpan = &aModel.KmlTimeSpan{iLoc.Time.Format(time.RFC3339),
+			iLoc.EndTime.Format(time.RFC3339)}
+	}
+	if len(iLoc.Persons) > 0 {
+		names := []string{}
+		for _, iPer := range iLoc.Persons {
+			names = append(names, strings.TrimSpace(iPer.FirstName+" "+iPer.LastName))
+		}
+		oPm.ExtendedData = &aModel.KmlExtendedData{[]*aModel.KmlData{{"persons", "Persons",
+			strings.Join(names, ", ")}}, nil}
+	}
+	return oPm
 }
 
 func ToLogicLoc(iLoc *aModel.Location) *lModel.Location {
-	return &lModel.Location{iLoc.Id, 0, iLoc.Name, iLoc.Time, iLoc.Lat, iLoc.Lng, iLoc.Description,
-		ToLogicPers(iLoc.Persons)}
+	var endTime time.Time
+	if iLoc.EndTime != nil {
+		endTime = *iLoc.EndTime
+	}
+	return &lModel.Location{iLoc.Id, 0, iLoc.Name, iLoc.Time, endTime, iLoc.TimeZone,
+		iLoc.Lat, iLoc.Lng, iLoc.Altitude, iLoc.Accuracy, iLoc.Description, iLoc.PlaceId,
+		iLoc.Country, iLoc.Region, iLoc.City, ToLogicPers(iLoc.Persons),
+		ToLogicTagNames(iLoc.Tags), nil, ToLogicMetas(iLoc.Metadata)}
 }
 
 func ToLogicPers(iPers []*aModel.Person) []*lModel.Person {
@@ -47,6 +404,85 @@ func ToLogicPers(iPers []*aModel.Person) []*lModel.Person {
 	return oPers
 }
 
+// ToLogicPer converts an API person. The birthday must have been validated before.
 func ToLogicPer(iPer *aModel.Person) *lModel.Person {
-	return &lModel.Person{0, iPer.FirstName, iPer.LastName}
+	var birthday time.Time
+	if iPer.Birthday != "" {
+		birthday, _ = time.Parse(constant.ApiDayFormat, iPer.Birthday)
+	}
+	return &lModel.Person{iPer.Id, 0, iPer.FirstName, iPer.LastName, iPer.Nickname, iPer.Email,
+		iPer.Phone, birthday, iPer.Notes, "", nil}
+}
+
+func ToLogicTag(iTag *aModel.Tag) *lModel.Tag {
+	return &lModel.Tag{iTag.Id, 0, iTag.Name}
+}
+
+func ToLogicTagNames(iNames []string) []*lModel.Tag {
+	if iNames == nil {
+		return nil
+	}
+
+	var oTags []*lModel.Tag
+	for _, iName := range iNames {
+		oTags = append(oTags, &lModel.Tag{0, 0, iName})
+	}
+	return oTags
+}
+
+func ToLogicTrip(iTrip *aModel.Trip) *lModel.Trip {
+	return &lModel.Trip{iTrip.Id, 0, iTrip.Name, iTrip.StartTime, iTrip.EndTime,
+		iTrip.Description, iTrip.CoverId, iTrip.LocationIds}
+}
+
+func ToLogicGroup(iGroup *aModel.Group) *lModel.Group {
+	return &lModel.Group{iGroup.Id, 0, iGroup.Name, iGroup.Description, iGroup.PersonIds}
+}
+
+// ToLogicMetas converts API metadata values. The values must have been validated before.
+func ToLogicMetas(iMetas map[string]*aModel.MetaValue) map[string]*lModel.MetaValue {
+	if iMetas == nil {
+		return nil
+	}
+
+	oMetas := map[string]*lModel.MetaValue{}
+	for key, iMeta := range iMetas {
+		oMetas[key] = ToLogicMeta(iMeta)
+	}
+	return oMetas
+}
+
+func ToLogicMeta(iMeta *aModel.MetaValue) *lModel.MetaValue {
+	value := iMeta.Value
+	if iMeta.Type == constant.MetaTypeDate {
+		value, _ = time.Parse(time.RFC3339, iMeta.Value.(string))
+	}
+	return &lModel.MetaValue{iMeta.Type, value}
+}
+
+func ToLogicMetaField(iField *aModel.MetaField) *lModel.MetaField {
+	return &lModel.MetaField{iField.Key, iField.Type, iField.Required, iField.Description}
+}
+
+func ToLogicTrack(iTrack *aModel.Track) *lModel.Track {
+	return &lModel.Track{iTrack.Id, 0, iTrack.Name, iTrack.Description, 0, time.Time{},
+		time.Time{}}
+}
+
+func ToLogicTrackPoints(iPoints []*aModel.TrackPoint) []*lModel.TrackPoint {
+	var oPoints []*lModel.TrackPoint
+	for _, iPoint := range iPoints {
+		oPoints = append(oPoints, ToLogicTrackPoint(iPoint))
+	}
+	return oPoints
+}
+
+func ToLogicTrackPoint(iPoint *aModel.TrackPoint) *lModel.TrackPoint {
+	return &lModel.TrackPoint{iPoint.Time, iPoint.Lat, iPoint.Lng, iPoint.Altitude,
+		iPoint.Accuracy, iPoint.Speed, iPoint.Bearing}
+}
+
+func ToLogicPlace(iPlace *aModel.Place) *lModel.Place {
+	return &lModel.Place{iPlace.Id, 0, iPlace.Name, iPlace.Lat, iPlace.Lng, iPlace.Radius,
+		iPlace.Description, 0}
 }
@@ -0,0 +1,12 @@
+package model
+
+type Attachment struct {
+	Id          int64  `json:"id"`
+	Hash        string `json:"hash"`
+	FileName    string `json:"fileName"`
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	CreateTime  int64  `json:"createTime"`
+}
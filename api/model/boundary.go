@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+type AreaVisits struct {
+	Code          string    `json:"code"`
+	Name          string    `json:"name"`
+	LocationCount int64     `json:"locationCount"`
+	DayCount      int64     `json:"dayCount"`
+	FirstVisit    time.Time `json:"firstVisit"`
+	LastVisit     time.Time `json:"lastVisit"`
+}
+
+type CountryVisits struct {
+	*AreaVisits
+	Subdivisions []*AreaVisits `json:"subdivisions"`
+}
@@ -0,0 +1,14 @@
+package model
+
+type LocationCluster struct {
+	Geohash   string  `json:"geohash"`
+	Count     int64   `json:"count"`
+	Lat       float64 `json:"lat"`
+	Lng       float64 `json:"lng"`
+	SampleIds []int64 `json:"sampleIds"`
+}
+
+type LocationClusters struct {
+	Clusters  []*LocationCluster `json:"clusters"`
+	Locations []*Location        `json:"locations"`
+}
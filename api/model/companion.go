@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+type PersonCompanion struct {
+	*Person
+	Count          int64     `json:"count"`
+	LastLocationId int64     `json:"lastLocationId"`
+	LastVisit      time.Time `json:"lastVisit"`
+}
+
+type PersonGraph struct {
+	Nodes []*PersonCount     `json:"nodes"`
+	Edges []*PersonGraphEdge `json:"edges"`
+}
+
+type PersonGraphEdge struct {
+	Source    int64     `json:"source"`
+	Target    int64     `json:"target"`
+	Weight    int64     `json:"weight"`
+	LastVisit time.Time `json:"lastVisit"`
+}
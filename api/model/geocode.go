@@ -0,0 +1,5 @@
+package model
+
+type GeocodeResult struct {
+	LocationCount int64 `json:"locationCount"`
+}
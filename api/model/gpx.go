@@ -0,0 +1,59 @@
+package model
+
+import "encoding/xml"
+
+const (
+	GpxNamespace        = "http://www.topografix.com/GPX/1/1"
+	GpxTrackerNamespace = "http://kellnhofer.com/tracker/gpx/1"
+)
+
+// Gpx is a document in the GPS Exchange Format 1.1. (See https://www.topografix.com/gpx.asp.)
+// Numbers and times are kept as strings, so invalid values can be reported per element.
+type Gpx struct {
+	XMLName   xml.Name       `xml:"gpx"`
+	Xmlns     string         `xml:"xmlns,attr"`
+	Version   string         `xml:"version,attr"`
+	Creator   string         `xml:"creator,attr"`
+	Metadata  *GpxMetadata   `xml:"metadata"`
+	Waypoints []*GpxWaypoint `xml:"wpt"`
+	Tracks    []*GpxTrack    `xml:"trk"`
+}
+
+type GpxMetadata struct {
+	Name string `xml:"name,omitempty"`
+	Time string `xml:"time,omitempty"`
+}
+
+// GpxWaypoint is used for waypoints and track points.
+type GpxWaypoint struct {
+	Lat         string         `xml:"lat,attr"`
+	Lng         string         `xml:"lon,attr"`
+	Elevation   string         `xml:"ele,omitempty"`
+	Time        string         `xml:"time,omitempty"`
+	Name        string         `xml:"name,omitempty"`
+	Description string         `xml:"desc,omitempty"`
+	Extensions  *GpxExtensions `xml:"extensions"`
+}
+
+type GpxExtensions struct {
+	Persons *GpxPersons `xml:"http://kellnhofer.com/tracker/gpx/1 persons"`
+}
+
+type GpxPersons struct {
+	Persons []*GpxPerson `xml:"person"`
+}
+
+type GpxPerson struct {
+	FirstName string `xml:"firstName"`
+	LastName  string `xml:"lastName"`
+}
+
+type GpxTrack struct {
+	Name        string             `xml:"name,omitempty"`
+	Description string             `xml:"desc,omitempty"`
+	Segments    []*GpxTrackSegment `xml:"trkseg"`
+}
+
+type GpxTrackSegment struct {
+	Points []*GpxWaypoint `xml:"trkpt"`
+}
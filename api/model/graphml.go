@@ -0,0 +1,44 @@
+package model
+
+import "encoding/xml"
+
+const GraphMLNamespace = "http://graphml.graphdrawing.org/xmlns"
+
+// GraphML is a graph document in the GraphML format. (See http://graphml.graphdrawing.org.)
+type GraphML struct {
+	XMLName xml.Name      `xml:"graphml"`
+	Xmlns   string        `xml:"xmlns,attr"`
+	Keys    []*GraphMLKey `xml:"key"`
+	Graph   *GraphMLGraph `xml:"graph"`
+}
+
+type GraphMLKey struct {
+	Id       string `xml:"id,attr"`
+	For      string `xml:"for,attr"`
+	AttrName string `xml:"attr.name,attr"`
+	AttrType string `xml:"attr.type,attr"`
+}
+
+type GraphMLGraph struct {
+	Id          string         `xml:"id,attr"`
+	EdgeDefault string         `xml:"edgedefault,attr"`
+	Nodes       []*GraphMLNode `xml:"node"`
+	Edges       []*GraphMLEdge `xml:"edge"`
+}
+
+type GraphMLNode struct {
+	Id   string         `xml:"id,attr"`
+	Data []*GraphMLData `xml:"data"`
+}
+
+type GraphMLEdge struct {
+	Id     string         `xml:"id,attr"`
+	Source string         `xml:"source,attr"`
+	Target string         `xml:"target,attr"`
+	Data   []*GraphMLData `xml:"data"`
+}
+
+type GraphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
@@ -0,0 +1,9 @@
+package model
+
+type Group struct {
+	Id          int64   `json:"id"`
+	ChangeTime  int64   `json:"changeTime"`
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	PersonIds   []int64 `json:"personIds"`
+}
@@ -0,0 +1,17 @@
+package model
+
+type ImportResult struct {
+	Imported   int              `json:"imported"`
+	Duplicates int              `json:"duplicates"`
+	Errors     int              `json:"errors"`
+	Elements   []*ImportElement `json:"elements"`
+}
+
+type ImportElement struct {
+	Type   string `json:"type"`
+	Index  int    `json:"index"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Id     int64  `json:"id"`
+	Error  string `json:"error"`
+}
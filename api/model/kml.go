@@ -0,0 +1,75 @@
+package model
+
+import "encoding/xml"
+
+const KmlNamespace = "http://www.opengis.net/kml/2.2"
+
+// Kml is a document in the Keyhole Markup Language 2.2 as used by Google Earth and Google My Maps.
+// (See https://developers.google.com/kml/documentation/kmlreference.)
+type Kml struct {
+	XMLName  xml.Name     `xml:"kml"`
+	Xmlns    string       `xml:"xmlns,attr"`
+	Document *KmlDocument `xml:"Document"`
+}
+
+type KmlDocument struct {
+	Name    string       `xml:"name"`
+	Styles  []*KmlStyle  `xml:"Style"`
+	Folders []*KmlFolder `xml:"Folder"`
+}
+
+type KmlStyle struct {
+	Id        string `xml:"id,attr"`
+	IconColor string `xml:"IconStyle>color"`
+	IconHref  string `xml:"IconStyle>Icon>href"`
+}
+
+type KmlFolder struct {
+	Name       string          `xml:"name"`
+	Placemarks []*KmlPlacemark `xml:"Placemark"`
+}
+
+// KmlPlacemark is a placemark. Numbers and times are kept as strings, so invalid values can be
+// reported per placemark.
+type KmlPlacemark struct {
+	Name         string           `xml:"name,omitempty"`
+	Description  string           `xml:"description,omitempty"`
+	TimeStamp    *KmlTimeStamp    `xml:"TimeStamp"`
+	TimeSpan     *KmlTimeSpan     `xml:"TimeSpan"`
+	StyleUrl     string           `xml:"styleUrl,omitempty"`
+	ExtendedData *KmlExtendedData `xml:"ExtendedData"`
+	Point        *KmlPoint        `xml:"Point"`
+}
+
+type KmlTimeStamp struct {
+	When string `xml:"when"`
+}
+
+type KmlTimeSpan struct {
+	Begin string `xml:"begin,omitempty"`
+	End   string `xml:"end,omitempty"`
+}
+
+type KmlExtendedData struct {
+	Data       []*KmlData       `xml:"Data"`
+	SchemaData []*KmlSchemaData `xml:"SchemaData"`
+}
+
+type KmlData struct {
+	Name        string `xml:"name,attr"`
+	DisplayName string `xml:"displayName,omitempty"`
+	Value       string `xml:"value"`
+}
+
+type KmlSchemaData struct {
+	SimpleData []*KmlSimpleData `xml:"SimpleData"`
+}
+
+type KmlSimpleData struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:",chardata"`
+}
+
+type KmlPoint struct {
+	Coordinates string `xml:"coordinates"`
+}
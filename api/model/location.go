@@ -3,12 +3,25 @@ package model
 import "time"
 
 type Location struct {
-	Id          int64     `json:"id"`
-	ChangeTime  int64     `json:"changeTime"`
-	Name        string    `json:"name"`
-	Time        time.Time `json:"time"`
-	Lat         float32   `json:"lat"`
-	Lng         float32   `json:"lng"`
-	Description string    `json:"description"`
-	Persons     []*Person `json:"persons"`
+	Id          int64                 `json:"id"`
+	ChangeTime  int64                 `json:"changeTime"`
+	Name        string                `json:"name"`
+	Time        time.Time             `json:"time"`
+	EndTime     *time.Time            `json:"endTime,omitempty"`
+	Duration    int64                 `json:"duration"`
+	TimeZone    string                `json:"timeZone"`
+	LocalTime   string                `json:"localTime"`
+	Lat         float64               `json:"lat"`
+	Lng         float64               `json:"lng"`
+	Altitude    *float64              `json:"altitude"`
+	Accuracy    *float64              `json:"accuracy"`
+	Description string                `json:"description"`
+	PlaceId     int64                 `json:"placeId"`
+	Country     string                `json:"country"`
+	Region      string                `json:"region"`
+	City        string                `json:"city"`
+	Persons     []*Person             `json:"persons"`
+	Tags        []string              `json:"tags"`
+	Attachments []*Attachment         `json:"attachments"`
+	Metadata    map[string]*MetaValue `json:"metadata"`
 }
@@ -0,0 +1,13 @@
+package model
+
+type MetaValue struct {
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+type MetaField struct {
+	Key         string `json:"key"`
+	Type        string `json:"type"`
+	Required    bool   `json:"required"`
+	Description string `json:"description"`
+}
@@ -1,6 +1,25 @@
 package model
 
 type Person struct {
-	FirstName string `json:"firstName"`
-	LastName  string `json:"lastName"`
+	Id         int64   `json:"id"`
+	ChangeTime int64   `json:"changeTime"`
+	FirstName  string  `json:"firstName"`
+	LastName   string  `json:"lastName"`
+	Nickname   string  `json:"nickname"`
+	Email      string  `json:"email"`
+	Phone      string  `json:"phone"`
+	Birthday   string  `json:"birthday"`
+	Notes      string  `json:"notes"`
+	HasAvatar  bool    `json:"hasAvatar"`
+	GroupIds   []int64 `json:"groupIds"`
+}
+
+type PersonDuplicates struct {
+	Persons []*Person `json:"persons"`
+	Exact   bool      `json:"exact"`
+}
+
+type PersonMerge struct {
+	TargetId  int64   `json:"targetId"`
+	SourceIds []int64 `json:"sourceIds"`
 }
@@ -0,0 +1,22 @@
+package model
+
+type Place struct {
+	Id          int64   `json:"id"`
+	ChangeTime  int64   `json:"changeTime"`
+	Name        string  `json:"name"`
+	Lat         float64 `json:"lat"`
+	Lng         float64 `json:"lng"`
+	Radius      float64 `json:"radius"`
+	Description string  `json:"description"`
+	VisitCount  int64   `json:"visitCount"`
+}
+
+type PlaceDetails struct {
+	*Place
+	Locations []*Location `json:"locations"`
+}
+
+type PlaceMatch struct {
+	*Place
+	Distance float64 `json:"distance"`
+}
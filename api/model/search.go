@@ -0,0 +1,8 @@
+package model
+
+type SearchResult struct {
+	*Location
+	Score           float64 `json:"score"`
+	HighlightedName string  `json:"highlightedName"`
+	Snippet         string  `json:"snippet"`
+}
@@ -0,0 +1,19 @@
+package model
+
+type Stats struct {
+	LocationCount int64          `json:"locationCount"`
+	PlaceCount    int64          `json:"placeCount"`
+	Distance      float64        `json:"distance"`
+	Periods       []*PeriodCount `json:"periods"`
+	TopPersons    []*PersonCount `json:"topPersons"`
+}
+
+type PeriodCount struct {
+	Period string `json:"period"`
+	Count  int64  `json:"count"`
+}
+
+type PersonCount struct {
+	*Person
+	Count int64 `json:"count"`
+}
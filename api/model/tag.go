@@ -0,0 +1,12 @@
+package model
+
+type Tag struct {
+	Id         int64  `json:"id"`
+	ChangeTime int64  `json:"changeTime"`
+	Name       string `json:"name"`
+}
+
+type TagMerge struct {
+	TargetId  int64   `json:"targetId"`
+	SourceIds []int64 `json:"sourceIds"`
+}
@@ -0,0 +1,21 @@
+package model
+
+type TimelineDay struct {
+	Date      string         `json:"date"`
+	Distance  float64        `json:"distance"`
+	Locations []*Location    `json:"locations"`
+	Legs      []*TimelineLeg `json:"legs"`
+}
+
+type TimelineLeg struct {
+	FromLocationId int64   `json:"fromLocationId"`
+	ToLocationId   int64   `json:"toLocationId"`
+	Distance       float64 `json:"distance"`
+	Duration       int64   `json:"duration"`
+	Gap            bool    `json:"gap"`
+}
+
+type MemoryYear struct {
+	Year      int         `json:"year"`
+	Locations []*Location `json:"locations"`
+}
@@ -0,0 +1,28 @@
+package model
+
+import "time"
+
+type Track struct {
+	Id          int64     `json:"id"`
+	ChangeTime  int64     `json:"changeTime"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	PointCount  int64     `json:"pointCount"`
+	StartTime   time.Time `json:"startTime"`
+	EndTime     time.Time `json:"endTime"`
+}
+
+type TrackPoint struct {
+	Time     time.Time `json:"time"`
+	Lat      float64   `json:"lat"`
+	Lng      float64   `json:"lng"`
+	Altitude *float64  `json:"altitude"`
+	Accuracy *float64  `json:"accuracy"`
+	Speed    *float64  `json:"speed"`
+	Bearing  *float64  `json:"bearing"`
+}
+
+type TrackPointImport struct {
+	Received int `json:"received"`
+	Inserted int `json:"inserted"`
+}
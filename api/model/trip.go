@@ -0,0 +1,21 @@
+package model
+
+import "time"
+
+type Trip struct {
+	Id          int64     `json:"id"`
+	ChangeTime  int64     `json:"changeTime"`
+	Name        string    `json:"name"`
+	StartTime   time.Time `json:"startTime"`
+	EndTime     time.Time `json:"endTime"`
+	Description string    `json:"description"`
+	CoverId     int64     `json:"coverId"`
+	LocationIds []int64   `json:"locationIds"`
+}
+
+type TripDetails struct {
+	*Trip
+	Locations []*Location `json:"locations"`
+	Distance  float64     `json:"distance"`
+	Duration  int64       `json:"duration"`
+}
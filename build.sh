@@ -1,7 +1,7 @@
 rm tracker
 rm tracker-linux.zip
 
-go build
+go build -tags sqlite_fts5
 
 zip tracker-linux.zip tracker
 zip -u tracker-linux.zip config/config.ini
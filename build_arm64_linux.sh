@@ -2,7 +2,7 @@ rm tracker
 rm tracker-arm64-linux.zip
 
 # Needs ARM64 compiler (gcc-aarch64-linux-gnu)
-CC=aarch64-linux-gnu-gcc GOOS=linux GOARCH=arm64 CGO_ENABLED=1 go build
+CC=aarch64-linux-gnu-gcc GOOS=linux GOARCH=arm64 CGO_ENABLED=1 go build -tags sqlite_fts5
 
 zip tracker-arm64-linux.zip tracker
 zip -u tracker-arm64-linux.zip config/config.ini
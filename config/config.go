@@ -7,8 +7,11 @@ import (
 )
 
 type Config struct {
-	Port     int
-	Password string
+	Port            int
+	Password        string
+	AttachmentQuota int64
+	CitiesFile      string
+	RegionsFile     string
 }
 
 func LoadConfig() *Config {
@@ -19,14 +22,26 @@ func LoadConfig() *Config {
 
 	port := getIntValue(cfg, "server", "port")
 	password := getStringValue(cfg, "authentication", "password")
+	attQuota := getOptionalIntValue(cfg, "attachments", "quota", 1024)
+	citiesFile := getOptionalStringValue(cfg, "geocoding", "cities_file", "")
+	regionsFile := getOptionalStringValue(cfg, "geocoding", "regions_file", "")
 
-	return &Config{port, password}
+	return &Config{port, password, int64(attQuota) * 1024 * 1024, citiesFile, regionsFile}
 }
 
 func getStringValue(file *ini.File, secName string, keyName string) string {
 	return getKey(file, secName, keyName).String()
 }
 
+func getOptionalStringValue(file *ini.File, secName string, keyName string,
+	defVal string) string {
+	sec, err := file.GetSection(secName)
+	if err != nil || !sec.HasKey(keyName) {
+		return defVal
+	}
+	return getStringValue(file, secName, keyName)
+}
+
 func getIntValue(file *ini.File, secName string, keyName string) int {
 	val, err := getKey(file, secName, keyName).Int()
 	if err != nil {
@@ -35,6 +50,14 @@ func getIntValue(file *ini.File, secName string, keyName string) int {
 	return val
 }
 
+func getOptionalIntValue(file *ini.File, secName string, keyName string, defVal int) int {
+	sec, err := file.GetSection(secName)
+	if err != nil || !sec.HasKey(keyName) {
+		return defVal
+	}
+	return getIntValue(file, secName, keyName)
+}
+
 func getKey(file *ini.File, secName string, keyName string) *ini.Key {
 	sec, err := file.GetSection(secName)
 	if err != nil {
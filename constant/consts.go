@@ -3,6 +3,50 @@ package constant
 const (
 	AppVersion string = "1.0.0"
 
-	DbDateFormat  string = "2006-01-02 15:04:05"
-	ApiDateFormat string = "2006-01-02T15:04:05Z"
+	DbDateFormat      string = "2006-01-02 15:04:05"
+	DbLocalDateFormat string = "2006-01-02T15:04:05.999999999Z07:00"
+	ApiDateFormat     string = "2006-01-02T15:04:05Z"
+	ApiDayFormat      string = "2006-01-02"
+	ApiLocalFormat    string = "2006-01-02T15:04:05"
+
+	MetaTypeString  string = "string"
+	MetaTypeNumber  string = "number"
+	MetaTypeBoolean string = "boolean"
+	MetaTypeDate    string = "date"
+
+	LocationSortTime       string = "time"
+	LocationSortChangeTime string = "change_time"
+	LocationSortName       string = "name"
+	LocationSortId         string = "id"
+	LocationSortDistance   string = "distance"
+
+	StatsPeriodDay   string = "day"
+	StatsPeriodWeek  string = "week"
+	StatsPeriodMonth string = "month"
+	StatsPeriodYear  string = "year"
+
+	GraphFormatJson    string = "json"
+	GraphFormatGraphML string = "graphml"
+
+	ImportElementWaypoint  string = "waypoint"
+	ImportElementTrack     string = "track"
+	ImportElementPlacemark string = "placemark"
+
+	ImportStatusImported  string = "imported"
+	ImportStatusDuplicate string = "duplicate"
+	ImportStatusError     string = "error"
+
+	ExportFolderYear string = "year"
+	ExportFolderTrip string = "trip"
+
+	LocationFieldName        string = "name"
+	LocationFieldDescription string = "description"
+	LocationFieldEndTime     string = "endTime"
+	LocationFieldTimeZone    string = "timeZone"
+	LocationFieldAltitude    string = "altitude"
+	LocationFieldAccuracy    string = "accuracy"
+	LocationFieldPlace       string = "place"
+	LocationFieldPersons     string = "persons"
+	LocationFieldTags        string = "tags"
+	LocationFieldAttachments string = "attachments"
 )
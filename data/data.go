@@ -8,14 +8,19 @@ import (
 	"log"
 	"os"
 	"strings"
+	"sync"
 	"time"
+	// Embed the time zone database (for systems without one)
+	_ "time/tzdata"
 
 	_ "github.com/mattn/go-sqlite3"
 
 	"kellnhofer.com/tracker/constant"
 )
 
-const curDbVers = 2
+const curDbVers = 19
+
+var timeZones sync.Map
 
 // --- Public methods ---
 
@@ -61,6 +66,41 @@ func FormatTime(timeIn time.Time) string {
 	return timeIn.UTC().Format(constant.DbDateFormat)
 }
 
+// ParseLocalTime parses a time which was stored with its original offset. If a time zone name is
+// given, the time is returned in this time zone.
+func ParseLocalTime(timeIn string, zone string) time.Time {
+	timeOut, err := time.Parse(constant.DbLocalDateFormat, timeIn)
+	if err != nil {
+		return time.Time{}
+	}
+	if zone == "" {
+		return timeOut
+	}
+	loc, err := LoadTimeZone(zone)
+	if err != nil {
+		return timeOut
+	}
+	return timeOut.In(loc)
+}
+
+// FormatLocalTime formats a time with its offset and sub-second precision.
+func FormatLocalTime(timeIn time.Time) string {
+	return timeIn.Format(constant.DbLocalDateFormat)
+}
+
+// LoadTimeZone returns the time zone with the given IANA name. Loaded time zones are cached.
+func LoadTimeZone(name string) (*time.Location, error) {
+	if loc, ok := timeZones.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	timeZones.Store(name, loc)
+	return loc, nil
+}
+
 // --- Private methods ---
 
 func enableDbForeignKeys(db *sql.DB) {
@@ -0,0 +1,13 @@
+package model
+
+type Attachment struct {
+	Id          int64
+	LocationId  int64
+	Hash        string
+	FileName    string
+	ContentType string
+	Size        int64
+	Width       int
+	Height      int
+	CreateTime  int64
+}
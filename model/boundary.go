@@ -0,0 +1,25 @@
+package model
+
+import "time"
+
+// LocationBoundary contains the codes of the country and subdivision of a location. Lat and Lng
+// are the coordinate for which the codes were determined.
+type LocationBoundary struct {
+	LocationId      int64
+	Lat             float64
+	Lng             float64
+	CountryCode     string
+	SubdivisionCode string
+}
+
+// AreaVisits summarizes the locations within a country or subdivision. DayCount is the number of
+// (local) days with locations.
+type AreaVisits struct {
+	Code          string
+	Name          string
+	LocationCount int64
+	DayCount      int64
+	FirstTime     time.Time
+	LastTime      time.Time
+	Subdivisions  []*AreaVisits
+}
@@ -0,0 +1,12 @@
+package model
+
+// City is a populated place of a geographical database (e.g. GeoNames). Country is the ISO
+// 3166-1 alpha-2 code of the country and TimeZone the IANA time zone name.
+type City struct {
+	Name     string
+	Country  string
+	Region   string
+	Lat      float64
+	Lng      float64
+	TimeZone string
+}
@@ -0,0 +1,11 @@
+package model
+
+// LocationCluster is a group of locations within a geohash cell. Lat and Lng are the centroid of
+// the locations and SampleIds contains the IDs of the most recent locations.
+type LocationCluster struct {
+	Geohash   string
+	Count     int64
+	Lat       float64
+	Lng       float64
+	SampleIds []int64
+}
@@ -0,0 +1,27 @@
+package model
+
+import "time"
+
+// PersonCompanion is a person who was at the same locations as another person. Count is the
+// number of shared locations, LastLocationId and LastTime belong to the latest shared location.
+type PersonCompanion struct {
+	Person         *Person
+	Count          int64
+	LastLocationId int64
+	LastTime       time.Time
+}
+
+// PersonGraph is a co-occurrence graph of persons. The nodes are persons with their number of
+// locations. Two persons are connected by an edge if they were at the same locations.
+type PersonGraph struct {
+	Nodes []*PersonCount
+	Edges []*PersonGraphEdge
+}
+
+// PersonGraphEdge connects two persons. The weight is the number of shared locations.
+type PersonGraphEdge struct {
+	SourceId int64
+	TargetId int64
+	Weight   int64
+	LastTime time.Time
+}
@@ -0,0 +1,59 @@
+package model
+
+import "time"
+
+// LocationFilter describes which locations are returned. OverlapFrom and OverlapTo select
+// locations whose visit (time until end time) overlaps this interval. Name, Description and
+// PersonName are matched as substrings and Missing contains fields which must be empty. BBox and
+// Near select locations within an area.
+//
+// All conditions must match, unless MatchAny is set. In this case at least one condition must
+// match. ChangeTime and After are always applied, so that syncing and paging keep working.
+// Sort, Descending, Limit and After control the order and the page of the returned locations.
+type LocationFilter struct {
+	ChangeTime  int64
+	From        time.Time
+	To          time.Time
+	OverlapFrom time.Time
+	OverlapTo   time.Time
+	Tags        []string
+	TripId      int64
+	PlaceId     int64
+	GroupId     int64
+	PersonIds   []int64
+	PersonName  string
+	Name        string
+	Description string
+	Missing     []string
+	Meta        map[string]string
+	BBox        *BoundingBox
+	Near        *Circle
+	MatchAny    bool
+	Sort        string
+	Descending  bool
+	Limit       int
+	After       *LocationCursor
+}
+
+// LocationCursor points to the last location of a page. Value is the sort value of this location
+// and Id its ID (used as tie breaker).
+type LocationCursor struct {
+	Value string
+	Id    int64
+}
+
+// BoundingBox is an area between two latitudes and two longitudes. If MinLng is greater than
+// MaxLng, the box crosses the antimeridian.
+type BoundingBox struct {
+	MinLng float64
+	MinLat float64
+	MaxLng float64
+	MaxLat float64
+}
+
+// Circle is the area within Radius meters (great-circle distance) of a coordinate.
+type Circle struct {
+	Lat    float64
+	Lng    float64
+	Radius float64
+}
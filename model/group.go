@@ -0,0 +1,9 @@
+package model
+
+type Group struct {
+	Id          int64
+	ChangeTime  int64
+	Name        string
+	Description string
+	PersonIds   []int64
+}
@@ -0,0 +1,9 @@
+package model
+
+// HeatmapPoint is a coordinate which contributes to the density of a heatmap. Weight is the number
+// of locations and track points which were aggregated into the point.
+type HeatmapPoint struct {
+	Lat    float64
+	Lng    float64
+	Weight int64
+}
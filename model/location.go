@@ -7,8 +7,27 @@ type Location struct {
 	ChangeTime  int64
 	Name        string
 	Time        time.Time
-	Lat         float32
-	Lng         float32
+	EndTime     time.Time
+	TimeZone    string
+	Lat         float64
+	Lng         float64
+	Altitude    *float64
+	Accuracy    *float64
 	Description string
+	PlaceId     int64
+	Country     string
+	Region      string
+	City        string
 	Persons     []*Person
+	Tags        []*Tag
+	Attachments []*Attachment
+	Metadata    map[string]*MetaValue
+}
+
+// Duration returns the duration of the visit. Locations without end time have no duration.
+func (l *Location) Duration() time.Duration {
+	if l.EndTime.IsZero() {
+		return 0
+	}
+	return l.EndTime.Sub(l.Time)
 }
@@ -0,0 +1,15 @@
+package model
+
+// MetaValue is a typed metadata value. Depending on the type, Value is a string, a float64, a bool
+// or a time.Time.
+type MetaValue struct {
+	Type  string
+	Value interface{}
+}
+
+type MetaField struct {
+	Key         string
+	Type        string
+	Required    bool
+	Description string
+}
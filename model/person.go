@@ -1,7 +1,22 @@
 package model
 
+import "time"
+
 type Person struct {
-	Id        int64
-	FirstName string
-	LastName  string
+	Id         int64
+	ChangeTime int64
+	FirstName  string
+	LastName   string
+	Nickname   string
+	Email      string
+	Phone      string
+	Birthday   time.Time
+	Notes      string
+	AvatarHash string
+	GroupIds   []int64
+}
+
+type PersonDuplicates struct {
+	Persons []*Person
+	Exact   bool
 }
@@ -0,0 +1,17 @@
+package model
+
+type Place struct {
+	Id          int64
+	ChangeTime  int64
+	Name        string
+	Lat         float64
+	Lng         float64
+	Radius      float64
+	Description string
+	VisitCount  int64
+}
+
+type PlaceMatch struct {
+	Place    *Place
+	Distance float64
+}
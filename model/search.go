@@ -0,0 +1,10 @@
+package model
+
+// LocationSearchResult is a location found by a full-text search. HighlightedName and Snippet
+// are HTML: The text is escaped and the matched terms are enclosed in "<b>" tags.
+type LocationSearchResult struct {
+	Location        *Location
+	Score           float64
+	HighlightedName string
+	Snippet         string
+}
@@ -0,0 +1,23 @@
+package model
+
+// LocationStats contains aggregated values of a set of locations. Distance is the great-circle
+// distance (in meters) between consecutive locations.
+type LocationStats struct {
+	LocationCount int64
+	PlaceCount    int64
+	Distance      float64
+	Periods       []*PeriodCount
+	TopPersons    []*PersonCount
+}
+
+// PeriodCount is the number of locations in a period (e.g. "2020-01" for a month).
+type PeriodCount struct {
+	Period string
+	Count  int64
+}
+
+// PersonCount is the number of locations of a person.
+type PersonCount struct {
+	Person *Person
+	Count  int64
+}
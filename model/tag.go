@@ -0,0 +1,7 @@
+package model
+
+type Tag struct {
+	Id         int64
+	ChangeTime int64
+	Name       string
+}
@@ -0,0 +1,28 @@
+package model
+
+import "time"
+
+// TimelineDay contains the locations of a local day in chronological order. Legs connect
+// consecutive locations and Distance is the sum of their distances.
+type TimelineDay struct {
+	Date      string
+	Distance  float64
+	Locations []*Location
+	Legs      []*TimelineLeg
+}
+
+// TimelineLeg is the way between two consecutive locations. Duration is the time between the end
+// of the first and the start of the second location. If it is long, the leg is marked as gap.
+type TimelineLeg struct {
+	FromId   int64
+	ToId     int64
+	Distance float64
+	Duration time.Duration
+	Gap      bool
+}
+
+// MemoryYear contains the locations of a calendar day in an earlier year.
+type MemoryYear struct {
+	Year      int
+	Locations []*Location
+}
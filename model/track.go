@@ -0,0 +1,25 @@
+package model
+
+import "time"
+
+type Track struct {
+	Id          int64
+	ChangeTime  int64
+	Name        string
+	Description string
+	PointCount  int64
+	StartTime   time.Time
+	EndTime     time.Time
+}
+
+// TrackPoint is a single GPS fix. Altitude, Accuracy, Speed and Bearing are optional (nil if
+// unknown).
+type TrackPoint struct {
+	Time     time.Time
+	Lat      float64
+	Lng      float64
+	Altitude *float64
+	Accuracy *float64
+	Speed    *float64
+	Bearing  *float64
+}
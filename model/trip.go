@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+type Trip struct {
+	Id          int64
+	ChangeTime  int64
+	Name        string
+	StartTime   time.Time
+	EndTime     time.Time
+	Description string
+	CoverId     int64
+	LocationIds []int64
+}
@@ -0,0 +1,189 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"kellnhofer.com/tracker/model"
+)
+
+type AttachmentRepo struct {
+	db *sql.DB
+}
+
+func NewAttachmentRepo(db *sql.DB) *AttachmentRepo {
+	return &AttachmentRepo{db}
+}
+
+// --- Public methods ---
+
+func (r AttachmentRepo) GetAttachments(locId int64) ([]*model.Attachment, error) {
+	rows, err := r.db.Query("SELECT id, location_id, hash, file_name, content_type, size, width, "+
+		"height, crt_time FROM attachment WHERE location_id = ? ORDER BY crt_time ASC", locId)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query attachments! (%s)", err)
+		return nil, errors.New(e)
+	}
+	defer rows.Close()
+
+	atts := []*model.Attachment{}
+	for rows.Next() {
+		att, err := scanAttachmentRow(rows)
+		if err != nil {
+			log.Print(err)
+			e := fmt.Sprintf("Failed to query attachments! (%s)", err)
+			return nil, errors.New(e)
+		}
+		atts = append(atts, att)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query attachments! (%s)", err)
+		return nil, errors.New(e)
+	}
+
+	return atts, nil
+}
+
+func (r AttachmentRepo) GetAttachment(id int64) (*model.Attachment, error) {
+	row := r.db.QueryRow("SELECT id, location_id, hash, file_name, content_type, size, width, "+
+		"height, crt_time FROM attachment WHERE id = ?", id)
+
+	att, err := scanAttachmentRow(row)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query attachment! (%s)", err)
+		return nil, errors.New(e)
+	default:
+	}
+
+	return att, nil
+}
+
+// AddAttachment adds an attachment to a location. The change time of the location is updated so
+// clients fetch the new attachment with the next sync.
+func (r AttachmentRepo) AddAttachment(att *model.Attachment) (int64, int64, error) {
+	ct := time.Now().Unix()
+
+	res, err := r.db.Exec("INSERT INTO attachment (location_id, hash, file_name, content_type, "+
+		"size, width, height, crt_time) VALUES (?, ?, ?, ?, ?, ?, ?, ?)", att.LocationId,
+		att.Hash, att.FileName, att.ContentType, att.Size, att.Width, att.Height, ct)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to insert attachment! (%s)", err)
+		return 0, 0, errors.New(e)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to insert attachment! (%s)", err)
+		return 0, 0, errors.New(e)
+	}
+
+	err = r.touchLocation(att.LocationId, ct)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return id, ct, nil
+}
+
+// DeleteAttachment deletes an attachment. The change time of the location is updated.
+func (r AttachmentRepo) DeleteAttachment(att *model.Attachment) error {
+	ct := time.Now().Unix()
+
+	// Touch trips which use the attachment as cover (the cover is removed by the foreign key)
+	_, err := r.db.Exec("UPDATE trip SET chng_time = ? WHERE cover_id = ?", ct, att.Id)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to update attachment trips! (%s)", err)
+		return errors.New(e)
+	}
+
+	_, err = r.db.Exec("DELETE FROM attachment WHERE id = ?", att.Id)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to delete attachment! (%s)", err)
+		return errors.New(e)
+	}
+
+	return r.touchLocation(att.LocationId, ct)
+}
+
+// ExistsAttachmentHash checks whether a stored file is still used by an attachment or a person
+// avatar.
+func (r AttachmentRepo) ExistsAttachmentHash(hash string) (bool, error) {
+	row := r.db.QueryRow("SELECT (SELECT COUNT(*) FROM attachment WHERE hash = ?) + "+
+		"(SELECT COUNT(*) FROM person WHERE avatar_hash = ?)", hash, hash)
+
+	var n int
+	err := row.Scan(&n)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query attachment! (%s)", err)
+		return false, errors.New(e)
+	}
+
+	return n > 0, nil
+}
+
+// GetStorageUsage returns the number of bytes used by stored attachment and avatar files. Files
+// which are used multiple times are only counted once.
+func (r AttachmentRepo) GetStorageUsage() (int64, error) {
+	row := r.db.QueryRow("SELECT COALESCE(SUM(size), 0) FROM " +
+		"(SELECT hash, size FROM attachment UNION " +
+		"SELECT avatar_hash, avatar_size FROM person WHERE avatar_hash != '')")
+
+	var n int64
+	err := row.Scan(&n)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query attachment storage usage! (%s)", err)
+		return 0, errors.New(e)
+	}
+
+	return n, nil
+}
+
+// --- Private methods ---
+
+func (r AttachmentRepo) touchLocation(locId int64, ct int64) error {
+	_, err := r.db.Exec("UPDATE location SET chng_time = ? WHERE id = ?", ct, locId)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to update location! (%s)", err)
+		return errors.New(e)
+	}
+
+	return nil
+}
+
+func scanAttachmentRow(scan Scanner) (*model.Attachment, error) {
+	var id int64
+	var locId int64
+	var hash string
+	var fileName string
+	var contentType string
+	var size int64
+	var width int
+	var height int
+	var crtTime int64
+
+	err := scan.Scan(&id, &locId, &hash, &fileName, &contentType, &size, &width, &height,
+		&crtTime)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.Attachment{id, locId, hash, fileName, contentType, size, width, height,
+		crtTime}, nil
+}
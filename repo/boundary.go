@@ -0,0 +1,217 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"kellnhofer.com/tracker/data"
+	"kellnhofer.com/tracker/model"
+)
+
+// --- Public methods ---
+
+// InvalidateLocationBoundaries removes the cached location boundaries if they were determined with
+// another version of the boundary data.
+func (r LocationRepo) InvalidateLocationBoundaries(version string) error {
+	var cur string
+	row := r.db.QueryRow("SELECT value FROM setting WHERE key = 'boundary_version'")
+	err := row.Scan(&cur)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query boundary version! (%s)", err)
+		return errors.New(e)
+	}
+	if cur == version {
+		return nil
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to invalidate location boundaries! (%s)", err)
+		return errors.New(e)
+	}
+
+	err = r.clearLocationBoundaries(tx, version)
+	if err != nil {
+		tx.Rollback()
+		log.Print(err)
+		e := fmt.Sprintf("Failed to invalidate location boundaries! (%s)", err)
+		return errors.New(e)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to invalidate location boundaries! (%s)", err)
+		return errors.New(e)
+	}
+
+	return nil
+}
+
+// GetStaleLocationBoundaries returns the locations whose boundaries have not been determined yet
+// or whose coordinate has changed since. Only the location ID and the coordinate are set.
+func (r LocationRepo) GetStaleLocationBoundaries() ([]*model.LocationBoundary, error) {
+	rows, err := r.db.Query("SELECT l.id, l.lat, l.lng FROM location l " +
+		"LEFT JOIN location_boundary b ON b.location_id = l.id " +
+		"WHERE b.location_id IS NULL OR b.lat != l.lat OR b.lng != l.lng")
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query location boundaries! (%s)", err)
+		return nil, errors.New(e)
+	}
+	defer rows.Close()
+
+	bs := []*model.LocationBoundary{}
+	for rows.Next() {
+		b := &model.LocationBoundary{}
+		err := rows.Scan(&b.LocationId, &b.Lat, &b.Lng)
+		if err != nil {
+			log.Print(err)
+			e := fmt.Sprintf("Failed to query location boundaries! (%s)", err)
+			return nil, errors.New(e)
+		}
+		bs = append(bs, b)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query location boundaries! (%s)", err)
+		return nil, errors.New(e)
+	}
+
+	return bs, nil
+}
+
+// SaveLocationBoundaries stores the boundaries of locations.
+func (r LocationRepo) SaveLocationBoundaries(bs []*model.LocationBoundary) error {
+	if len(bs) == 0 {
+		return nil
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to save location boundaries! (%s)", err)
+		return errors.New(e)
+	}
+
+	err = r.saveLocationBoundaries(tx, bs)
+	if err != nil {
+		tx.Rollback()
+		log.Print(err)
+		e := fmt.Sprintf("Failed to save location boundaries! (%s)", err)
+		return errors.New(e)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to save location boundaries! (%s)", err)
+		return errors.New(e)
+	}
+
+	return nil
+}
+
+// GetCountryVisits summarizes the locations matching the filter per country and subdivision. The
+// location boundaries must be up to date. Locations outside of any country are not counted.
+// Countries are sorted by their first visit.
+func (r LocationRepo) GetCountryVisits(filter *model.LocationFilter) ([]*model.AreaVisits,
+	error) {
+	conds, args := locationConds(filter)
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	countries, err := r.getAreaVisits("country_code", where, args)
+	if err != nil {
+		return nil, err
+	}
+	subdivisions, err := r.getAreaVisits("subdivision_code", where, args)
+	if err != nil {
+		return nil, err
+	}
+
+	byCode := map[string]*model.AreaVisits{}
+	for _, c := range countries {
+		c.Subdivisions = []*model.AreaVisits{}
+		byCode[c.Code] = c
+	}
+	for _, s := range subdivisions {
+		// Subdivision codes start with the country code (e.g. "DE-BY")
+		if c, ok := byCode[strings.SplitN(s.Code, "-", 2)[0]]; ok {
+			c.Subdivisions = append(c.Subdivisions, s)
+		}
+	}
+
+	return countries, nil
+}
+
+// --- Private methods ---
+
+func (r LocationRepo) clearLocationBoundaries(tx *sql.Tx, version string) error {
+	_, err := tx.Exec("DELETE FROM location_boundary")
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE setting SET value = ? WHERE key = 'boundary_version'", version)
+	return err
+}
+
+func (r LocationRepo) saveLocationBoundaries(tx *sql.Tx, bs []*model.LocationBoundary) error {
+	for _, b := range bs {
+		_, err := tx.Exec("INSERT OR REPLACE INTO location_boundary (location_id, lat, lng, "+
+			"country_code, subdivision_code) VALUES (?, ?, ?, ?, ?)", b.LocationId, b.Lat, b.Lng,
+			b.CountryCode, b.SubdivisionCode)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getAreaVisits groups the locations by a code column of the location boundaries.
+func (r LocationRepo) getAreaVisits(codeCol string, where string,
+	args []interface{}) ([]*model.AreaVisits, error) {
+	rows, err := r.db.Query("SELECT b."+codeCol+", COUNT(*), "+
+		"COUNT(DISTINCT substr(l.local_time, 1, 10)), MIN(l.time), MAX(l.time) "+
+		"FROM location_boundary b INNER JOIN location l ON b.location_id = l.id "+
+		"WHERE b."+codeCol+" != '' AND b.location_id IN (SELECT id FROM location"+where+") "+
+		"GROUP BY b."+codeCol+" ORDER BY MIN(l.time) ASC, b."+codeCol+" ASC", args...)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query country stats! (%s)", err)
+		return nil, errors.New(e)
+	}
+	defer rows.Close()
+
+	vs := []*model.AreaVisits{}
+	for rows.Next() {
+		v := &model.AreaVisits{}
+		var ft string
+		var lt string
+		err := rows.Scan(&v.Code, &v.LocationCount, &v.DayCount, &ft, &lt)
+		if err != nil {
+			log.Print(err)
+			e := fmt.Sprintf("Failed to query country stats! (%s)", err)
+			return nil, errors.New(e)
+		}
+		v.FirstTime = data.ParseTime(ft)
+		v.LastTime = data.ParseTime(lt)
+		vs = append(vs, v)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query country stats! (%s)", err)
+		return nil, errors.New(e)
+	}
+
+	return vs, nil
+}
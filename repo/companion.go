@@ -0,0 +1,168 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"kellnhofer.com/tracker/data"
+	"kellnhofer.com/tracker/model"
+)
+
+// --- Public methods ---
+
+// GetPersonCompanions returns the persons who were at the same locations as a person. Only
+// locations matching the filter are considered. Companions are sorted by the number of shared
+// locations.
+func (r PersonRepo) GetPersonCompanions(id int64, filter *model.LocationFilter,
+	limit int) ([]*model.PersonCompanion, error) {
+	conds, args := locationConds(filter)
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	qArgs := append(append([]interface{}{id}, args...), limit)
+
+	// SQLite takes the bare columns l.id and l.time from the row with MAX(l.time)
+	rows, err := r.db.Query("SELECT "+personColumns+", COUNT(*) AS cnt, l.id, MAX(l.time) "+
+		"FROM location_person a "+
+		"INNER JOIN location_person b ON a.location_id = b.location_id "+
+		"AND a.person_id != b.person_id "+
+		"INNER JOIN person p ON b.person_id = p.id "+
+		"INNER JOIN location l ON a.location_id = l.id "+
+		"WHERE a.person_id = ? AND a.location_id IN (SELECT id FROM location"+where+") "+
+		"GROUP BY p.id ORDER BY cnt DESC, MAX(l.time) DESC LIMIT ?", qArgs...)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query person companions! (%s)", err)
+		return nil, errors.New(e)
+	}
+	defer rows.Close()
+
+	comps := []*model.PersonCompanion{}
+	for rows.Next() {
+		comp := &model.PersonCompanion{}
+		var lt string
+		per, err := scanPersonRow(&suffixScanner{rows, []interface{}{&comp.Count,
+			&comp.LastLocationId, &lt}})
+		if err != nil {
+			log.Print(err)
+			e := fmt.Sprintf("Failed to query person companions! (%s)", err)
+			return nil, errors.New(e)
+		}
+		comp.Person = per
+		comp.LastTime = data.ParseTime(lt)
+		comps = append(comps, comp)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query person companions! (%s)", err)
+		return nil, errors.New(e)
+	}
+
+	return comps, nil
+}
+
+// GetPersonGraph returns the co-occurrence graph of the persons at the locations matching the
+// filter. Edges with fewer shared locations than minWeight are omitted. Persons without edges are
+// still included as nodes.
+func (r PersonRepo) GetPersonGraph(filter *model.LocationFilter,
+	minWeight int) (*model.PersonGraph, error) {
+	conds, args := locationConds(filter)
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	nodes, err := r.getPersonGraphNodes(where, args)
+	if err != nil {
+		return nil, err
+	}
+	edges, err := r.getPersonGraphEdges(where, args, minWeight)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.PersonGraph{nodes, edges}, nil
+}
+
+// --- Private methods ---
+
+func (r PersonRepo) getPersonGraphNodes(where string,
+	args []interface{}) ([]*model.PersonCount, error) {
+	rows, err := r.db.Query("SELECT "+personColumns+", COUNT(*) AS cnt FROM location_person lp "+
+		"INNER JOIN person p ON lp.person_id = p.id "+
+		"WHERE lp.location_id IN (SELECT id FROM location"+where+") "+
+		"GROUP BY p.id ORDER BY p.id ASC", args...)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query person graph! (%s)", err)
+		return nil, errors.New(e)
+	}
+	defer rows.Close()
+
+	nodes := []*model.PersonCount{}
+	for rows.Next() {
+		var cnt int64
+		per, err := scanPersonRow(&suffixScanner{rows, []interface{}{&cnt}})
+		if err != nil {
+			log.Print(err)
+			e := fmt.Sprintf("Failed to query person graph! (%s)", err)
+			return nil, errors.New(e)
+		}
+		nodes = append(nodes, &model.PersonCount{per, cnt})
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query person graph! (%s)", err)
+		return nil, errors.New(e)
+	}
+
+	return nodes, nil
+}
+
+func (r PersonRepo) getPersonGraphEdges(where string, args []interface{},
+	minWeight int) ([]*model.PersonGraphEdge, error) {
+	qArgs := append(append([]interface{}{}, args...), minWeight)
+	// Each pair of persons is counted once (a.person_id < b.person_id)
+	rows, err := r.db.Query("SELECT a.person_id, b.person_id, COUNT(*) AS cnt, MAX(l.time) "+
+		"FROM location_person a "+
+		"INNER JOIN location_person b ON a.location_id = b.location_id "+
+		"AND a.person_id < b.person_id "+
+		"INNER JOIN location l ON a.location_id = l.id "+
+		"WHERE a.location_id IN (SELECT id FROM location"+where+") "+
+		"GROUP BY a.person_id, b.person_id HAVING cnt >= ? "+
+		"ORDER BY cnt DESC, a.person_id ASC, b.person_id ASC", qArgs...)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query person graph! (%s)", err)
+		return nil, errors.New(e)
+	}
+	defer rows.Close()
+
+	edges := []*model.PersonGraphEdge{}
+	for rows.Next() {
+		edge := &model.PersonGraphEdge{}
+		var lt string
+		err := rows.Scan(&edge.SourceId, &edge.TargetId, &edge.Weight, &lt)
+		if err != nil {
+			log.Print(err)
+			e := fmt.Sprintf("Failed to query person graph! (%s)", err)
+			return nil, errors.New(e)
+		}
+		edge.LastTime = data.ParseTime(lt)
+		edges = append(edges, edge)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query person graph! (%s)", err)
+		return nil, errors.New(e)
+	}
+
+	return edges, nil
+}
@@ -0,0 +1,115 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"kellnhofer.com/tracker/data"
+	"kellnhofer.com/tracker/model"
+)
+
+// --- Public methods ---
+
+// GetLocationGeocodes returns the ID, time, end time, time zone, coordinate, country, region and
+// city of the locations. If missingOnly is true, only locations without country or time zone are
+// returned.
+func (r LocationRepo) GetLocationGeocodes(missingOnly bool) ([]*model.Location, error) {
+	q := "SELECT id, time, end_time, time_zone, lat, lng, country, region, city FROM location"
+	if missingOnly {
+		q += " WHERE country = '' OR time_zone = ''"
+	}
+
+	rows, err := r.db.Query(q + " ORDER BY id ASC")
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query locations! (%s)", err)
+		return nil, errors.New(e)
+	}
+	defer rows.Close()
+
+	locs := []*model.Location{}
+	for rows.Next() {
+		loc := &model.Location{}
+		var t string
+		var et string
+		err := rows.Scan(&loc.Id, &t, &et, &loc.TimeZone, &loc.Lat, &loc.Lng, &loc.Country,
+			&loc.Region, &loc.City)
+		if err != nil {
+			log.Print(err)
+			e := fmt.Sprintf("Failed to query locations! (%s)", err)
+			return nil, errors.New(e)
+		}
+		loc.Time = data.ParseTime(t)
+		loc.EndTime = parseOptionalTime(et)
+		locs = append(locs, loc)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query locations! (%s)", err)
+		return nil, errors.New(e)
+	}
+
+	return locs, nil
+}
+
+// ChangeLocationGeocodes updates the country, region, city and time zone of the locations. The
+// local times are converted to the time zone. The change time of the locations is updated too, so
+// that clients fetch them again.
+func (r LocationRepo) ChangeLocationGeocodes(locs []*model.Location) error {
+	if len(locs) == 0 {
+		return nil
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to update location geocodes! (%s)", err)
+		return errors.New(e)
+	}
+
+	err = r.updateGeocodes(tx, locs, time.Now().Unix())
+	if err != nil {
+		tx.Rollback()
+		log.Print(err)
+		e := fmt.Sprintf("Failed to update location geocodes! (%s)", err)
+		return errors.New(e)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to update location geocodes! (%s)", err)
+		return errors.New(e)
+	}
+
+	return nil
+}
+
+// --- Private methods ---
+
+func (r LocationRepo) updateGeocodes(tx *sql.Tx, locs []*model.Location, ct int64) error {
+	for _, loc := range locs {
+		_, err := tx.Exec("UPDATE location SET chng_time = ?, country = ?, region = ?, city = ? "+
+			"WHERE id = ?", ct, loc.Country, loc.Region, loc.City, loc.Id)
+		if err != nil {
+			return err
+		}
+
+		// Without time zone the local times keep their original offset
+		zone, err := data.LoadTimeZone(loc.TimeZone)
+		if loc.TimeZone == "" || err != nil {
+			continue
+		}
+		_, err = tx.Exec("UPDATE location SET time_zone = ?, local_time = ?, end_local_time = ? "+
+			"WHERE id = ?", loc.TimeZone, data.FormatLocalTime(loc.Time.In(zone)),
+			formatOptionalLocalTime(loc.EndTime.In(zone)), loc.Id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,308 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"kellnhofer.com/tracker/model"
+)
+
+type GroupRepo struct {
+	db *sql.DB
+}
+
+func NewGroupRepo(db *sql.DB) *GroupRepo {
+	return &GroupRepo{db}
+}
+
+// --- Public methods ---
+
+func (r GroupRepo) ExistsGroup(id int64) (bool, error) {
+	row := r.db.QueryRow("SELECT COUNT(*) FROM person_group WHERE id = ?", id)
+
+	var n int
+	err := row.Scan(&n)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query group! (%s)", err)
+		return false, errors.New(e)
+	}
+
+	return n > 0, nil
+}
+
+func (r GroupRepo) GetGroupsByChangeTime(ct int64) ([]*model.Group, error) {
+	rows, err := r.db.Query("SELECT id, chng_time, name, desc FROM person_group "+
+		"WHERE chng_time >= ? ORDER BY name ASC", ct)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query groups! (%s)", err)
+		return nil, errors.New(e)
+	}
+	defer rows.Close()
+
+	groups := []*model.Group{}
+	for rows.Next() {
+		group, err := r.scanGroupRow(rows)
+		if err != nil {
+			log.Print(err)
+			e := fmt.Sprintf("Failed to query groups! (%s)", err)
+			return nil, errors.New(e)
+		}
+		groups = append(groups, group)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query groups! (%s)", err)
+		return nil, errors.New(e)
+	}
+
+	for _, group := range groups {
+		perIds, err := r.getGroupPersonIds(group.Id)
+		if err != nil {
+			return nil, err
+		}
+		group.PersonIds = perIds
+	}
+
+	return groups, nil
+}
+
+func (r GroupRepo) GetGroup(id int64) (*model.Group, error) {
+	row := r.db.QueryRow("SELECT id, chng_time, name, desc FROM person_group WHERE id = ?", id)
+
+	group, err := r.scanGroupRow(row)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query group! (%s)", err)
+		return nil, errors.New(e)
+	default:
+	}
+
+	perIds, err := r.getGroupPersonIds(group.Id)
+	if err != nil {
+		return nil, err
+	}
+	group.PersonIds = perIds
+
+	return group, nil
+}
+
+func (r GroupRepo) AddGroup(group *model.Group) (int64, int64, error) {
+	ct := time.Now().Unix()
+
+	res, err := r.db.Exec("INSERT INTO person_group (chng_time, name, desc) VALUES (?, ?, ?)", ct,
+		group.Name, group.Description)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to insert group! (%s)", err)
+		return 0, 0, errors.New(e)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to insert group! (%s)", err)
+		return 0, 0, errors.New(e)
+	}
+
+	err = r.createGroupPersons(id, group.PersonIds, ct)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return id, ct, nil
+}
+
+// ChangeGroup updates a group and its members. Since persons contain their group IDs, the change
+// time of previous and new members (and their locations) is updated too.
+func (r GroupRepo) ChangeGroup(group *model.Group) (int64, error) {
+	ct := time.Now().Unix()
+
+	_, err := r.db.Exec("UPDATE person_group SET chng_time = ?, name = ?, desc = ? WHERE id = ?",
+		ct, group.Name, group.Description, group.Id)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to update group! (%s)", err)
+		return 0, errors.New(e)
+	}
+
+	err = r.deleteGroupPersons(group.Id, ct)
+	if err != nil {
+		return 0, err
+	}
+
+	err = r.createGroupPersons(group.Id, group.PersonIds, ct)
+	if err != nil {
+		return 0, err
+	}
+
+	return ct, nil
+}
+
+func (r GroupRepo) DeleteGroup(id int64) error {
+	dt := time.Now().Unix()
+
+	err := r.deleteGroupPersons(id, dt)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Exec("DELETE FROM person_group WHERE id = ?", id)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to delete group! (%s)", err)
+		return errors.New(e)
+	}
+
+	_, err = r.db.Exec("INSERT INTO deleted_person_group (id, del_time) VALUES (?, ?)", id, dt)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to insert deleted group! (%s)", err)
+		return errors.New(e)
+	}
+
+	return nil
+}
+
+func (r GroupRepo) GetDeletedGroupIdsByDeletionTime(dt int64) ([]int64, error) {
+	rows, err := r.db.Query("SELECT id FROM deleted_person_group WHERE del_time >= ?", dt)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query deleted groups! (%s)", err)
+		return nil, errors.New(e)
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		err := rows.Scan(&id)
+		if err != nil {
+			log.Print(err)
+			e := fmt.Sprintf("Failed to query deleted groups! (%s)", err)
+			return nil, errors.New(e)
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query deleted groups! (%s)", err)
+		return nil, errors.New(e)
+	}
+
+	return ids, nil
+}
+
+// --- Private methods ---
+
+func (r GroupRepo) scanGroupRow(scan Scanner) (*model.Group, error) {
+	var id int64
+	var ct int64
+	var name string
+	var desc string
+
+	err := scan.Scan(&id, &ct, &name, &desc)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.Group{id, ct, name, desc, nil}, nil
+}
+
+func (r GroupRepo) getGroupPersonIds(id int64) ([]int64, error) {
+	rows, err := r.db.Query("SELECT m.person_id FROM person_group_member m "+
+		"INNER JOIN person p ON m.person_id = p.id "+
+		"WHERE m.group_id = ? ORDER BY p.last_name ASC, p.first_name ASC", id)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query group persons! (%s)", err)
+		return nil, errors.New(e)
+	}
+	defer rows.Close()
+
+	perIds := []int64{}
+	for rows.Next() {
+		var perId int64
+		err := rows.Scan(&perId)
+		if err != nil {
+			log.Print(err)
+			e := fmt.Sprintf("Failed to query group persons! (%s)", err)
+			return nil, errors.New(e)
+		}
+		perIds = append(perIds, perId)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query group persons! (%s)", err)
+		return nil, errors.New(e)
+	}
+
+	return perIds, nil
+}
+
+func (r GroupRepo) createGroupPersons(id int64, perIds []int64, ct int64) error {
+	for _, perId := range perIds {
+		_, err := r.db.Exec("INSERT OR IGNORE INTO person_group_member (group_id, person_id) "+
+			"VALUES (?, ?)", id, perId)
+		if err != nil {
+			log.Print(err)
+			e := fmt.Sprintf("Failed to insert group person! (%s)", err)
+			return errors.New(e)
+		}
+
+		_, err = r.db.Exec("UPDATE person SET chng_time = ? WHERE id = ?", ct, perId)
+		if err != nil {
+			log.Print(err)
+			e := fmt.Sprintf("Failed to update group person! (%s)", err)
+			return errors.New(e)
+		}
+
+		_, err = r.db.Exec("UPDATE location SET chng_time = ? WHERE id IN "+
+			"(SELECT location_id FROM location_person WHERE person_id = ?)", ct, perId)
+		if err != nil {
+			log.Print(err)
+			e := fmt.Sprintf("Failed to update group person locations! (%s)", err)
+			return errors.New(e)
+		}
+	}
+
+	return nil
+}
+
+func (r GroupRepo) deleteGroupPersons(id int64, ct int64) error {
+	_, err := r.db.Exec("UPDATE location SET chng_time = ? WHERE id IN "+
+		"(SELECT lp.location_id FROM location_person lp INNER JOIN person_group_member m "+
+		"ON lp.person_id = m.person_id WHERE m.group_id = ?)", ct, id)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to update group person locations! (%s)", err)
+		return errors.New(e)
+	}
+
+	_, err = r.db.Exec("UPDATE person SET chng_time = ? WHERE id IN "+
+		"(SELECT person_id FROM person_group_member WHERE group_id = ?)", ct, id)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to update group persons! (%s)", err)
+		return errors.New(e)
+	}
+
+	_, err = r.db.Exec("DELETE FROM person_group_member WHERE group_id = ?", id)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to delete group persons! (%s)", err)
+		return errors.New(e)
+	}
+
+	return nil
+}
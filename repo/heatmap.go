@@ -0,0 +1,121 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"kellnhofer.com/tracker/model"
+)
+
+type HeatmapRepo struct {
+	db *sql.DB
+}
+
+func NewHeatmapRepo(db *sql.DB) *HeatmapRepo {
+	return &HeatmapRepo{db}
+}
+
+// --- Public methods ---
+
+// GetRevision returns a value which changes whenever locations, their persons or tracks are
+// changed. The revision is incremented by database triggers.
+func (r HeatmapRepo) GetRevision() (string, error) {
+	row := r.db.QueryRow("SELECT value FROM setting WHERE key = 'heatmap_revision'")
+
+	var rev string
+	err := row.Scan(&rev)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query heatmap revision! (%s)", err)
+		return "", errors.New(e)
+	}
+
+	return rev, nil
+}
+
+// GetHeatmapPoints returns the coordinates of the locations matching the filter. If withTracks is
+// set, the track points (within the bounding box and the time range of the filter) are returned
+// too. Since tracks have no persons, they are skipped if the filter contains persons. The
+// coordinates are aggregated into cells of cellSize degrees, so the number of points is limited by
+// the number of cells within the bounding box.
+func (r HeatmapRepo) GetHeatmapPoints(filter *model.LocationFilter, withTracks bool,
+	cellSize float64) ([]*model.HeatmapPoint, error) {
+	conds, args := locationConds(filter)
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	points, err := r.queryPoints(nil, "location", where, args, cellSize)
+	if err != nil {
+		return nil, err
+	}
+
+	if !withTracks || len(filter.PersonIds) > 0 || filter.PersonName != "" {
+		return points, nil
+	}
+
+	conds = nil
+	args = nil
+	if filter.BBox != nil {
+		b := filter.BBox
+		if b.MinLng <= b.MaxLng {
+			conds = append(conds, "lat BETWEEN ? AND ? AND lng BETWEEN ? AND ?")
+		} else {
+			conds = append(conds, "lat BETWEEN ? AND ? AND (lng >= ? OR lng <= ?)")
+		}
+		args = append(args, b.MinLat, b.MaxLat, b.MinLng, b.MaxLng)
+	}
+	if !filter.From.IsZero() {
+		conds = append(conds, "time >= ?")
+		args = append(args, toUnixMillis(filter.From))
+	}
+	if !filter.To.IsZero() {
+		conds = append(conds, "time <= ?")
+		args = append(args, toUnixMillis(filter.To))
+	}
+	where = ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	return r.queryPoints(points, "track_point", where, args, cellSize)
+}
+
+// --- Private methods ---
+
+// queryPoints aggregates the coordinates of a table into cells. The points are the cell centers.
+func (r HeatmapRepo) queryPoints(points []*model.HeatmapPoint, table string, where string,
+	args []interface{}, cellSize float64) ([]*model.HeatmapPoint, error) {
+	cellArgs := []interface{}{cellSize, cellSize, cellSize, cellSize}
+	rows, err := r.db.Query("SELECT ROUND(lat / ?) * ?, ROUND(lng / ?) * ?, COUNT(*) FROM "+
+		table+where+" GROUP BY 1, 2", append(cellArgs, args...)...)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query heatmap points! (%s)", err)
+		return nil, errors.New(e)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var point model.HeatmapPoint
+		err := rows.Scan(&point.Lat, &point.Lng, &point.Weight)
+		if err != nil {
+			log.Print(err)
+			e := fmt.Sprintf("Failed to query heatmap points! (%s)", err)
+			return nil, errors.New(e)
+		}
+		points = append(points, &point)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query heatmap points! (%s)", err)
+		return nil, errors.New(e)
+	}
+
+	return points, nil
+}
@@ -5,12 +5,26 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"strconv"
+	"strings"
 	"time"
 
+	"kellnhofer.com/tracker/constant"
 	"kellnhofer.com/tracker/data"
 	"kellnhofer.com/tracker/model"
+	"kellnhofer.com/tracker/util"
 )
 
+const locationColumns = "id, chng_time, name, local_time, end_local_time, time_zone, lat, lng, " +
+	"alt, acc, desc, place_id, country, region, city"
+
+// duplicateCoordinateTolerance is the maximum difference (in degrees) between the coordinates of
+// duplicate locations.
+const duplicateCoordinateTolerance = 0.00001
+
+// likeReplacer escapes the wildcards of LIKE patterns.
+var likeReplacer = strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_")
+
 type LocationRepo struct {
 	db *sql.DB
 }
@@ -35,21 +49,112 @@ func (r LocationRepo) ExistsLocation(id int64) (bool, error) {
 	return n > 0, nil
 }
 
+// GetLocationIdByTimeAndCoordinate returns the ID of a location at the given time (in seconds)
+// and coordinate (within about a meter). If there is no such location, 0 is returned.
+func (r LocationRepo) GetLocationIdByTimeAndCoordinate(t time.Time, lat float64,
+	lng float64) (int64, error) {
+	row := r.db.QueryRow("SELECT id FROM location WHERE time = ? AND abs(lat - ?) < ? "+
+		"AND abs(lng - ?) < ? ORDER BY id ASC LIMIT 1", data.FormatTime(t), lat,
+		duplicateCoordinateTolerance, lng, duplicateCoordinateTolerance)
+
+	var id int64
+	err := row.Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	} else if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query location ID! (%s)", err)
+		return 0, errors.New(e)
+	}
+
+	return id, nil
+}
+
 func (r LocationRepo) GetLocations() ([]*model.Location, error) {
-	rows, err := r.db.Query("SELECT id, chng_time, name, time, lat, lng, desc FROM location " +
-		"ORDER BY time ASC")
-	return r.getLocationRows(rows, err)
+	return r.GetLocationsByFilter(&model.LocationFilter{})
 }
 
 func (r LocationRepo) GetLocationsByChangeTime(ct int64) ([]*model.Location, error) {
-	rows, err := r.db.Query("SELECT id, chng_time, name, time, lat, lng, desc FROM location "+
-		"WHERE chng_time >= ? ORDER BY time ASC", ct)
+	return r.GetLocationsByFilter(&model.LocationFilter{ChangeTime: ct})
+}
+
+// GetLocationsByFilter returns the locations matching the filter. All filter values are passed
+// as query parameters.
+func (r LocationRepo) GetLocationsByFilter(filter *model.LocationFilter) ([]*model.Location,
+	error) {
+	conds, args := locationConds(filter)
+
+	sortCol := locationSortColumn(filter.Sort)
+	dir := "ASC"
+	op := ">"
+	if filter.Descending {
+		dir = "DESC"
+		op = "<"
+	}
+	if filter.After != nil && filter.Sort != constant.LocationSortDistance {
+		if sortCol == "id" {
+			conds = append(conds, "id "+op+" ?")
+			args = append(args, filter.After.Id)
+		} else {
+			var value interface{} = filter.After.Value
+			if sortCol == "chng_time" {
+				value, _ = strconv.ParseInt(filter.After.Value, 10, 64)
+			}
+			conds = append(conds, "("+sortCol+" "+op+" ? OR ("+sortCol+" = ? AND id "+op+" ?))")
+			args = append(args, value, value, filter.After.Id)
+		}
+	}
+
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+	order := " ORDER BY " + sortCol + " " + dir + ", id " + dir
+	if sortCol == "id" {
+		order = " ORDER BY id " + dir
+	}
+
+	if filter.Near != nil {
+		return r.getNearLocations(filter, where+order, args)
+	}
+
+	q := "SELECT " + locationColumns + " FROM location" + where + order
+	if filter.Limit > 0 {
+		q += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := r.db.Query(q, args...)
 	return r.getLocationRows(rows, err)
 }
 
+// GetLocationPageByFilter returns a page of at most filter.Limit locations. If there are more
+// locations, a cursor for the next page is returned too.
+func (r LocationRepo) GetLocationPageByFilter(filter *model.LocationFilter) ([]*model.Location,
+	*model.LocationCursor, error) {
+	if filter.Limit <= 0 {
+		locs, err := r.GetLocationsByFilter(filter)
+		return locs, nil, err
+	}
+
+	// Query one location more to find out whether there is a next page
+	pageFilter := *filter
+	pageFilter.Limit = filter.Limit + 1
+	locs, err := r.GetLocationsByFilter(&pageFilter)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(locs) <= filter.Limit {
+		return locs, nil, nil
+	}
+
+	locs = locs[:filter.Limit]
+	last := locs[len(locs)-1]
+	return locs, &model.LocationCursor{locationSortValue(filter, last), last.Id}, nil
+}
+
 func (r LocationRepo) GetLocation(id int64) (*model.Location, error) {
-	row := r.db.QueryRow("SELECT id, chng_time, name, time, lat, lng, desc FROM location "+
-		"WHERE id = ?", id)
+	row := r.db.QueryRow("SELECT "+locationColumns+" FROM location WHERE id = ?", id)
 
 	loc, err := r.scanLocationRow(row)
 	switch {
@@ -62,11 +167,10 @@ func (r LocationRepo) GetLocation(id int64) (*model.Location, error) {
 	default:
 	}
 
-	pers, err := r.getLocationPersons(loc.Id)
+	err = r.loadLocationDetails([]*model.Location{loc})
 	if err != nil {
 		return nil, err
 	}
-	loc.Persons = pers
 
 	return loc, nil
 }
@@ -75,12 +179,26 @@ func (r LocationRepo) AddLocation(loc *model.Location) (int64, int64, error) {
 	ct := time.Now().Unix()
 	name := loc.Name
 	t := data.FormatTime(loc.Time)
+	lt := data.FormatLocalTime(loc.Time)
+	et := formatOptionalTime(loc.EndTime)
+	elt := formatOptionalLocalTime(loc.EndTime)
+	tz := loc.TimeZone
 	lat := loc.Lat
 	lng := loc.Lng
+	alt := toNullFloat64(loc.Altitude)
+	acc := toNullFloat64(loc.Accuracy)
 	desc := loc.Description
+	placeId := toNullInt64(loc.PlaceId)
+	country := loc.Country
+	region := loc.Region
+	city := loc.City
 
-	res, err := r.db.Exec("INSERT INTO location (chng_time, name, time, lat, lng, desc) "+
-		"VALUES (?, ?, ?, ?, ?, ?)", ct, name, t, lat, lng, desc)
+	gh := util.Geohash(lat, lng, util.GeohashPrecision)
+
+	res, err := r.db.Exec("INSERT INTO location (chng_time, name, time, local_time, end_time, "+
+		"end_local_time, time_zone, lat, lng, geohash, alt, acc, desc, place_id, country, region, "+
+		"city) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", ct, name, t, lt, et,
+		elt, tz, lat, lng, gh, alt, acc, desc, placeId, country, region, city)
 	if err != nil {
 		log.Print(err)
 		e := fmt.Sprintf("Failed to insert location! (%s)", err)
@@ -99,6 +217,26 @@ func (r LocationRepo) AddLocation(loc *model.Location) (int64, int64, error) {
 		return 0, 0, err
 	}
 
+	err = r.createLocationTags(locId, loc.Tags)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	err = r.createLocationMetas(locId, loc.Metadata)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	err = indexLocations(r.db, "l.id = ?", locId)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	err = indexLocationCoordinate(r.db, locId, lat, lng)
+	if err != nil {
+		return 0, 0, err
+	}
+
 	return locId, ct, nil
 }
 
@@ -107,12 +245,26 @@ func (r LocationRepo) ChangeLocation(loc *model.Location) (int64, error) {
 	ct := time.Now().Unix()
 	name := loc.Name
 	t := data.FormatTime(loc.Time)
+	lt := data.FormatLocalTime(loc.Time)
+	et := formatOptionalTime(loc.EndTime)
+	elt := formatOptionalLocalTime(loc.EndTime)
+	tz := loc.TimeZone
 	lat := loc.Lat
 	lng := loc.Lng
+	alt := toNullFloat64(loc.Altitude)
+	acc := toNullFloat64(loc.Accuracy)
 	desc := loc.Description
+	placeId := toNullInt64(loc.PlaceId)
+	country := loc.Country
+	region := loc.Region
+	city := loc.City
 
-	_, err := r.db.Exec("UPDATE location SET chng_time=?, name=?, time=?, lat=?, lng=?, desc=? "+
-		"WHERE id = ?", ct, name, t, lat, lng, desc, id)
+	gh := util.Geohash(lat, lng, util.GeohashPrecision)
+
+	_, err := r.db.Exec("UPDATE location SET chng_time=?, name=?, time=?, local_time=?, "+
+		"end_time=?, end_local_time=?, time_zone=?, lat=?, lng=?, geohash=?, alt=?, acc=?, "+
+		"desc=?, place_id=?, country=?, region=?, city=? WHERE id = ?", ct, name, t, lt, et, elt,
+		tz, lat, lng, gh, alt, acc, desc, placeId, country, region, city, id)
 	if err != nil {
 		log.Print(err)
 		e := fmt.Sprintf("Failed to update location! (%s)", err)
@@ -129,18 +281,58 @@ func (r LocationRepo) ChangeLocation(loc *model.Location) (int64, error) {
 		return 0, err
 	}
 
+	err = r.deleteLocationTags(id)
+	if err != nil {
+		return 0, err
+	}
+
+	err = r.createLocationTags(id, loc.Tags)
+	if err != nil {
+		return 0, err
+	}
+
+	err = r.deleteLocationMetas(id)
+	if err != nil {
+		return 0, err
+	}
+
+	err = r.createLocationMetas(id, loc.Metadata)
+	if err != nil {
+		return 0, err
+	}
+
+	err = indexLocations(r.db, "l.id = ?", id)
+	if err != nil {
+		return 0, err
+	}
+
+	err = indexLocationCoordinate(r.db, id, lat, lng)
+	if err != nil {
+		return 0, err
+	}
+
 	return ct, nil
 }
 
 func (r LocationRepo) DeleteLocation(id int64) error {
-	_, err := r.db.Exec("DELETE FROM location WHERE id = ?", id)
+	dt := time.Now().Unix()
+
+	// Touch trips which contain this location or use one of its attachments as cover
+	_, err := r.db.Exec("UPDATE trip SET chng_time = ? WHERE id IN "+
+		"(SELECT trip_id FROM trip_location WHERE location_id = ?) OR cover_id IN "+
+		"(SELECT id FROM attachment WHERE location_id = ?)", dt, id, id)
 	if err != nil {
 		log.Print(err)
-		e := fmt.Sprintf("Failed to delete location! (%s)", err)
+		e := fmt.Sprintf("Failed to update location trips! (%s)", err)
 		return errors.New(e)
 	}
 
-	dt := time.Now().Unix()
+	_, err = r.db.Exec("DELETE FROM location WHERE id = ?", id)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to delete location! (%s)", err)
+		return errors.New(e)
+	}
 
 	_, err = r.db.Exec("INSERT INTO deleted_location (id, del_time) VALUES (?, ?)", id, dt)
 	if err != nil {
@@ -149,6 +341,16 @@ func (r LocationRepo) DeleteLocation(id int64) error {
 		return errors.New(e)
 	}
 
+	err = unindexLocation(r.db, id)
+	if err != nil {
+		return err
+	}
+
+	err = unindexLocationCoordinate(r.db, id)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -192,8 +394,8 @@ func (r LocationRepo) GetPersonId(firstName string, lastName string) (int64, err
 }
 
 func (r LocationRepo) CreatePerson(firstName string, lastName string) (int64, error) {
-	res, err := r.db.Exec("INSERT INTO person(first_name, last_name) VALUES(?, ?)", firstName,
-		lastName)
+	res, err := r.db.Exec("INSERT INTO person(chng_time, first_name, last_name) VALUES(?, ?, ?)",
+		time.Now().Unix(), firstName, lastName)
 	if err != nil {
 		log.Print(err)
 		e := fmt.Sprintf("Failed to create person! (%s)", err)
@@ -210,6 +412,28 @@ func (r LocationRepo) CreatePerson(firstName string, lastName string) (int64, er
 	return id, nil
 }
 
+// GetPersonNameByFullName returns the first and last name of the person whose full name ("first
+// last") matches the given name case-insensitively. If there is no such person, empty names are
+// returned.
+func (r LocationRepo) GetPersonNameByFullName(name string) (string, string, error) {
+	row := r.db.QueryRow("SELECT first_name, last_name FROM person "+
+		"WHERE trim(first_name || ' ' || last_name) LIKE ? ESCAPE '\\' ORDER BY id ASC LIMIT 1",
+		likeReplacer.Replace(name))
+
+	var firstName string
+	var lastName string
+	err := row.Scan(&firstName, &lastName)
+	if err == sql.ErrNoRows {
+		return "", "", nil
+	} else if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query person name! (%s)", err)
+		return "", "", errors.New(e)
+	}
+
+	return firstName, lastName, nil
+}
+
 // --- Private methods ---
 
 func (r LocationRepo) getLocationRows(rows *sql.Rows, err error) ([]*model.Location, error) {
@@ -225,12 +449,9 @@ func (r LocationRepo) getLocationRows(rows *sql.Rows, err error) ([]*model.Locat
 		return nil, err
 	}
 
-	for _, loc := range locs {
-		pers, err := r.getLocationPersons(loc.Id)
-		if err != nil {
-			return nil, err
-		}
-		loc.Persons = pers
+	err = r.loadLocationDetails(locs)
+	if err != nil {
+		return nil, err
 	}
 
 	return locs, nil
@@ -261,17 +482,28 @@ func (r LocationRepo) scanLocationRow(scan Scanner) (*model.Location, error) {
 	var id int64
 	var ct int64
 	var name string
-	var t string
-	var lat float32
-	var lng float32
+	var lt string
+	var elt string
+	var tz string
+	var lat float64
+	var lng float64
+	var alt sql.NullFloat64
+	var acc sql.NullFloat64
 	var desc string
+	var placeId sql.NullInt64
+	var country string
+	var region string
+	var city string
 
-	err := scan.Scan(&id, &ct, &name, &t, &lat, &lng, &desc)
+	err := scan.Scan(&id, &ct, &name, &lt, &elt, &tz, &lat, &lng, &alt, &acc, &desc, &placeId,
+		&country, &region, &city)
 	if err != nil {
 		return nil, err
 	}
 
-	return &model.Location{id, ct, name, data.ParseTime(t), lat, lng, desc, nil}, nil
+	return &model.Location{id, ct, name, data.ParseLocalTime(lt, tz),
+		parseOptionalLocalTime(elt, tz), tz, lat, lng, fromNullFloat64(alt), fromNullFloat64(acc),
+		desc, placeId.Int64, country, region, city, nil, nil, nil, nil}, nil
 }
 
 func (r LocationRepo) scanDeletedLocationRows(rows *sql.Rows) ([]int64, error) {
@@ -306,50 +538,183 @@ func (r LocationRepo) scanDeletedLocationRow(scan Scanner) (int64, error) {
 	return id, nil
 }
 
-func (r LocationRepo) getLocationPersons(id int64) ([]*model.Person, error) {
-	rows, err := r.db.Query("SELECT p.id, p.first_name, p.last_name FROM location_person lp "+
+// loadLocationDetails loads the persons, tags, attachments and metadata of the locations. The
+// details are loaded in batches (instead of one query per location).
+func (r LocationRepo) loadLocationDetails(locs []*model.Location) error {
+	byId := map[int64]*model.Location{}
+	for _, loc := range locs {
+		loc.Persons = []*model.Person{}
+		loc.Tags = []*model.Tag{}
+		loc.Attachments = []*model.Attachment{}
+		loc.Metadata = map[string]*model.MetaValue{}
+		byId[loc.Id] = loc
+	}
+
+	for start := 0; start < len(locs); start += maxBatchSize {
+		end := start + maxBatchSize
+		if end > len(locs) {
+			end = len(locs)
+		}
+		ids := make([]int64, 0, end-start)
+		for _, loc := range locs[start:end] {
+			ids = append(ids, loc.Id)
+		}
+
+		err := r.loadLocationPersons(byId, ids)
+		if err != nil {
+			return err
+		}
+		err = r.loadLocationTags(byId, ids)
+		if err != nil {
+			return err
+		}
+		err = r.loadLocationAttachments(byId, ids)
+		if err != nil {
+			return err
+		}
+		err = r.loadLocationMetas(byId, ids)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r LocationRepo) loadLocationPersons(byId map[int64]*model.Location, ids []int64) error {
+	rows, err := r.db.Query("SELECT lp.location_id, "+personColumns+" FROM location_person lp "+
 		"INNER JOIN person p ON lp.person_id = p.id "+
-		"WHERE lp.location_id = ?", id)
+		"WHERE lp.location_id IN ("+placeholders(len(ids))+")", toArgs(ids)...)
 	if err != nil {
 		log.Print(err)
 		e := fmt.Sprintf("Failed to query location persons! (%s)", err)
-		return nil, errors.New(e)
+		return errors.New(e)
 	}
 	defer rows.Close()
 
-	pers, err := r.scanLocationPersonRows(rows)
+	for rows.Next() {
+		var locId int64
+		per, err := scanPersonRow(&prefixScanner{rows, []interface{}{&locId}})
+		if err != nil {
+			log.Print(err)
+			e := fmt.Sprintf("Failed to query location persons! (%s)", err)
+			return errors.New(e)
+		}
+		loc := byId[locId]
+		loc.Persons = append(loc.Persons, per)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query location persons! (%s)", err)
+		return errors.New(e)
+	}
+
+	return nil
+}
+
+func (r LocationRepo) loadLocationTags(byId map[int64]*model.Location, ids []int64) error {
+	rows, err := r.db.Query("SELECT lt.location_id, t.id, t.chng_time, t.name FROM location_tag lt "+
+		"INNER JOIN tag t ON lt.tag_id = t.id "+
+		"WHERE lt.location_id IN ("+placeholders(len(ids))+") ORDER BY t.name ASC",
+		toArgs(ids)...)
 	if err != nil {
-		return nil, err
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query location tags! (%s)", err)
+		return errors.New(e)
 	}
+	defer rows.Close()
 
-	return pers, nil
+	for rows.Next() {
+		var locId int64
+		var tagId int64
+		var ct int64
+		var name string
+
+		err := rows.Scan(&locId, &tagId, &ct, &name)
+		if err != nil {
+			log.Print(err)
+			e := fmt.Sprintf("Failed to query location tags! (%s)", err)
+			return errors.New(e)
+		}
+
+		loc := byId[locId]
+		loc.Tags = append(loc.Tags, &model.Tag{tagId, ct, name})
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query location tags! (%s)", err)
+		return errors.New(e)
+	}
+
+	return nil
 }
 
-func (r LocationRepo) scanLocationPersonRows(rows *sql.Rows) ([]*model.Person, error) {
-	pers := []*model.Person{}
+func (r LocationRepo) loadLocationAttachments(byId map[int64]*model.Location, ids []int64) error {
+	rows, err := r.db.Query("SELECT id, location_id, hash, file_name, content_type, size, width, "+
+		"height, crt_time FROM attachment WHERE location_id IN ("+placeholders(len(ids))+") "+
+		"ORDER BY crt_time ASC", toArgs(ids)...)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query location attachments! (%s)", err)
+		return errors.New(e)
+	}
+	defer rows.Close()
+
 	for rows.Next() {
-		var id int64
-		var firstName string
-		var lastName string
+		att, err := scanAttachmentRow(rows)
+		if err != nil {
+			log.Print(err)
+			e := fmt.Sprintf("Failed to query location attachments! (%s)", err)
+			return errors.New(e)
+		}
+		loc := byId[att.LocationId]
+		loc.Attachments = append(loc.Attachments, att)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query location attachments! (%s)", err)
+		return errors.New(e)
+	}
+
+	return nil
+}
 
-		err := rows.Scan(&id, &firstName, &lastName)
+func (r LocationRepo) loadLocationMetas(byId map[int64]*model.Location, ids []int64) error {
+	rows, err := r.db.Query("SELECT location_id, key, type, value FROM location_meta "+
+		"WHERE location_id IN ("+placeholders(len(ids))+")", toArgs(ids)...)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query location metadata! (%s)", err)
+		return errors.New(e)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var locId int64
+		var key string
+		var typ string
+		var value string
+
+		err := rows.Scan(&locId, &key, &typ, &value)
 		if err != nil {
 			log.Print(err)
-			e := fmt.Sprintf("Failed to query location persons! (%s)", err)
-			return nil, errors.New(e)
+			e := fmt.Sprintf("Failed to query location metadata! (%s)", err)
+			return errors.New(e)
 		}
 
-		per := &model.Person{id, firstName, lastName}
-		pers = append(pers, per)
+		byId[locId].Metadata[key] = &model.MetaValue{typ, parseMetaValue(typ, value)}
 	}
 
 	if err := rows.Err(); err != nil {
 		log.Print(err)
-		e := fmt.Sprintf("Failed to query location persons! (%s)", err)
-		return nil, errors.New(e)
+		e := fmt.Sprintf("Failed to query location metadata! (%s)", err)
+		return errors.New(e)
 	}
 
-	return pers, nil
+	return nil
 }
 
 func (r LocationRepo) createLocationPersons(locId int64, persons []*model.Person) error {
@@ -388,3 +753,291 @@ func (r LocationRepo) deleteLocationPersons(locId int64) error {
 
 	return nil
 }
+
+func (r LocationRepo) createLocationTags(locId int64, tags []*model.Tag) error {
+	for _, tag := range tags {
+		name := util.CleanTagName(tag.Name)
+		if name == "" {
+			continue
+		}
+
+		tagId, err := r.getOrCreateTagId(name)
+		if err != nil {
+			return err
+		}
+
+		_, err = r.db.Exec("INSERT OR IGNORE INTO location_tag (location_id, tag_id) VALUES (?, ?)",
+			locId, tagId)
+		if err != nil {
+			log.Print(err)
+			e := fmt.Sprintf("Failed to insert location tag! (%s)", err)
+			return errors.New(e)
+		}
+	}
+
+	return nil
+}
+
+func (r LocationRepo) deleteLocationTags(locId int64) error {
+	_, err := r.db.Exec("DELETE FROM location_tag WHERE location_id = ?", locId)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to delete location tags! (%s)", err)
+		return errors.New(e)
+	}
+
+	return nil
+}
+
+func (r LocationRepo) getOrCreateTagId(name string) (int64, error) {
+	row := r.db.QueryRow("SELECT id FROM tag WHERE name = ?", name)
+
+	var tagId int64
+	err := row.Scan(&tagId)
+	if err == nil {
+		return tagId, nil
+	} else if err != sql.ErrNoRows {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query tag ID! (%s)", err)
+		return 0, errors.New(e)
+	}
+
+	ct := time.Now().Unix()
+
+	res, err := r.db.Exec("INSERT INTO tag (chng_time, name) VALUES (?, ?)", ct, name)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to create tag! (%s)", err)
+		return 0, errors.New(e)
+	}
+
+	tagId, err = res.LastInsertId()
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to create tag! (%s)", err)
+		return 0, errors.New(e)
+	}
+
+	return tagId, nil
+}
+
+func (r LocationRepo) createLocationMetas(locId int64, metas map[string]*model.MetaValue) error {
+	for key, meta := range metas {
+		_, err := r.db.Exec("INSERT INTO location_meta (location_id, key, type, value) "+
+			"VALUES (?, ?, ?, ?)", locId, key, meta.Type, formatMetaValue(meta))
+		if err != nil {
+			log.Print(err)
+			e := fmt.Sprintf("Failed to insert location metadata! (%s)", err)
+			return errors.New(e)
+		}
+	}
+
+	return nil
+}
+
+func (r LocationRepo) deleteLocationMetas(locId int64) error {
+	_, err := r.db.Exec("DELETE FROM location_meta WHERE location_id = ?", locId)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to delete location metadata! (%s)", err)
+		return errors.New(e)
+	}
+
+	return nil
+}
+
+func formatMetaValue(meta *model.MetaValue) string {
+	switch v := meta.Value.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return data.FormatTime(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func parseMetaValue(typ string, value string) interface{} {
+	switch typ {
+	case constant.MetaTypeNumber:
+		f, _ := strconv.ParseFloat(value, 64)
+		return f
+	case constant.MetaTypeBoolean:
+		return value == "true"
+	case constant.MetaTypeDate:
+		return data.ParseTime(value)
+	default:
+		return value
+	}
+}
+
+func formatOptionalLocalTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return data.FormatLocalTime(t)
+}
+
+func parseOptionalLocalTime(t string, zone string) time.Time {
+	if t == "" {
+		return time.Time{}
+	}
+	return data.ParseLocalTime(t, zone)
+}
+
+// locationConds creates the conditions (and their arguments) of the filter. Sorting and paging
+// are not included. (The distance of filter.Near is only pre-selected.)
+func locationConds(filter *model.LocationFilter) ([]string, []interface{}) {
+	var conds []string
+	var args []interface{}
+
+	if !filter.From.IsZero() {
+		conds = append(conds, "time >= ?")
+		args = append(args, data.FormatTime(filter.From))
+	}
+	if !filter.To.IsZero() {
+		conds = append(conds, "time <= ?")
+		args = append(args, data.FormatTime(filter.To))
+	}
+	if !filter.OverlapFrom.IsZero() {
+		conds = append(conds, "(CASE WHEN end_time = '' THEN time ELSE end_time END) >= ?")
+		args = append(args, data.FormatTime(filter.OverlapFrom))
+	}
+	if !filter.OverlapTo.IsZero() {
+		conds = append(conds, "time <= ?")
+		args = append(args, data.FormatTime(filter.OverlapTo))
+	}
+	if filter.GroupId > 0 {
+		conds = append(conds, "id IN (SELECT lp.location_id FROM location_person lp "+
+			"INNER JOIN person_group_member m ON lp.person_id = m.person_id WHERE m.group_id = ?)")
+		args = append(args, filter.GroupId)
+	}
+	if filter.PlaceId > 0 {
+		conds = append(conds, "place_id = ?")
+		args = append(args, filter.PlaceId)
+	}
+	if filter.TripId > 0 {
+		conds = append(conds, "id IN (SELECT location_id FROM trip_location WHERE trip_id = ?)")
+		args = append(args, filter.TripId)
+	}
+	for _, perId := range filter.PersonIds {
+		conds = append(conds, "id IN (SELECT location_id FROM location_person "+
+			"WHERE person_id = ?)")
+		args = append(args, perId)
+	}
+	if filter.PersonName != "" {
+		conds = append(conds, "id IN (SELECT lp.location_id FROM location_person lp "+
+			"INNER JOIN person p ON lp.person_id = p.id "+
+			"WHERE p.first_name || ' ' || p.last_name LIKE ? ESCAPE '\\' "+
+			"OR p.nickname LIKE ? ESCAPE '\\')")
+		pattern := toLikePattern(filter.PersonName)
+		args = append(args, pattern, pattern)
+	}
+	if filter.Name != "" {
+		conds = append(conds, "name LIKE ? ESCAPE '\\'")
+		args = append(args, toLikePattern(filter.Name))
+	}
+	if filter.Description != "" {
+		conds = append(conds, "desc LIKE ? ESCAPE '\\'")
+		args = append(args, toLikePattern(filter.Description))
+	}
+	for _, field := range filter.Missing {
+		if cond, ok := locationMissingConds[field]; ok {
+			conds = append(conds, cond)
+		}
+	}
+	for key, value := range filter.Meta {
+		// Numbers are compared numerically and dates by prefix (e.g. "2020-01")
+		var num interface{}
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			num = f
+		}
+		conds = append(conds, "id IN (SELECT location_id FROM location_meta WHERE key = ? AND "+
+			"CASE type WHEN 'number' THEN CAST(value AS REAL) = ? "+
+			"WHEN 'boolean' THEN value = lower(?) "+
+			"WHEN 'date' THEN substr(value, 1, length(?)) = replace(?, 'T', ' ') "+
+			"ELSE value = ? END)")
+		args = append(args, key, num, value, value, value, value)
+	}
+	for _, tag := range filter.Tags {
+		conds = append(conds, "id IN (SELECT lt.location_id FROM location_tag lt "+
+			"INNER JOIN tag t ON lt.tag_id = t.id WHERE t.name = ?)")
+		args = append(args, util.CleanTagName(tag))
+	}
+
+	if len(conds) > 1 && filter.MatchAny {
+		conds = []string{"(" + strings.Join(conds, " OR ") + ")"}
+	}
+
+	if filter.ChangeTime > 0 {
+		conds = append(conds, "chng_time >= ?")
+		args = append(args, filter.ChangeTime)
+	}
+	if filter.BBox != nil {
+		b := filter.BBox
+		cond, cArgs := boundingBoxCond(b.MinLat, b.MinLng, b.MaxLat, b.MaxLng)
+		conds = append(conds, cond)
+		args = append(args, cArgs...)
+	}
+	if filter.Near != nil {
+		// Only a pre-selection, the exact distance is checked afterwards
+		minLat, minLng, maxLat, maxLng := util.BoundingBox(filter.Near.Lat, filter.Near.Lng,
+			filter.Near.Radius)
+		cond, cArgs := boundingBoxCond(minLat, minLng, maxLat, maxLng)
+		conds = append(conds, cond)
+		args = append(args, cArgs...)
+	}
+
+	return conds, args
+}
+
+func locationSortColumn(sort string) string {
+	switch sort {
+	case constant.LocationSortChangeTime:
+		return "chng_time"
+	case constant.LocationSortName:
+		return "COALESCE(name, '')"
+	case constant.LocationSortId, constant.LocationSortDistance:
+		return "id"
+	default:
+		return "time"
+	}
+}
+
+func locationSortValue(filter *model.LocationFilter, loc *model.Location) string {
+	switch filter.Sort {
+	case constant.LocationSortDistance:
+		dist := util.Distance(filter.Near.Lat, filter.Near.Lng, loc.Lat, loc.Lng)
+		return strconv.FormatFloat(dist, 'g', -1, 64)
+	case constant.LocationSortChangeTime:
+		return strconv.FormatInt(loc.ChangeTime, 10)
+	case constant.LocationSortName:
+		return loc.Name
+	case constant.LocationSortId:
+		return ""
+	default:
+		return data.FormatTime(loc.Time)
+	}
+}
+
+// locationMissingConds contains the conditions of locations whose field is empty.
+var locationMissingConds = map[string]string{
+	constant.LocationFieldName:        "(name IS NULL OR name = '')",
+	constant.LocationFieldDescription: "desc = ''",
+	constant.LocationFieldEndTime:     "end_time = ''",
+	constant.LocationFieldTimeZone:    "time_zone = ''",
+	constant.LocationFieldAltitude:    "alt IS NULL",
+	constant.LocationFieldAccuracy:    "acc IS NULL",
+	constant.LocationFieldPlace:       "place_id IS NULL",
+	constant.LocationFieldPersons:     "id NOT IN (SELECT location_id FROM location_person)",
+	constant.LocationFieldTags:        "id NOT IN (SELECT location_id FROM location_tag)",
+	constant.LocationFieldAttachments: "id NOT IN (SELECT location_id FROM attachment)",
+}
+
+// toLikePattern creates a LIKE pattern which matches values containing the text. Wildcards in the
+// text are escaped.
+func toLikePattern(text string) string {
+	return "%" + likeReplacer.Replace(text) + "%"
+}
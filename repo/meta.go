@@ -0,0 +1,106 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+
+	"kellnhofer.com/tracker/model"
+)
+
+type MetaRepo struct {
+	db *sql.DB
+}
+
+func NewMetaRepo(db *sql.DB) *MetaRepo {
+	return &MetaRepo{db}
+}
+
+// --- Public methods ---
+
+func (r MetaRepo) GetMetaFields() ([]*model.MetaField, error) {
+	rows, err := r.db.Query("SELECT key, type, required, desc FROM meta_field ORDER BY key ASC")
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query metadata fields! (%s)", err)
+		return nil, errors.New(e)
+	}
+	defer rows.Close()
+
+	fields := []*model.MetaField{}
+	for rows.Next() {
+		field, err := r.scanMetaFieldRow(rows)
+		if err != nil {
+			log.Print(err)
+			e := fmt.Sprintf("Failed to query metadata fields! (%s)", err)
+			return nil, errors.New(e)
+		}
+		fields = append(fields, field)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query metadata fields! (%s)", err)
+		return nil, errors.New(e)
+	}
+
+	return fields, nil
+}
+
+func (r MetaRepo) GetMetaField(key string) (*model.MetaField, error) {
+	row := r.db.QueryRow("SELECT key, type, required, desc FROM meta_field WHERE key = ?", key)
+
+	field, err := r.scanMetaFieldRow(row)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query metadata field! (%s)", err)
+		return nil, errors.New(e)
+	default:
+	}
+
+	return field, nil
+}
+
+// SaveMetaField creates a metadata field schema or replaces an existing one.
+func (r MetaRepo) SaveMetaField(field *model.MetaField) error {
+	_, err := r.db.Exec("INSERT OR REPLACE INTO meta_field (key, type, required, desc) "+
+		"VALUES (?, ?, ?, ?)", field.Key, field.Type, field.Required, field.Description)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to save metadata field! (%s)", err)
+		return errors.New(e)
+	}
+
+	return nil
+}
+
+func (r MetaRepo) DeleteMetaField(key string) error {
+	_, err := r.db.Exec("DELETE FROM meta_field WHERE key = ?", key)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to delete metadata field! (%s)", err)
+		return errors.New(e)
+	}
+
+	return nil
+}
+
+// --- Private methods ---
+
+func (r MetaRepo) scanMetaFieldRow(scan Scanner) (*model.MetaField, error) {
+	var key string
+	var typ string
+	var required bool
+	var desc string
+
+	err := scan.Scan(&key, &typ, &required, &desc)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.MetaField{key, typ, required, desc}, nil
+}
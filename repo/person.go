@@ -0,0 +1,480 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"kellnhofer.com/tracker/constant"
+	"kellnhofer.com/tracker/model"
+	"kellnhofer.com/tracker/util"
+)
+
+const personColumns = "p.id, p.chng_time, p.first_name, p.last_name, p.nickname, p.email, " +
+	"p.phone, p.birthday, p.notes, p.avatar_hash, " +
+	"(SELECT group_concat(m.group_id) FROM person_group_member m WHERE m.person_id = p.id)"
+
+// minSimilarNameLength is the minimum length (in runes) of names which may differ by typos.
+const minSimilarNameLength = 5
+
+type PersonRepo struct {
+	db *sql.DB
+}
+
+func NewPersonRepo(db *sql.DB) *PersonRepo {
+	return &PersonRepo{db}
+}
+
+// --- Public methods ---
+
+func (r PersonRepo) ExistsPerson(id int64) (bool, error) {
+	row := r.db.QueryRow("SELECT COUNT(*) FROM person WHERE id = ?", id)
+
+	var n int
+	err := row.Scan(&n)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query person! (%s)", err)
+		return false, errors.New(e)
+	}
+
+	return n > 0, nil
+}
+
+func (r PersonRepo) GetPersons() ([]*model.Person, error) {
+	return r.GetPersonsByChangeTime(0)
+}
+
+func (r PersonRepo) GetPersonsByChangeTime(ct int64) ([]*model.Person, error) {
+	rows, err := r.db.Query("SELECT "+personColumns+" FROM person p WHERE p.chng_time >= ? "+
+		"ORDER BY p.last_name ASC, p.first_name ASC", ct)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query persons! (%s)", err)
+		return nil, errors.New(e)
+	}
+	defer rows.Close()
+
+	return r.scanPersonRows(rows)
+}
+
+func (r PersonRepo) GetPerson(id int64) (*model.Person, error) {
+	row := r.db.QueryRow("SELECT "+personColumns+" FROM person p WHERE p.id = ?", id)
+
+	per, err := scanPersonRow(row)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query person! (%s)", err)
+		return nil, errors.New(e)
+	default:
+	}
+
+	return per, nil
+}
+
+// GetPersonIdByName returns the ID of the person with the given name (case-insensitive) or 0 if
+// there is no such person.
+func (r PersonRepo) GetPersonIdByName(firstName string, lastName string) (int64, error) {
+	row := r.db.QueryRow("SELECT id FROM person WHERE first_name LIKE ? AND last_name LIKE ?",
+		firstName, lastName)
+
+	var id int64
+	err := row.Scan(&id)
+	switch {
+	case err == sql.ErrNoRows:
+		return 0, nil
+	case err != nil:
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query person ID! (%s)", err)
+		return 0, errors.New(e)
+	default:
+	}
+
+	return id, nil
+}
+
+func (r PersonRepo) AddPerson(per *model.Person) (int64, int64, error) {
+	ct := time.Now().Unix()
+
+	res, err := r.db.Exec("INSERT INTO person (chng_time, first_name, last_name, nickname, email, "+
+		"phone, birthday, notes) VALUES (?, ?, ?, ?, ?, ?, ?, ?)", ct, per.FirstName,
+		per.LastName, per.Nickname, per.Email, per.Phone, formatBirthday(per.Birthday), per.Notes)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to insert person! (%s)", err)
+		return 0, 0, errors.New(e)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to insert person! (%s)", err)
+		return 0, 0, errors.New(e)
+	}
+
+	return id, ct, nil
+}
+
+// ChangePerson updates the profile of a person. Since locations contain their persons, the change
+// time of the locations of the person is updated too.
+func (r PersonRepo) ChangePerson(per *model.Person) (int64, error) {
+	ct := time.Now().Unix()
+
+	_, err := r.db.Exec("UPDATE person SET chng_time = ?, first_name = ?, last_name = ?, "+
+		"nickname = ?, email = ?, phone = ?, birthday = ?, notes = ? WHERE id = ?", ct,
+		per.FirstName, per.LastName, per.Nickname, per.Email, per.Phone,
+		formatBirthday(per.Birthday), per.Notes, per.Id)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to update person! (%s)", err)
+		return 0, errors.New(e)
+	}
+
+	err = r.touchPersonLocations(per.Id, ct)
+	if err != nil {
+		return 0, err
+	}
+
+	err = indexLocations(r.db, "l.id IN (SELECT location_id FROM location_person "+
+		"WHERE person_id = ?)", per.Id)
+	if err != nil {
+		return 0, err
+	}
+
+	return ct, nil
+}
+
+// ChangePersonAvatar sets the avatar file hash and size of a person. An empty hash removes the
+// avatar.
+func (r PersonRepo) ChangePersonAvatar(id int64, hash string, size int64) (int64, error) {
+	ct := time.Now().Unix()
+
+	_, err := r.db.Exec("UPDATE person SET chng_time = ?, avatar_hash = ?, avatar_size = ? "+
+		"WHERE id = ?", ct, hash, size, id)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to update person avatar! (%s)", err)
+		return 0, errors.New(e)
+	}
+
+	err = r.touchPersonLocations(id, ct)
+	if err != nil {
+		return 0, err
+	}
+
+	return ct, nil
+}
+
+// GetDuplicatePersons returns groups of persons whose names are equal after normalization or
+// whose first and last names differ only by a few typos.
+func (r PersonRepo) GetDuplicatePersons() ([]*model.PersonDuplicates, error) {
+	pers, err := r.GetPersons()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(pers))
+	firstNames := make([]string, len(pers))
+	lastNames := make([]string, len(pers))
+	for i, per := range pers {
+		names[i] = util.NormalizeName(per.FirstName + " " + per.LastName)
+		firstNames[i] = util.NormalizeName(per.FirstName)
+		lastNames[i] = util.NormalizeName(per.LastName)
+	}
+
+	// Link similar persons (union-find)
+	parents := make([]int, len(pers))
+	for i := range parents {
+		parents[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parents[i] != i {
+			parents[i] = find(parents[i])
+		}
+		return parents[i]
+	}
+	for i := 0; i < len(pers); i++ {
+		for j := i + 1; j < len(pers); j++ {
+			if names[i] == names[j] || (isSimilarName(firstNames[i], firstNames[j]) &&
+				isSimilarName(lastNames[i], lastNames[j])) {
+				parents[find(j)] = find(i)
+			}
+		}
+	}
+
+	// Collect groups with more than one person
+	groups := map[int]*model.PersonDuplicates{}
+	var roots []int
+	for i, per := range pers {
+		root := find(i)
+		group, ok := groups[root]
+		if !ok {
+			group = &model.PersonDuplicates{[]*model.Person{}, true}
+			groups[root] = group
+			roots = append(roots, root)
+		}
+		group.Persons = append(group.Persons, per)
+		if names[i] != names[root] {
+			group.Exact = false
+		}
+	}
+
+	dups := []*model.PersonDuplicates{}
+	for _, root := range roots {
+		if len(groups[root].Persons) > 1 {
+			dups = append(dups, groups[root])
+		}
+	}
+
+	return dups, nil
+}
+
+// MergePersons re-points all locations of the source persons to the target person and deletes the
+// source persons. The change time of affected locations is updated and the IDs of the source
+// persons are recorded as deleted. Source IDs may be repeated, but must not contain the target ID.
+func (r PersonRepo) MergePersons(targetId int64, sourceIds []int64) error {
+	var ids []int64
+	seen := map[int64]bool{targetId: true}
+	for _, id := range sourceIds {
+		if id == targetId {
+			e := fmt.Sprintf("Failed to merge persons! (Target person %d is also a source "+
+				"person.)", targetId)
+			log.Print(e)
+			return errors.New(e)
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to merge persons! (%s)", err)
+		return errors.New(e)
+	}
+
+	err = r.mergePersons(tx, targetId, ids)
+	if err != nil {
+		tx.Rollback()
+		log.Print(err)
+		e := fmt.Sprintf("Failed to merge persons! (%s)", err)
+		return errors.New(e)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to merge persons! (%s)", err)
+		return errors.New(e)
+	}
+
+	return nil
+}
+
+func (r PersonRepo) GetDeletedPersonIdsByDeletionTime(dt int64) ([]int64, error) {
+	rows, err := r.db.Query("SELECT id FROM deleted_person WHERE del_time >= ?", dt)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query deleted persons! (%s)", err)
+		return nil, errors.New(e)
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		err := rows.Scan(&id)
+		if err != nil {
+			log.Print(err)
+			e := fmt.Sprintf("Failed to query deleted persons! (%s)", err)
+			return nil, errors.New(e)
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query deleted persons! (%s)", err)
+		return nil, errors.New(e)
+	}
+
+	return ids, nil
+}
+
+// --- Private methods ---
+
+func (r PersonRepo) mergePersons(tx *sql.Tx, targetId int64, sourceIds []int64) error {
+	t := time.Now().Unix()
+
+	for _, sourceId := range sourceIds {
+		// Touch affected locations
+		_, err := tx.Exec("UPDATE location SET chng_time = ? WHERE id IN "+
+			"(SELECT location_id FROM location_person WHERE person_id = ?)", t, sourceId)
+		if err != nil {
+			return err
+		}
+
+		// Re-point location persons (a location may already reference the target person)
+		_, err = tx.Exec("INSERT OR IGNORE INTO location_person (location_id, person_id) "+
+			"SELECT location_id, ? FROM location_person WHERE person_id = ?", targetId, sourceId)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("DELETE FROM location_person WHERE person_id = ?", sourceId)
+		if err != nil {
+			return err
+		}
+
+		// Move group memberships
+		_, err = tx.Exec("UPDATE person_group SET chng_time = ? WHERE id IN "+
+			"(SELECT group_id FROM person_group_member WHERE person_id = ?)", t, sourceId)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("INSERT OR IGNORE INTO person_group_member (group_id, person_id) "+
+			"SELECT group_id, ? FROM person_group_member WHERE person_id = ?", targetId,
+			sourceId)
+		if err != nil {
+			return err
+		}
+
+		// Delete merged person
+		_, err = tx.Exec("DELETE FROM person WHERE id = ?", sourceId)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("INSERT INTO deleted_person (id, del_time) VALUES (?, ?)", sourceId, t)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Touch target person (its group memberships may have changed)
+	_, err := tx.Exec("UPDATE person SET chng_time = ? WHERE id = ?", t, targetId)
+	if err != nil {
+		return err
+	}
+
+	// Update search index of affected locations (they contain the target person now)
+	return indexLocations(tx, "l.id IN (SELECT location_id FROM location_person "+
+		"WHERE person_id = ?)", targetId)
+}
+
+func (r PersonRepo) touchPersonLocations(id int64, ct int64) error {
+	_, err := r.db.Exec("UPDATE location SET chng_time = ? WHERE id IN "+
+		"(SELECT location_id FROM location_person WHERE person_id = ?)", ct, id)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to update person locations! (%s)", err)
+		return errors.New(e)
+	}
+
+	return nil
+}
+
+func (r PersonRepo) scanPersonRows(rows *sql.Rows) ([]*model.Person, error) {
+	pers := []*model.Person{}
+	for rows.Next() {
+		per, err := scanPersonRow(rows)
+		if err != nil {
+			log.Print(err)
+			e := fmt.Sprintf("Failed to query persons! (%s)", err)
+			return nil, errors.New(e)
+		}
+		pers = append(pers, per)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query persons! (%s)", err)
+		return nil, errors.New(e)
+	}
+
+	return pers, nil
+}
+
+func scanPersonRow(scan Scanner) (*model.Person, error) {
+	var id int64
+	var ct int64
+	var firstName string
+	var lastName string
+	var nickname string
+	var email string
+	var phone string
+	var birthday string
+	var notes string
+	var avatarHash string
+	var groupIds sql.NullString
+
+	err := scan.Scan(&id, &ct, &firstName, &lastName, &nickname, &email, &phone, &birthday,
+		&notes, &avatarHash, &groupIds)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.Person{id, ct, firstName, lastName, nickname, email, phone,
+		parseBirthday(birthday), notes, avatarHash, parseIdList(groupIds.String)}, nil
+}
+
+func formatBirthday(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(constant.ApiDayFormat)
+}
+
+func parseBirthday(t string) time.Time {
+	if t == "" {
+		return time.Time{}
+	}
+	birthday, err := time.Parse(constant.ApiDayFormat, t)
+	if err != nil {
+		return time.Time{}
+	}
+	return birthday
+}
+
+// parseIdList parses a comma separated list of IDs (as returned by group_concat).
+func parseIdList(s string) []int64 {
+	ids := []int64{}
+	if s == "" {
+		return ids
+	}
+	for _, v := range strings.Split(s, ",") {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// isSimilarName checks if two normalized names are equal or differ only by a few typos. Short
+// names must be equal (e.g. "tim" and "tom" are different names).
+func isSimilarName(a string, b string) bool {
+	if a == b {
+		return true
+	}
+
+	n := len([]rune(a))
+	if n < minSimilarNameLength {
+		return false
+	}
+
+	// Allow one typo per 8 characters
+	maxDist := n / 8
+	if maxDist < 1 {
+		maxDist = 1
+	}
+	return util.LevenshteinDistance(a, b) <= maxDist
+}
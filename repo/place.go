@@ -0,0 +1,248 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"kellnhofer.com/tracker/model"
+	"kellnhofer.com/tracker/util"
+)
+
+const placeColumns = "p.id, p.chng_time, p.name, p.lat, p.lng, p.radius, p.desc, " +
+	"(SELECT COUNT(*) FROM location l WHERE l.place_id = p.id)"
+
+type PlaceRepo struct {
+	db *sql.DB
+}
+
+func NewPlaceRepo(db *sql.DB) *PlaceRepo {
+	return &PlaceRepo{db}
+}
+
+// --- Public methods ---
+
+func (r PlaceRepo) ExistsPlace(id int64) (bool, error) {
+	row := r.db.QueryRow("SELECT COUNT(*) FROM place WHERE id = ?", id)
+
+	var n int
+	err := row.Scan(&n)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query place! (%s)", err)
+		return false, errors.New(e)
+	}
+
+	return n > 0, nil
+}
+
+func (r PlaceRepo) GetPlacesByChangeTime(ct int64) ([]*model.Place, error) {
+	rows, err := r.db.Query("SELECT "+placeColumns+" FROM place p WHERE p.chng_time >= ? "+
+		"ORDER BY p.name ASC", ct)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query places! (%s)", err)
+		return nil, errors.New(e)
+	}
+	defer rows.Close()
+
+	places := []*model.Place{}
+	for rows.Next() {
+		place, err := r.scanPlaceRow(rows)
+		if err != nil {
+			log.Print(err)
+			e := fmt.Sprintf("Failed to query places! (%s)", err)
+			return nil, errors.New(e)
+		}
+		places = append(places, place)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query places! (%s)", err)
+		return nil, errors.New(e)
+	}
+
+	return places, nil
+}
+
+func (r PlaceRepo) GetPlace(id int64) (*model.Place, error) {
+	row := r.db.QueryRow("SELECT "+placeColumns+" FROM place p WHERE p.id = ?", id)
+
+	place, err := r.scanPlaceRow(row)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query place! (%s)", err)
+		return nil, errors.New(e)
+	default:
+	}
+
+	return place, nil
+}
+
+// GetMatchingPlaces returns all places whose radius contains the coordinate. The places are
+// ordered by distance (nearest first).
+func (r PlaceRepo) GetMatchingPlaces(lat float64, lng float64) ([]*model.PlaceMatch, error) {
+	places, err := r.GetPlacesByChangeTime(0)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := []*model.PlaceMatch{}
+	for _, place := range places {
+		dist := util.Distance(lat, lng, place.Lat, place.Lng)
+		if dist <= place.Radius {
+			matches = append(matches, &model.PlaceMatch{place, dist})
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].Distance < matches[j].Distance
+	})
+
+	return matches, nil
+}
+
+func (r PlaceRepo) AddPlace(place *model.Place) (int64, int64, error) {
+	ct := time.Now().Unix()
+
+	res, err := r.db.Exec("INSERT INTO place (chng_time, name, lat, lng, radius, desc) "+
+		"VALUES (?, ?, ?, ?, ?, ?)", ct, place.Name, place.Lat, place.Lng, place.Radius,
+		place.Description)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to insert place! (%s)", err)
+		return 0, 0, errors.New(e)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to insert place! (%s)", err)
+		return 0, 0, errors.New(e)
+	}
+
+	return id, ct, nil
+}
+
+// ChangePlace updates a place. If the place is renamed, linked locations which still carry the old
+// place name (or no name) are renamed too and their change time is updated.
+func (r PlaceRepo) ChangePlace(place *model.Place) (int64, error) {
+	ct := time.Now().Unix()
+
+	old, err := r.GetPlace(place.Id)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = r.db.Exec("UPDATE place SET chng_time = ?, name = ?, lat = ?, lng = ?, radius = ?, "+
+		"desc = ? WHERE id = ?", ct, place.Name, place.Lat, place.Lng, place.Radius,
+		place.Description, place.Id)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to update place! (%s)", err)
+		return 0, errors.New(e)
+	}
+
+	if old != nil && old.Name != place.Name {
+		_, err = r.db.Exec("UPDATE location SET chng_time = ?, name = ? WHERE place_id = ? AND "+
+			"(name = ? OR name = '' OR name IS NULL)", ct, place.Name, place.Id, old.Name)
+		if err != nil {
+			log.Print(err)
+			e := fmt.Sprintf("Failed to update place locations! (%s)", err)
+			return 0, errors.New(e)
+		}
+
+		err = indexLocations(r.db, "l.place_id = ?", place.Id)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return ct, nil
+}
+
+// DeletePlace deletes a place. Linked locations are unlinked and their change time is updated.
+func (r PlaceRepo) DeletePlace(id int64) error {
+	dt := time.Now().Unix()
+
+	_, err := r.db.Exec("UPDATE location SET chng_time = ?, place_id = NULL WHERE place_id = ?",
+		dt, id)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to update place locations! (%s)", err)
+		return errors.New(e)
+	}
+
+	_, err = r.db.Exec("DELETE FROM place WHERE id = ?", id)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to delete place! (%s)", err)
+		return errors.New(e)
+	}
+
+	_, err = r.db.Exec("INSERT INTO deleted_place (id, del_time) VALUES (?, ?)", id, dt)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to insert deleted place! (%s)", err)
+		return errors.New(e)
+	}
+
+	return nil
+}
+
+func (r PlaceRepo) GetDeletedPlaceIdsByDeletionTime(dt int64) ([]int64, error) {
+	rows, err := r.db.Query("SELECT id FROM deleted_place WHERE del_time >= ?", dt)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query deleted places! (%s)", err)
+		return nil, errors.New(e)
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		err := rows.Scan(&id)
+		if err != nil {
+			log.Print(err)
+			e := fmt.Sprintf("Failed to query deleted places! (%s)", err)
+			return nil, errors.New(e)
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query deleted places! (%s)", err)
+		return nil, errors.New(e)
+	}
+
+	return ids, nil
+}
+
+// --- Private methods ---
+
+func (r PlaceRepo) scanPlaceRow(scan Scanner) (*model.Place, error) {
+	var id int64
+	var ct int64
+	var name string
+	var lat float64
+	var lng float64
+	var radius float64
+	var desc string
+	var visitCount int64
+
+	err := scan.Scan(&id, &ct, &name, &lat, &lng, &radius, &desc, &visitCount)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.Place{id, ct, name, lat, lng, radius, desc, visitCount}, nil
+}
@@ -1,5 +1,54 @@
 package repo
 
+import (
+	"database/sql"
+	"strings"
+)
+
+// maxBatchSize is the maximum number of IDs which are used in a single "IN (...)" query.
+const maxBatchSize = 500
+
 type Scanner interface {
 	Scan(dest ...interface{}) error
 }
+
+type Executor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// prefixScanner scans leading columns into prefix and the remaining columns into the destinations
+// of the wrapped scan function. This allows reusing row scan functions for joined queries.
+type prefixScanner struct {
+	scan   Scanner
+	prefix []interface{}
+}
+
+func (s *prefixScanner) Scan(dest ...interface{}) error {
+	return s.scan.Scan(append(append([]interface{}{}, s.prefix...), dest...)...)
+}
+
+// suffixScanner scans trailing columns into suffix and the leading columns into the destinations
+// of the wrapped scan function.
+type suffixScanner struct {
+	scan   Scanner
+	suffix []interface{}
+}
+
+func (s *suffixScanner) Scan(dest ...interface{}) error {
+	return s.scan.Scan(append(append([]interface{}{}, dest...), s.suffix...)...)
+}
+
+func placeholders(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return strings.Repeat("?, ", n-1) + "?"
+}
+
+func toArgs(ids []int64) []interface{} {
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return args
+}
@@ -0,0 +1,200 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"strings"
+	"unicode"
+
+	"kellnhofer.com/tracker/model"
+)
+
+// FTS5 encloses the matched terms in these markers. They are replaced with HTML tags after the text
+// was escaped.
+const (
+	searchHighlightStart = "\x01"
+	searchHighlightEnd   = "\x02"
+	searchEllipsis       = "…"
+	searchSnippetTokens  = 12
+)
+
+// locationSearchValues selects the indexed values of the locations (aliased as "l"): The name, the
+// description and the names of all persons.
+const locationSearchValues = "l.id, COALESCE(l.name, ''), l.desc, COALESCE((SELECT " +
+	"group_concat(p.first_name || ' ' || p.last_name || CASE WHEN p.nickname = '' THEN '' " +
+	"ELSE ' ' || p.nickname END, ', ') FROM location_person lp INNER JOIN person p " +
+	"ON lp.person_id = p.id WHERE lp.location_id = l.id), '')"
+
+// --- Public methods ---
+
+// SearchLocations searches the name, the description and the person names of all locations. The
+// query consists of words which must all be found. A word ending with "*" matches all words
+// starting with it. Words enclosed in double quotes must be found as phrase. The results are
+// ordered by relevance (name matches are weighted highest).
+func (r LocationRepo) SearchLocations(query string, limit int) ([]*model.LocationSearchResult,
+	error) {
+	ftsQuery := toFtsQuery(query)
+	if ftsQuery == "" {
+		return []*model.LocationSearchResult{}, nil
+	}
+
+	rows, err := r.db.Query("SELECT rowid, -bm25(location_search, 10.0, 1.0, 5.0), "+
+		"highlight(location_search, 0, ?, ?), snippet(location_search, -1, ?, ?, ?, ?) "+
+		"FROM location_search WHERE location_search MATCH ? "+
+		"ORDER BY bm25(location_search, 10.0, 1.0, 5.0) LIMIT ?", searchHighlightStart,
+		searchHighlightEnd, searchHighlightStart, searchHighlightEnd, searchEllipsis,
+		searchSnippetTokens, ftsQuery, limit)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to search locations! (%s)", err)
+		return nil, errors.New(e)
+	}
+	defer rows.Close()
+
+	results := []*model.LocationSearchResult{}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		var result model.LocationSearchResult
+		err := rows.Scan(&id, &result.Score, &result.HighlightedName, &result.Snippet)
+		if err != nil {
+			log.Print(err)
+			e := fmt.Sprintf("Failed to search locations! (%s)", err)
+			return nil, errors.New(e)
+		}
+		result.HighlightedName = toHighlightHtml(result.HighlightedName)
+		result.Snippet = toHighlightHtml(result.Snippet)
+		result.Location = &model.Location{Id: id}
+		results = append(results, &result)
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to search locations! (%s)", err)
+		return nil, errors.New(e)
+	}
+
+	if len(ids) == 0 {
+		return results, nil
+	}
+
+	lRows, err := r.db.Query("SELECT "+locationColumns+" FROM location WHERE id IN ("+
+		placeholders(len(ids))+")", toArgs(ids)...)
+	locs, err := r.getLocationRows(lRows, err)
+	if err != nil {
+		return nil, err
+	}
+	byId := map[int64]*model.Location{}
+	for _, loc := range locs {
+		byId[loc.Id] = loc
+	}
+	for _, result := range results {
+		result.Location = byId[result.Location.Id]
+	}
+
+	return results, nil
+}
+
+// --- Private methods ---
+
+// indexLocations updates the search index of all locations (aliased as "l") matching the
+// condition.
+func indexLocations(ex Executor, cond string, args ...interface{}) error {
+	_, err := ex.Exec("DELETE FROM location_search WHERE rowid IN "+
+		"(SELECT l.id FROM location l WHERE "+cond+")", args...)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to update search index! (%s)", err)
+		return errors.New(e)
+	}
+
+	_, err = ex.Exec("INSERT INTO location_search (rowid, name, description, persons) "+
+		"SELECT "+locationSearchValues+" FROM location l WHERE "+cond, args...)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to update search index! (%s)", err)
+		return errors.New(e)
+	}
+
+	return nil
+}
+
+func unindexLocation(ex Executor, id int64) error {
+	_, err := ex.Exec("DELETE FROM location_search WHERE rowid = ?", id)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to update search index! (%s)", err)
+		return errors.New(e)
+	}
+
+	return nil
+}
+
+// toFtsQuery converts a search query into a FTS5 query. Every word and phrase is quoted, so that
+// user input can't cause FTS5 syntax errors.
+func toFtsQuery(query string) string {
+	var terms []string
+
+	rs := []rune(query)
+	for i := 0; i < len(rs); {
+		if unicode.IsSpace(rs[i]) {
+			i++
+			continue
+		}
+
+		// Read phrase or word
+		var term string
+		if rs[i] == '"' {
+			j := i + 1
+			for j < len(rs) && rs[j] != '"' {
+				j++
+			}
+			term = string(rs[i+1 : j])
+			i = j + 1
+		} else {
+			j := i
+			for j < len(rs) && !unicode.IsSpace(rs[j]) && rs[j] != '"' && rs[j] != '*' {
+				j++
+			}
+			term = string(rs[i:j])
+			i = j
+		}
+
+		// Read prefix marker
+		prefix := false
+		if i < len(rs) && rs[i] == '*' {
+			prefix = true
+			i++
+		}
+
+		if !containsLetterOrDigit(term) {
+			continue
+		}
+		term = "\"" + strings.ReplaceAll(term, "\"", "\"\"") + "\""
+		if prefix {
+			term += "*"
+		}
+		terms = append(terms, term)
+	}
+
+	return strings.Join(terms, " ")
+}
+
+// toHighlightHtml escapes a text with highlight markers as HTML and replaces the markers with "<b>"
+// tags.
+func toHighlightHtml(s string) string {
+	s = html.EscapeString(s)
+	return strings.NewReplacer(searchHighlightStart, "<b>", searchHighlightEnd, "</b>").Replace(s)
+}
+
+func containsLetterOrDigit(s string) bool {
+	for _, r := range s {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return true
+		}
+	}
+	return false
+}
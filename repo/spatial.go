@@ -0,0 +1,292 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"kellnhofer.com/tracker/constant"
+	"kellnhofer.com/tracker/model"
+	"kellnhofer.com/tracker/util"
+)
+
+type locationDistance struct {
+	id   int64
+	dist float64
+}
+
+const clusterSampleSize = 5
+
+// --- Public methods ---
+
+// GetLocationClusters groups the locations matching the filter by the first precision characters
+// of their geohash.
+func (r LocationRepo) GetLocationClusters(filter *model.LocationFilter,
+	precision int) ([]*model.LocationCluster, error) {
+	conds, args := locationConds(filter)
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	qArgs := append([]interface{}{clusterSampleSize, precision, precision}, args...)
+	rows, err := r.db.Query("SELECT cell, COUNT(*), AVG(lat), AVG(lng), "+
+		"group_concat(CASE WHEN rn <= ? THEN id END) FROM (SELECT substr(geohash, 1, ?) AS cell, "+
+		"id, lat, lng, ROW_NUMBER() OVER (PARTITION BY substr(geohash, 1, ?) "+
+		"ORDER BY time DESC, id DESC) AS rn FROM location"+where+") GROUP BY cell ORDER BY cell",
+		qArgs...)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query location clusters! (%s)", err)
+		return nil, errors.New(e)
+	}
+	defer rows.Close()
+
+	clusters := []*model.LocationCluster{}
+	for rows.Next() {
+		var cluster model.LocationCluster
+		var sampleIds sql.NullString
+		err := rows.Scan(&cluster.Geohash, &cluster.Count, &cluster.Lat, &cluster.Lng,
+			&sampleIds)
+		if err != nil {
+			log.Print(err)
+			e := fmt.Sprintf("Failed to query location clusters! (%s)", err)
+			return nil, errors.New(e)
+		}
+		cluster.SampleIds = parseIdList(sampleIds.String)
+		clusters = append(clusters, &cluster)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query location clusters! (%s)", err)
+		return nil, errors.New(e)
+	}
+
+	return clusters, nil
+}
+
+// UpdateMissingGeohashes computes the geohash of all locations which don't have one yet (e.g.
+// after a database update).
+func (r LocationRepo) UpdateMissingGeohashes() error {
+	rows, err := r.db.Query("SELECT id, lat, lng FROM location WHERE geohash = ''")
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query locations! (%s)", err)
+		return errors.New(e)
+	}
+
+	hashes := map[int64]string{}
+	for rows.Next() {
+		var id int64
+		var lat float64
+		var lng float64
+		err := rows.Scan(&id, &lat, &lng)
+		if err != nil {
+			rows.Close()
+			log.Print(err)
+			e := fmt.Sprintf("Failed to query locations! (%s)", err)
+			return errors.New(e)
+		}
+		hashes[id] = util.Geohash(lat, lng, util.GeohashPrecision)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query locations! (%s)", err)
+		return errors.New(e)
+	}
+
+	if len(hashes) == 0 {
+		return nil
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to update location geohashes! (%s)", err)
+		return errors.New(e)
+	}
+
+	err = r.updateGeohashes(tx, hashes)
+	if err != nil {
+		tx.Rollback()
+		log.Print(err)
+		e := fmt.Sprintf("Failed to update location geohashes! (%s)", err)
+		return errors.New(e)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to update location geohashes! (%s)", err)
+		return errors.New(e)
+	}
+
+	return nil
+}
+
+// --- Private methods ---
+
+func (r LocationRepo) updateGeohashes(tx *sql.Tx, hashes map[int64]string) error {
+	for id, hash := range hashes {
+		_, err := tx.Exec("UPDATE location SET geohash = ? WHERE id = ?", hash, id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getNearLocations returns the locations within the radius of filter.Near. The query (the
+// condition and the order) must have been built from the filter before. The exact distance is
+// checked here because SQLite has no trigonometric functions.
+func (r LocationRepo) getNearLocations(filter *model.LocationFilter, query string,
+	args []interface{}) ([]*model.Location, error) {
+	rows, err := r.db.Query("SELECT id, lat, lng FROM location"+query, args...)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query locations! (%s)", err)
+		return nil, errors.New(e)
+	}
+	defer rows.Close()
+
+	near := filter.Near
+	var dists []*locationDistance
+	for rows.Next() {
+		var id int64
+		var lat float64
+		var lng float64
+		err := rows.Scan(&id, &lat, &lng)
+		if err != nil {
+			log.Print(err)
+			e := fmt.Sprintf("Failed to query locations! (%s)", err)
+			return nil, errors.New(e)
+		}
+		dist := util.Distance(near.Lat, near.Lng, lat, lng)
+		if dist <= near.Radius {
+			dists = append(dists, &locationDistance{id, dist})
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query locations! (%s)", err)
+		return nil, errors.New(e)
+	}
+
+	if filter.Sort == constant.LocationSortDistance {
+		dists = sortLocationDistances(dists, filter.Descending, filter.After)
+	}
+	if filter.Limit > 0 && len(dists) > filter.Limit {
+		dists = dists[:filter.Limit]
+	}
+
+	return r.getLocationsByIds(dists)
+}
+
+// getLocationsByIds loads the locations in the given order.
+func (r LocationRepo) getLocationsByIds(dists []*locationDistance) ([]*model.Location, error) {
+	byId := map[int64]*model.Location{}
+	for start := 0; start < len(dists); start += maxBatchSize {
+		end := start + maxBatchSize
+		if end > len(dists) {
+			end = len(dists)
+		}
+		ids := make([]int64, 0, end-start)
+		for _, d := range dists[start:end] {
+			ids = append(ids, d.id)
+		}
+
+		rows, err := r.db.Query("SELECT "+locationColumns+" FROM location WHERE id IN ("+
+			placeholders(len(ids))+")", toArgs(ids)...)
+		locs, err := r.getLocationRows(rows, err)
+		if err != nil {
+			return nil, err
+		}
+		for _, loc := range locs {
+			byId[loc.Id] = loc
+		}
+	}
+
+	locs := []*model.Location{}
+	for _, d := range dists {
+		if loc, ok := byId[d.id]; ok {
+			locs = append(locs, loc)
+		}
+	}
+	return locs, nil
+}
+
+// sortLocationDistances sorts by distance (and ID). If a cursor is given, only the locations after
+// the cursor are returned.
+func sortLocationDistances(dists []*locationDistance, desc bool,
+	after *model.LocationCursor) []*locationDistance {
+	less := func(a *locationDistance, dist float64, id int64) bool {
+		if a.dist != dist {
+			return (a.dist < dist) != desc
+		}
+		return (a.id < id) != desc
+	}
+
+	sort.Slice(dists, func(i, j int) bool {
+		return less(dists[i], dists[j].dist, dists[j].id)
+	})
+
+	if after == nil {
+		return dists
+	}
+	afterDist, _ := strconv.ParseFloat(after.Value, 64)
+	for i, d := range dists {
+		if !less(d, afterDist, after.Id) && !(d.dist == afterDist && d.id == after.Id) {
+			return dists[i:]
+		}
+	}
+	return nil
+}
+
+// boundingBoxCond creates a condition which selects locations within a bounding box. The R*Tree
+// index is used to find the candidates. (It stores 32-bit floats, so the coordinates are checked
+// again.) If minLng is greater than maxLng, the box crosses the antimeridian.
+func boundingBoxCond(minLat float64, minLng float64, maxLat float64, maxLng float64) (string,
+	[]interface{}) {
+	if minLng <= maxLng {
+		return "(id IN (SELECT id FROM location_rtree WHERE max_lat >= ? AND min_lat <= ? AND " +
+				"max_lng >= ? AND min_lng <= ?) AND lat BETWEEN ? AND ? AND lng BETWEEN ? AND ?)",
+			[]interface{}{minLat, maxLat, minLng, maxLng, minLat, maxLat, minLng, maxLng}
+	}
+
+	return "(id IN (SELECT id FROM location_rtree WHERE max_lat >= ? AND min_lat <= ? AND " +
+			"max_lng >= ? UNION SELECT id FROM location_rtree WHERE max_lat >= ? AND " +
+			"min_lat <= ? AND min_lng <= ?) AND lat BETWEEN ? AND ? AND (lng >= ? OR lng <= ?))",
+		[]interface{}{minLat, maxLat, minLng, minLat, maxLat, maxLng, minLat, maxLat, minLng,
+			maxLng}
+}
+
+func indexLocationCoordinate(ex Executor, id int64, lat float64, lng float64) error {
+	_, err := ex.Exec("INSERT OR REPLACE INTO location_rtree (id, min_lat, max_lat, min_lng, "+
+		"max_lng) VALUES (?, ?, ?, ?, ?)", id, lat, lat, lng, lng)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to update spatial index! (%s)", err)
+		return errors.New(e)
+	}
+
+	return nil
+}
+
+func unindexLocationCoordinate(ex Executor, id int64) error {
+	_, err := ex.Exec("DELETE FROM location_rtree WHERE id = ?", id)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to update spatial index! (%s)", err)
+		return errors.New(e)
+	}
+
+	return nil
+}
@@ -0,0 +1,165 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"kellnhofer.com/tracker/constant"
+	"kellnhofer.com/tracker/data"
+	"kellnhofer.com/tracker/model"
+	"kellnhofer.com/tracker/util"
+)
+
+// --- Public methods ---
+
+// GetLocationStats aggregates the locations matching the filter. The locations are counted per
+// period of their local time (e.g. per month). At most top persons are returned.
+func (r LocationRepo) GetLocationStats(filter *model.LocationFilter, period string,
+	top int) (*model.LocationStats, error) {
+	conds, args := locationConds(filter)
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	stats := &model.LocationStats{}
+
+	err := r.aggregateLocations(stats, where, args, period)
+	if err != nil {
+		return nil, err
+	}
+
+	row := r.db.QueryRow("SELECT COUNT(DISTINCT place_id) FROM location"+where, args...)
+	err = row.Scan(&stats.PlaceCount)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query location stats! (%s)", err)
+		return nil, errors.New(e)
+	}
+
+	pers, err := r.getTopPersons(where, args, top)
+	if err != nil {
+		return nil, err
+	}
+	stats.TopPersons = pers
+
+	return stats, nil
+}
+
+// --- Private methods ---
+
+// aggregateLocations counts the locations (per period) and sums up the distance between them.
+func (r LocationRepo) aggregateLocations(stats *model.LocationStats, where string,
+	args []interface{}, period string) error {
+	rows, err := r.db.Query("SELECT local_time, lat, lng FROM location"+where+
+		" ORDER BY time ASC, id ASC", args...)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query location stats! (%s)", err)
+		return errors.New(e)
+	}
+	defer rows.Close()
+
+	stats.Periods = []*model.PeriodCount{}
+	periods := map[string]*model.PeriodCount{}
+	first := true
+	var prevLat float64
+	var prevLng float64
+	for rows.Next() {
+		var lt string
+		var lat float64
+		var lng float64
+		err := rows.Scan(&lt, &lat, &lng)
+		if err != nil {
+			log.Print(err)
+			e := fmt.Sprintf("Failed to query location stats! (%s)", err)
+			return errors.New(e)
+		}
+
+		stats.LocationCount++
+
+		key := formatPeriod(data.ParseLocalTime(lt, ""), period)
+		pc, ok := periods[key]
+		if !ok {
+			pc = &model.PeriodCount{key, 0}
+			periods[key] = pc
+			stats.Periods = append(stats.Periods, pc)
+		}
+		pc.Count++
+
+		if !first {
+			stats.Distance += util.Distance(prevLat, prevLng, lat, lng)
+		}
+		first = false
+		prevLat = lat
+		prevLng = lng
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query location stats! (%s)", err)
+		return errors.New(e)
+	}
+
+	// Local times may be in a different order than UTC times
+	sort.Slice(stats.Periods, func(i, j int) bool {
+		return stats.Periods[i].Period < stats.Periods[j].Period
+	})
+
+	return nil
+}
+
+func (r LocationRepo) getTopPersons(where string, args []interface{},
+	top int) ([]*model.PersonCount, error) {
+	qArgs := append(append([]interface{}{}, args...), top)
+	rows, err := r.db.Query("SELECT "+personColumns+", COUNT(*) AS cnt FROM location_person lp "+
+		"INNER JOIN person p ON lp.person_id = p.id "+
+		"WHERE lp.location_id IN (SELECT id FROM location"+where+") "+
+		"GROUP BY p.id ORDER BY cnt DESC, p.last_name ASC, p.first_name ASC LIMIT ?", qArgs...)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query top persons! (%s)", err)
+		return nil, errors.New(e)
+	}
+	defer rows.Close()
+
+	pers := []*model.PersonCount{}
+	for rows.Next() {
+		var cnt int64
+		per, err := scanPersonRow(&suffixScanner{rows, []interface{}{&cnt}})
+		if err != nil {
+			log.Print(err)
+			e := fmt.Sprintf("Failed to query top persons! (%s)", err)
+			return nil, errors.New(e)
+		}
+		pers = append(pers, &model.PersonCount{per, cnt})
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query top persons! (%s)", err)
+		return nil, errors.New(e)
+	}
+
+	return pers, nil
+}
+
+// formatPeriod returns the period of a time, e.g. "2020-01-31" (day), "2020-W05" (ISO week),
+// "2020-01" (month) or "2020" (year).
+func formatPeriod(t time.Time, period string) string {
+	switch period {
+	case constant.StatsPeriodDay:
+		return t.Format("2006-01-02")
+	case constant.StatsPeriodWeek:
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%04d-W%02d", year, week)
+	case constant.StatsPeriodYear:
+		return t.Format("2006")
+	default:
+		return t.Format("2006-01")
+	}
+}
@@ -0,0 +1,280 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"kellnhofer.com/tracker/model"
+)
+
+type TagRepo struct {
+	db *sql.DB
+}
+
+func NewTagRepo(db *sql.DB) *TagRepo {
+	return &TagRepo{db}
+}
+
+// --- Public methods ---
+
+func (r TagRepo) ExistsTag(id int64) (bool, error) {
+	row := r.db.QueryRow("SELECT COUNT(*) FROM tag WHERE id = ?", id)
+
+	var n int
+	err := row.Scan(&n)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query tag! (%s)", err)
+		return false, errors.New(e)
+	}
+
+	return n > 0, nil
+}
+
+func (r TagRepo) GetTagsByChangeTime(ct int64) ([]*model.Tag, error) {
+	rows, err := r.db.Query("SELECT id, chng_time, name FROM tag WHERE chng_time >= ? "+
+		"ORDER BY name ASC", ct)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query tags! (%s)", err)
+		return nil, errors.New(e)
+	}
+	defer rows.Close()
+
+	tags := []*model.Tag{}
+	for rows.Next() {
+		tag, err := r.scanTagRow(rows)
+		if err != nil {
+			log.Print(err)
+			e := fmt.Sprintf("Failed to query tags! (%s)", err)
+			return nil, errors.New(e)
+		}
+		tags = append(tags, tag)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query tags! (%s)", err)
+		return nil, errors.New(e)
+	}
+
+	return tags, nil
+}
+
+func (r TagRepo) GetTag(id int64) (*model.Tag, error) {
+	row := r.db.QueryRow("SELECT id, chng_time, name FROM tag WHERE id = ?", id)
+	return r.getTagRow(row)
+}
+
+func (r TagRepo) GetTagByName(name string) (*model.Tag, error) {
+	row := r.db.QueryRow("SELECT id, chng_time, name FROM tag WHERE name = ?", name)
+	return r.getTagRow(row)
+}
+
+func (r TagRepo) AddTag(tag *model.Tag) (int64, int64, error) {
+	ct := time.Now().Unix()
+
+	res, err := r.db.Exec("INSERT INTO tag (chng_time, name) VALUES (?, ?)", ct, tag.Name)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to insert tag! (%s)", err)
+		return 0, 0, errors.New(e)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to insert tag! (%s)", err)
+		return 0, 0, errors.New(e)
+	}
+
+	return id, ct, nil
+}
+
+// ChangeTag renames a tag. The change time of all locations with this tag is updated too, so
+// clients receive the new name with the next location sync.
+func (r TagRepo) ChangeTag(tag *model.Tag) (int64, error) {
+	ct := time.Now().Unix()
+
+	_, err := r.db.Exec("UPDATE tag SET chng_time = ?, name = ? WHERE id = ?", ct, tag.Name,
+		tag.Id)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to update tag! (%s)", err)
+		return 0, errors.New(e)
+	}
+
+	err = r.touchTagLocations(r.db, tag.Id, ct)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to update tag! (%s)", err)
+		return 0, errors.New(e)
+	}
+
+	return ct, nil
+}
+
+func (r TagRepo) DeleteTag(id int64) error {
+	dt := time.Now().Unix()
+
+	err := r.touchTagLocations(r.db, id, dt)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to delete tag! (%s)", err)
+		return errors.New(e)
+	}
+
+	_, err = r.db.Exec("DELETE FROM tag WHERE id = ?", id)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to delete tag! (%s)", err)
+		return errors.New(e)
+	}
+
+	_, err = r.db.Exec("INSERT INTO deleted_tag (id, del_time) VALUES (?, ?)", id, dt)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to insert deleted tag! (%s)", err)
+		return errors.New(e)
+	}
+
+	return nil
+}
+
+// MergeTags re-points all locations of the source tags to the target tag and deletes the source
+// tags. The change time of affected locations is updated and the IDs of the source tags are
+// recorded as deleted.
+func (r TagRepo) MergeTags(targetId int64, sourceIds []int64) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to merge tags! (%s)", err)
+		return errors.New(e)
+	}
+
+	err = r.mergeTags(tx, targetId, sourceIds)
+	if err != nil {
+		tx.Rollback()
+		log.Print(err)
+		e := fmt.Sprintf("Failed to merge tags! (%s)", err)
+		return errors.New(e)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to merge tags! (%s)", err)
+		return errors.New(e)
+	}
+
+	return nil
+}
+
+func (r TagRepo) GetDeletedTagIdsByDeletionTime(dt int64) ([]int64, error) {
+	rows, err := r.db.Query("SELECT id FROM deleted_tag WHERE del_time >= ?", dt)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query deleted tags! (%s)", err)
+		return nil, errors.New(e)
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		err := rows.Scan(&id)
+		if err != nil {
+			log.Print(err)
+			e := fmt.Sprintf("Failed to query deleted tags! (%s)", err)
+			return nil, errors.New(e)
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query deleted tags! (%s)", err)
+		return nil, errors.New(e)
+	}
+
+	return ids, nil
+}
+
+// --- Private methods ---
+
+func (r TagRepo) mergeTags(tx *sql.Tx, targetId int64, sourceIds []int64) error {
+	t := time.Now().Unix()
+
+	_, err := tx.Exec("UPDATE tag SET chng_time = ? WHERE id = ?", t, targetId)
+	if err != nil {
+		return err
+	}
+
+	for _, sourceId := range sourceIds {
+		// Touch affected locations
+		err := r.touchTagLocations(tx, sourceId, t)
+		if err != nil {
+			return err
+		}
+
+		// Re-point location tags (a location may already have the target tag)
+		_, err = tx.Exec("INSERT OR IGNORE INTO location_tag (location_id, tag_id) "+
+			"SELECT location_id, ? FROM location_tag WHERE tag_id = ?", targetId, sourceId)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("DELETE FROM location_tag WHERE tag_id = ?", sourceId)
+		if err != nil {
+			return err
+		}
+
+		// Delete merged tag
+		_, err = tx.Exec("DELETE FROM tag WHERE id = ?", sourceId)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("INSERT INTO deleted_tag (id, del_time) VALUES (?, ?)", sourceId, t)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r TagRepo) touchTagLocations(exec Executor, id int64, ct int64) error {
+	_, err := exec.Exec("UPDATE location SET chng_time = ? WHERE id IN "+
+		"(SELECT location_id FROM location_tag WHERE tag_id = ?)", ct, id)
+	return err
+}
+
+func (r TagRepo) getTagRow(row *sql.Row) (*model.Tag, error) {
+	tag, err := r.scanTagRow(row)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query tag! (%s)", err)
+		return nil, errors.New(e)
+	default:
+	}
+
+	return tag, nil
+}
+
+func (r TagRepo) scanTagRow(scan Scanner) (*model.Tag, error) {
+	var id int64
+	var ct int64
+	var name string
+
+	err := scan.Scan(&id, &ct, &name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.Tag{id, ct, name}, nil
+}
@@ -0,0 +1,114 @@
+package repo
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"kellnhofer.com/tracker/constant"
+	"kellnhofer.com/tracker/model"
+	"kellnhofer.com/tracker/util"
+)
+
+const (
+	// maxZoneOffset is the largest offset of a local time from UTC.
+	maxZoneOffset = 14 * time.Hour
+	// timelineGapDuration is the time without location after which a leg is a gap.
+	timelineGapDuration = 6 * time.Hour
+)
+
+// --- Public methods ---
+
+// GetTimeline returns the locations matching the filter grouped by their local day. The timeline
+// starts at the given day and covers the given number of days. Days without locations are
+// omitted.
+func (r LocationRepo) GetTimeline(filter *model.LocationFilter, start time.Time,
+	days int) ([]*model.TimelineDay, error) {
+	first := start.Format(constant.ApiDayFormat)
+	last := start.AddDate(0, 0, days-1).Format(constant.ApiDayFormat)
+
+	// The local day is not indexed, so the UTC time is used to narrow down the locations first
+	dayFilter := *filter
+	dayFilter.From = start.Add(-maxZoneOffset)
+	dayFilter.To = start.AddDate(0, 0, days).Add(maxZoneOffset)
+
+	locs, err := r.getLocalDayLocations(&dayFilter, "substr(local_time, 1, 10) BETWEEN ? AND ?",
+		"substr(local_time, 1, 10) ASC", first, last)
+	if err != nil {
+		return nil, err
+	}
+
+	tDays := []*model.TimelineDay{}
+	var tDay *model.TimelineDay
+	for _, loc := range locs {
+		date := loc.Time.Format(constant.ApiDayFormat)
+		if tDay == nil || tDay.Date != date {
+			tDay = &model.TimelineDay{date, 0, []*model.Location{}, []*model.TimelineLeg{}}
+			tDays = append(tDays, tDay)
+		}
+		if n := len(tDay.Locations); n > 0 {
+			leg := createTimelineLeg(tDay.Locations[n-1], loc)
+			tDay.Legs = append(tDay.Legs, leg)
+			tDay.Distance += leg.Distance
+		}
+		tDay.Locations = append(tDay.Locations, loc)
+	}
+
+	return tDays, nil
+}
+
+// GetMemories returns the locations matching the filter which were at the given calendar day
+// (local time) in a year before beforeYear. The locations are grouped by year, most recent first.
+func (r LocationRepo) GetMemories(filter *model.LocationFilter, month time.Month, day int,
+	beforeYear int) ([]*model.MemoryYear, error) {
+	monthDay := fmt.Sprintf("%02d-%02d", month, day)
+	locs, err := r.getLocalDayLocations(filter, "substr(local_time, 6, 5) = ? AND "+
+		"substr(local_time, 1, 4) < ?", "substr(local_time, 1, 4) DESC", monthDay,
+		fmt.Sprintf("%04d", beforeYear))
+	if err != nil {
+		return nil, err
+	}
+
+	years := []*model.MemoryYear{}
+	byYear := map[int]*model.MemoryYear{}
+	for _, loc := range locs {
+		year := loc.Time.Year()
+		my, ok := byYear[year]
+		if !ok {
+			my = &model.MemoryYear{year, []*model.Location{}}
+			byYear[year] = my
+			years = append(years, my)
+		}
+		my.Locations = append(my.Locations, loc)
+	}
+
+	return years, nil
+}
+
+// --- Private methods ---
+
+// getLocalDayLocations returns the locations matching the filter and an additional condition on
+// the local time. The locations are sorted by the given order and then by time.
+func (r LocationRepo) getLocalDayLocations(filter *model.LocationFilter, cond string,
+	order string, condArgs ...interface{}) ([]*model.Location, error) {
+	conds, args := locationConds(filter)
+	conds = append(conds, cond)
+	args = append(args, condArgs...)
+
+	rows, err := r.db.Query("SELECT "+locationColumns+" FROM location WHERE "+
+		strings.Join(conds, " AND ")+" ORDER BY "+order+", time ASC, id ASC", args...)
+	return r.getLocationRows(rows, err)
+}
+
+func createTimelineLeg(from *model.Location, to *model.Location) *model.TimelineLeg {
+	end := from.Time
+	if !from.EndTime.IsZero() {
+		end = from.EndTime
+	}
+	dur := to.Time.Sub(end)
+	if dur < 0 {
+		dur = 0
+	}
+	dist := util.Distance(from.Lat, from.Lng, to.Lat, to.Lng)
+	return &model.TimelineLeg{from.Id, to.Id, dist, dur, dur >= timelineGapDuration}
+}
@@ -0,0 +1,403 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"kellnhofer.com/tracker/model"
+)
+
+type TrackRepo struct {
+	db *sql.DB
+}
+
+func NewTrackRepo(db *sql.DB) *TrackRepo {
+	return &TrackRepo{db}
+}
+
+// --- Public methods ---
+
+func (r TrackRepo) ExistsTrack(id int64) (bool, error) {
+	row := r.db.QueryRow("SELECT COUNT(*) FROM track WHERE id = ?", id)
+
+	var n int
+	err := row.Scan(&n)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query track! (%s)", err)
+		return false, errors.New(e)
+	}
+
+	return n > 0, nil
+}
+
+func (r TrackRepo) GetTracksByChangeTime(ct int64) ([]*model.Track, error) {
+	rows, err := r.db.Query("SELECT t.id, t.chng_time, t.name, t.desc, COUNT(p.time), "+
+		"MIN(p.time), MAX(p.time) FROM track t LEFT JOIN track_point p ON p.track_id = t.id "+
+		"WHERE t.chng_time >= ? GROUP BY t.id ORDER BY MIN(p.time) ASC", ct)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query tracks! (%s)", err)
+		return nil, errors.New(e)
+	}
+	defer rows.Close()
+
+	tracks := []*model.Track{}
+	for rows.Next() {
+		track, err := r.scanTrackRow(rows)
+		if err != nil {
+			log.Print(err)
+			e := fmt.Sprintf("Failed to query tracks! (%s)", err)
+			return nil, errors.New(e)
+		}
+		tracks = append(tracks, track)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query tracks! (%s)", err)
+		return nil, errors.New(e)
+	}
+
+	return tracks, nil
+}
+
+func (r TrackRepo) GetTrack(id int64) (*model.Track, error) {
+	row := r.db.QueryRow("SELECT t.id, t.chng_time, t.name, t.desc, COUNT(p.time), "+
+		"MIN(p.time), MAX(p.time) FROM track t LEFT JOIN track_point p ON p.track_id = t.id "+
+		"WHERE t.id = ? GROUP BY t.id", id)
+
+	track, err := r.scanTrackRow(row)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query track! (%s)", err)
+		return nil, errors.New(e)
+	default:
+	}
+
+	return track, nil
+}
+
+// GetTrackIdByTimeRange returns the ID of a track whose first and last point have the given times.
+// If there is no such track, 0 is returned.
+func (r TrackRepo) GetTrackIdByTimeRange(start time.Time, end time.Time) (int64, error) {
+	// Only check the tracks which have a point at the start time
+	row := r.db.QueryRow("SELECT c.track_id FROM track_point c WHERE c.time = ? "+
+		"AND (SELECT MIN(p.time) FROM track_point p WHERE p.track_id = c.track_id) = ? "+
+		"AND (SELECT MAX(p.time) FROM track_point p WHERE p.track_id = c.track_id) = ? "+
+		"ORDER BY c.track_id ASC LIMIT 1", toUnixMillis(start), toUnixMillis(start),
+		toUnixMillis(end))
+
+	var id int64
+	err := row.Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	} else if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query track ID! (%s)", err)
+		return 0, errors.New(e)
+	}
+
+	return id, nil
+}
+
+func (r TrackRepo) AddTrack(track *model.Track) (int64, int64, error) {
+	ct := time.Now().Unix()
+
+	res, err := r.db.Exec("INSERT INTO track (chng_time, name, desc) VALUES (?, ?, ?)", ct,
+		track.Name, track.Description)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to insert track! (%s)", err)
+		return 0, 0, errors.New(e)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to insert track! (%s)", err)
+		return 0, 0, errors.New(e)
+	}
+
+	return id, ct, nil
+}
+
+// AddTrackWithPoints inserts a track with its points in a single transaction.
+func (r TrackRepo) AddTrackWithPoints(track *model.Track, points []*model.TrackPoint) (int64,
+	int64, error) {
+	ct := time.Now().Unix()
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to insert track! (%s)", err)
+		return 0, 0, errors.New(e)
+	}
+
+	res, err := tx.Exec("INSERT INTO track (chng_time, name, desc) VALUES (?, ?, ?)", ct,
+		track.Name, track.Description)
+	if err != nil {
+		tx.Rollback()
+		log.Print(err)
+		e := fmt.Sprintf("Failed to insert track! (%s)", err)
+		return 0, 0, errors.New(e)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		log.Print(err)
+		e := fmt.Sprintf("Failed to insert track! (%s)", err)
+		return 0, 0, errors.New(e)
+	}
+
+	_, err = r.addTrackPoints(tx, id, points)
+	if err != nil {
+		tx.Rollback()
+		log.Print(err)
+		e := fmt.Sprintf("Failed to insert track points! (%s)", err)
+		return 0, 0, errors.New(e)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to insert track! (%s)", err)
+		return 0, 0, errors.New(e)
+	}
+
+	return id, ct, nil
+}
+
+func (r TrackRepo) ChangeTrack(track *model.Track) (int64, error) {
+	ct := time.Now().Unix()
+
+	_, err := r.db.Exec("UPDATE track SET chng_time = ?, name = ?, desc = ? WHERE id = ?", ct,
+		track.Name, track.Description, track.Id)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to update track! (%s)", err)
+		return 0, errors.New(e)
+	}
+
+	return ct, nil
+}
+
+func (r TrackRepo) DeleteTrack(id int64) error {
+	_, err := r.db.Exec("DELETE FROM track WHERE id = ?", id)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to delete track! (%s)", err)
+		return errors.New(e)
+	}
+
+	dt := time.Now().Unix()
+
+	_, err = r.db.Exec("INSERT INTO deleted_track (id, del_time) VALUES (?, ?)", id, dt)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to insert deleted track! (%s)", err)
+		return errors.New(e)
+	}
+
+	return nil
+}
+
+func (r TrackRepo) GetDeletedTrackIdsByDeletionTime(dt int64) ([]int64, error) {
+	rows, err := r.db.Query("SELECT id FROM deleted_track WHERE del_time >= ?", dt)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query deleted tracks! (%s)", err)
+		return nil, errors.New(e)
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		err := rows.Scan(&id)
+		if err != nil {
+			log.Print(err)
+			e := fmt.Sprintf("Failed to query deleted tracks! (%s)", err)
+			return nil, errors.New(e)
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query deleted tracks! (%s)", err)
+		return nil, errors.New(e)
+	}
+
+	return ids, nil
+}
+
+// GetTrackPoints returns the points of a track ordered by time. If from or to are not zero, only
+// points within this time window are returned.
+func (r TrackRepo) GetTrackPoints(id int64, from time.Time, to time.Time) ([]*model.TrackPoint,
+	error) {
+	q := "SELECT time, lat, lng, alt, acc, speed, bearing FROM track_point WHERE track_id = ?"
+	args := []interface{}{id}
+	if !from.IsZero() {
+		q += " AND time >= ?"
+		args = append(args, toUnixMillis(from))
+	}
+	if !to.IsZero() {
+		q += " AND time <= ?"
+		args = append(args, toUnixMillis(to))
+	}
+	q += " ORDER BY time ASC"
+
+	rows, err := r.db.Query(q, args...)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query track points! (%s)", err)
+		return nil, errors.New(e)
+	}
+	defer rows.Close()
+
+	points := []*model.TrackPoint{}
+	for rows.Next() {
+		var t int64
+		var lat float64
+		var lng float64
+		var alt sql.NullFloat64
+		var acc sql.NullFloat64
+		var speed sql.NullFloat64
+		var bearing sql.NullFloat64
+
+		err := rows.Scan(&t, &lat, &lng, &alt, &acc, &speed, &bearing)
+		if err != nil {
+			log.Print(err)
+			e := fmt.Sprintf("Failed to query track points! (%s)", err)
+			return nil, errors.New(e)
+		}
+
+		points = append(points, &model.TrackPoint{fromUnixMillis(t), lat, lng,
+			fromNullFloat64(alt), fromNullFloat64(acc), fromNullFloat64(speed),
+			fromNullFloat64(bearing)})
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query track points! (%s)", err)
+		return nil, errors.New(e)
+	}
+
+	return points, nil
+}
+
+// AddTrackPoints inserts points into a track in a single transaction. Points with a time which
+// already exists in the track are skipped. It returns the number of inserted points.
+func (r TrackRepo) AddTrackPoints(id int64, points []*model.TrackPoint) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to insert track points! (%s)", err)
+		return 0, errors.New(e)
+	}
+
+	n, err := r.addTrackPoints(tx, id, points)
+	if err != nil {
+		tx.Rollback()
+		log.Print(err)
+		e := fmt.Sprintf("Failed to insert track points! (%s)", err)
+		return 0, errors.New(e)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to insert track points! (%s)", err)
+		return 0, errors.New(e)
+	}
+
+	return n, nil
+}
+
+// --- Private methods ---
+
+func (r TrackRepo) addTrackPoints(tx *sql.Tx, id int64, points []*model.TrackPoint) (int,
+	error) {
+	stmt, err := tx.Prepare("INSERT OR IGNORE INTO track_point (track_id, time, lat, lng, alt, " +
+		"acc, speed, bearing) VALUES (?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	n := 0
+	for _, p := range points {
+		res, err := stmt.Exec(id, toUnixMillis(p.Time), p.Lat, p.Lng, toNullFloat64(p.Altitude),
+			toNullFloat64(p.Accuracy), toNullFloat64(p.Speed), toNullFloat64(p.Bearing))
+		if err != nil {
+			return 0, err
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		n += int(affected)
+	}
+
+	_, err = tx.Exec("UPDATE track SET chng_time = ? WHERE id = ?", time.Now().Unix(), id)
+	if err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+func (r TrackRepo) scanTrackRow(scan Scanner) (*model.Track, error) {
+	var id int64
+	var ct int64
+	var name string
+	var desc string
+	var count int64
+	var startTime sql.NullInt64
+	var endTime sql.NullInt64
+
+	err := scan.Scan(&id, &ct, &name, &desc, &count, &startTime, &endTime)
+	if err != nil {
+		return nil, err
+	}
+
+	track := &model.Track{id, ct, name, desc, count, time.Time{}, time.Time{}}
+	if startTime.Valid {
+		track.StartTime = fromUnixMillis(startTime.Int64)
+	}
+	if endTime.Valid {
+		track.EndTime = fromUnixMillis(endTime.Int64)
+	}
+	return track, nil
+}
+
+func toUnixMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func fromUnixMillis(ms int64) time.Time {
+	return time.Unix(0, ms*int64(time.Millisecond)).UTC()
+}
+
+func toNullFloat64(v *float64) sql.NullFloat64 {
+	if v == nil {
+		return sql.NullFloat64{}
+	}
+	return sql.NullFloat64{*v, true}
+}
+
+func fromNullFloat64(v sql.NullFloat64) *float64 {
+	if !v.Valid {
+		return nil
+	}
+	f := v.Float64
+	return &f
+}
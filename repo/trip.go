@@ -0,0 +1,286 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"kellnhofer.com/tracker/data"
+	"kellnhofer.com/tracker/model"
+)
+
+type TripRepo struct {
+	db *sql.DB
+}
+
+func NewTripRepo(db *sql.DB) *TripRepo {
+	return &TripRepo{db}
+}
+
+// --- Public methods ---
+
+func (r TripRepo) ExistsTrip(id int64) (bool, error) {
+	row := r.db.QueryRow("SELECT COUNT(*) FROM trip WHERE id = ?", id)
+
+	var n int
+	err := row.Scan(&n)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query trip! (%s)", err)
+		return false, errors.New(e)
+	}
+
+	return n > 0, nil
+}
+
+func (r TripRepo) GetTripsByChangeTime(ct int64) ([]*model.Trip, error) {
+	rows, err := r.db.Query("SELECT id, chng_time, name, start_time, end_time, desc, cover_id "+
+		"FROM trip WHERE chng_time >= ? ORDER BY start_time ASC", ct)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query trips! (%s)", err)
+		return nil, errors.New(e)
+	}
+	defer rows.Close()
+
+	trips := []*model.Trip{}
+	for rows.Next() {
+		trip, err := r.scanTripRow(rows)
+		if err != nil {
+			log.Print(err)
+			e := fmt.Sprintf("Failed to query trips! (%s)", err)
+			return nil, errors.New(e)
+		}
+		trips = append(trips, trip)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query trips! (%s)", err)
+		return nil, errors.New(e)
+	}
+
+	for _, trip := range trips {
+		locIds, err := r.getTripLocationIds(trip.Id)
+		if err != nil {
+			return nil, err
+		}
+		trip.LocationIds = locIds
+	}
+
+	return trips, nil
+}
+
+func (r TripRepo) GetTrip(id int64) (*model.Trip, error) {
+	row := r.db.QueryRow("SELECT id, chng_time, name, start_time, end_time, desc, cover_id "+
+		"FROM trip WHERE id = ?", id)
+
+	trip, err := r.scanTripRow(row)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query trip! (%s)", err)
+		return nil, errors.New(e)
+	default:
+	}
+
+	locIds, err := r.getTripLocationIds(trip.Id)
+	if err != nil {
+		return nil, err
+	}
+	trip.LocationIds = locIds
+
+	return trip, nil
+}
+
+func (r TripRepo) AddTrip(trip *model.Trip) (int64, int64, error) {
+	ct := time.Now().Unix()
+
+	res, err := r.db.Exec("INSERT INTO trip (chng_time, name, start_time, end_time, desc, "+
+		"cover_id) VALUES (?, ?, ?, ?, ?, ?)", ct, trip.Name, formatOptionalTime(trip.StartTime),
+		formatOptionalTime(trip.EndTime), trip.Description, toNullInt64(trip.CoverId))
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to insert trip! (%s)", err)
+		return 0, 0, errors.New(e)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to insert trip! (%s)", err)
+		return 0, 0, errors.New(e)
+	}
+
+	err = r.createTripLocations(id, trip.LocationIds)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return id, ct, nil
+}
+
+func (r TripRepo) ChangeTrip(trip *model.Trip) (int64, error) {
+	ct := time.Now().Unix()
+
+	_, err := r.db.Exec("UPDATE trip SET chng_time = ?, name = ?, start_time = ?, end_time = ?, "+
+		"desc = ?, cover_id = ? WHERE id = ?", ct, trip.Name, formatOptionalTime(trip.StartTime),
+		formatOptionalTime(trip.EndTime), trip.Description, toNullInt64(trip.CoverId), trip.Id)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to update trip! (%s)", err)
+		return 0, errors.New(e)
+	}
+
+	_, err = r.db.Exec("DELETE FROM trip_location WHERE trip_id = ?", trip.Id)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to delete trip locations! (%s)", err)
+		return 0, errors.New(e)
+	}
+
+	err = r.createTripLocations(trip.Id, trip.LocationIds)
+	if err != nil {
+		return 0, err
+	}
+
+	return ct, nil
+}
+
+func (r TripRepo) DeleteTrip(id int64) error {
+	_, err := r.db.Exec("DELETE FROM trip WHERE id = ?", id)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to delete trip! (%s)", err)
+		return errors.New(e)
+	}
+
+	dt := time.Now().Unix()
+
+	_, err = r.db.Exec("INSERT INTO deleted_trip (id, del_time) VALUES (?, ?)", id, dt)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to insert deleted trip! (%s)", err)
+		return errors.New(e)
+	}
+
+	return nil
+}
+
+func (r TripRepo) GetDeletedTripIdsByDeletionTime(dt int64) ([]int64, error) {
+	rows, err := r.db.Query("SELECT id FROM deleted_trip WHERE del_time >= ?", dt)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query deleted trips! (%s)", err)
+		return nil, errors.New(e)
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		err := rows.Scan(&id)
+		if err != nil {
+			log.Print(err)
+			e := fmt.Sprintf("Failed to query deleted trips! (%s)", err)
+			return nil, errors.New(e)
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query deleted trips! (%s)", err)
+		return nil, errors.New(e)
+	}
+
+	return ids, nil
+}
+
+// --- Private methods ---
+
+func (r TripRepo) scanTripRow(scan Scanner) (*model.Trip, error) {
+	var id int64
+	var ct int64
+	var name string
+	var startTime string
+	var endTime string
+	var desc string
+	var coverId sql.NullInt64
+
+	err := scan.Scan(&id, &ct, &name, &startTime, &endTime, &desc, &coverId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.Trip{id, ct, name, parseOptionalTime(startTime), parseOptionalTime(endTime),
+		desc, coverId.Int64, nil}, nil
+}
+
+func (r TripRepo) getTripLocationIds(id int64) ([]int64, error) {
+	rows, err := r.db.Query("SELECT l.id FROM trip_location tl "+
+		"INNER JOIN location l ON tl.location_id = l.id "+
+		"WHERE tl.trip_id = ? ORDER BY l.time ASC", id)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query trip locations! (%s)", err)
+		return nil, errors.New(e)
+	}
+	defer rows.Close()
+
+	locIds := []int64{}
+	for rows.Next() {
+		var locId int64
+		err := rows.Scan(&locId)
+		if err != nil {
+			log.Print(err)
+			e := fmt.Sprintf("Failed to query trip locations! (%s)", err)
+			return nil, errors.New(e)
+		}
+		locIds = append(locIds, locId)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to query trip locations! (%s)", err)
+		return nil, errors.New(e)
+	}
+
+	return locIds, nil
+}
+
+func (r TripRepo) createTripLocations(id int64, locIds []int64) error {
+	for _, locId := range locIds {
+		_, err := r.db.Exec("INSERT OR IGNORE INTO trip_location (trip_id, location_id) "+
+			"VALUES (?, ?)", id, locId)
+		if err != nil {
+			log.Print(err)
+			e := fmt.Sprintf("Failed to insert trip location! (%s)", err)
+			return errors.New(e)
+		}
+	}
+
+	return nil
+}
+
+func formatOptionalTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return data.FormatTime(t)
+}
+
+func parseOptionalTime(t string) time.Time {
+	if t == "" {
+		return time.Time{}
+	}
+	return data.ParseTime(t)
+}
+
+func toNullInt64(v int64) sql.NullInt64 {
+	return sql.NullInt64{v, v != 0}
+}
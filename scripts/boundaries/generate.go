@@ -0,0 +1,300 @@
+//go:build ignore
+
+// This program creates the boundary files which are compiled into the server from the Natural
+// Earth admin 0 countries and admin 1 states and provinces (both public domain) and the time zones
+// of timezone-boundary-builder (ODbL). See README for details.
+//
+// Usage: go run scripts/boundaries/generate.go <countries.geojson> <subdivisions.geojson>
+// <timezones.geojson> <output directory>
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"kellnhofer.com/tracker/util"
+)
+
+// Precision of the coordinates (0.001° is about 100 m)
+const coordPrecision = 1000
+
+// Tolerance in meters for simplifying the boundaries
+const simplifyTolerance = 1000
+
+// Natural Earth has no ISO code for some disputed areas. They are merged into the country which
+// they belong to de jure.
+var countryFixes = map[string]string{"CYN": "CY", "SOL": "SO"}
+
+type featureCollection struct {
+	Type     string     `json:"type"`
+	Features []*feature `json:"features"`
+}
+
+type feature struct {
+	Type       string                 `json:"type"`
+	Properties map[string]interface{} `json:"properties"`
+	Geometry   *geometry              `json:"geometry"`
+}
+
+type geometry struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+// area is a country, subdivision or time zone.
+type area struct {
+	code     string
+	name     string
+	polygons [][][][]float64
+}
+
+func main() {
+	if len(os.Args) != 5 {
+		fmt.Println("Usage: go run scripts/boundaries/generate.go <countries.geojson> " +
+			"<subdivisions.geojson> <timezones.geojson> <output dir>")
+		os.Exit(1)
+	}
+
+	countries := readCountries(os.Args[1])
+	subdivisions := readSubdivisions(os.Args[2])
+	timeZones := readTimeZones(os.Args[3])
+	writeAreas(filepath.Join(os.Args[4], "countries.geojson.gz"), countries, "ISO_A2", "NAME")
+	writeAreas(filepath.Join(os.Args[4], "subdivisions.geojson.gz"), subdivisions, "iso_3166_2",
+		"name")
+	writeAreas(filepath.Join(os.Args[4], "timezones.geojson.gz"), timeZones, "tzid", "")
+}
+
+// readCountries reads the countries of a Natural Earth admin 0 file. Features with the same code
+// are merged (e.g. Australia and its dependencies), the name of the first feature is used.
+func readCountries(path string) []*area {
+	var fc featureCollection
+	readJson(path, &fc)
+
+	var countries []*area
+	byCode := map[string]*area{}
+	for _, f := range fc.Features {
+		code := getProperty(f.Properties, "ISO_A2_EH", "ISO_A2", "iso_a2")
+		fixed := false
+		if code == "" {
+			code = countryFixes[getProperty(f.Properties, "ADM0_A3", "adm0_a3")]
+			fixed = true
+		}
+		if code == "" || f.Geometry == nil {
+			log.Printf("Skipping country '%s' without code.", getProperty(f.Properties, "NAME",
+				"name"))
+			continue
+		}
+
+		c, ok := byCode[code]
+		if !ok {
+			c = &area{code, "", nil}
+			byCode[code] = c
+			countries = append(countries, c)
+		}
+		// The names of merged disputed areas are not used
+		if !fixed && c.name == "" {
+			c.name = getProperty(f.Properties, "NAME", "name")
+		}
+		c.polygons = append(c.polygons, readPolygons(f.Geometry)...)
+	}
+	return countries
+}
+
+// readSubdivisions reads the subdivisions of a Natural Earth admin 1 file. Features with the same
+// code are merged. Natural Earth uses codes with "~" for areas without official ISO 3166-2 code,
+// these areas are skipped. Subdivisions whose code doesn't start with the code of their country
+// (e.g. "NL-SX" for Sint Maarten) are skipped too.
+func readSubdivisions(path string) []*area {
+	var fc featureCollection
+	readJson(path, &fc)
+
+	var subdivisions []*area
+	byCode := map[string]*area{}
+	for _, f := range fc.Features {
+		code := getProperty(f.Properties, "iso_3166_2", "ISO_3166_2")
+		name := getProperty(f.Properties, "name", "NAME")
+		countryCode := getProperty(f.Properties, "iso_a2", "ISO_A2")
+		if code == "" || strings.Contains(code, "~") || f.Geometry == nil ||
+			!strings.HasPrefix(code, countryCode+"-") {
+			log.Printf("Skipping subdivision '%s' with code '%s'.", name, code)
+			continue
+		}
+
+		s, ok := byCode[code]
+		if !ok {
+			s = &area{code, name, nil}
+			byCode[code] = s
+			subdivisions = append(subdivisions, s)
+		}
+		s.polygons = append(s.polygons, readPolygons(f.Geometry)...)
+	}
+	return subdivisions
+}
+
+// readTimeZones reads the time zones of a timezone-boundary-builder file. Features with the same
+// name are merged. Time zones which are unknown to the tz database of this system are skipped.
+func readTimeZones(path string) []*area {
+	var fc featureCollection
+	readJson(path, &fc)
+
+	var timeZones []*area
+	byName := map[string]*area{}
+	for _, f := range fc.Features {
+		name := getProperty(f.Properties, "tzid", "TZID")
+		if _, err := time.LoadLocation(name); name == "" || err != nil || f.Geometry == nil {
+			log.Printf("Skipping unknown time zone '%s'.", name)
+			continue
+		}
+
+		tz, ok := byName[name]
+		if !ok {
+			tz = &area{name, "", nil}
+			byName[name] = tz
+			timeZones = append(timeZones, tz)
+		}
+		tz.polygons = append(tz.polygons, readPolygons(f.Geometry)...)
+	}
+	return timeZones
+}
+
+func writeAreas(path string, areas []*area, codeProp string, nameProp string) {
+	var fs []*feature
+	for _, a := range areas {
+		props := map[string]interface{}{codeProp: a.code}
+		if nameProp != "" {
+			props[nameProp] = a.name
+		}
+		fs = append(fs, newFeature(props, a.polygons))
+	}
+	writeFeatures(path, fs)
+	log.Printf("Wrote %d areas to '%s'.", len(fs), path)
+}
+
+func readPolygons(g *geometry) [][][][]float64 {
+	var polygons [][][][]float64
+	var err error
+	switch g.Type {
+	case "Polygon":
+		var polygon [][][]float64
+		err = json.Unmarshal(g.Coordinates, &polygon)
+		polygons = append(polygons, polygon)
+	case "MultiPolygon":
+		err = json.Unmarshal(g.Coordinates, &polygons)
+	}
+	if err != nil {
+		log.Fatalf("Could not parse geometry! (Error: %s)", err)
+	}
+	return polygons
+}
+
+// newFeature creates a feature with simplified polygons and rounded coordinates. Holes which
+// become too small are dropped.
+func newFeature(props map[string]interface{}, polygons [][][][]float64) *feature {
+	var simplified [][][][]float64
+	for _, polygon := range polygons {
+		var rings [][][]float64
+		for i, ring := range polygon {
+			r := simplifyRing(ring, simplifyTolerance)
+			// Keep small islands by simplifying them less
+			for t := simplifyTolerance / 2.0; i == 0 && len(r) < 4 && t >= 1; t /= 2 {
+				r = simplifyRing(ring, t)
+			}
+			if len(r) < 4 {
+				if i == 0 {
+					break
+				}
+				continue
+			}
+			rings = append(rings, r)
+		}
+		if len(rings) > 0 {
+			simplified = append(simplified, rings)
+		}
+	}
+
+	coords, err := json.Marshal(simplified)
+	if err != nil {
+		log.Fatalf("Could not serialize geometry! (Error: %s)", err)
+	}
+	return &feature{"Feature", props, &geometry{"MultiPolygon", coords}}
+}
+
+// simplifyRing simplifies a ring and rounds its coordinates. Positions which are equal after
+// rounding are dropped.
+func simplifyRing(ring [][]float64, tolerance float64) [][]float64 {
+	lats := make([]float64, len(ring))
+	lngs := make([]float64, len(ring))
+	for i, pos := range ring {
+		lngs[i] = pos[0]
+		lats[i] = pos[1]
+	}
+
+	var r [][]float64
+	for _, i := range util.SimplifyPath(lats, lngs, tolerance) {
+		p := []float64{roundCoord(lngs[i]), roundCoord(lats[i])}
+		if len(r) == 0 || p[0] != r[len(r)-1][0] || p[1] != r[len(r)-1][1] {
+			r = append(r, p)
+		}
+	}
+	return r
+}
+
+// writeFeatures writes a gzipped feature collection with one feature per line.
+func writeFeatures(path string, fs []*feature) {
+	var lines []string
+	for _, f := range fs {
+		line, err := json.Marshal(f)
+		if err != nil {
+			log.Fatalf("Could not serialize feature! (Error: %s)", err)
+		}
+		lines = append(lines, string(line))
+	}
+
+	content := "{\"type\":\"FeatureCollection\",\"features\":[\n" + strings.Join(lines, ",\n") +
+		"\n]}\n"
+
+	file, err := os.Create(path)
+	if err != nil {
+		log.Fatalf("Could not write file '%s'! (Error: %s)", path, err)
+	}
+	defer file.Close()
+	writer, _ := gzip.NewWriterLevel(file, gzip.BestCompression)
+	_, err = writer.Write([]byte(content))
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		log.Fatalf("Could not write file '%s'! (Error: %s)", path, err)
+	}
+}
+
+func readJson(path string, v interface{}) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("Could not read file '%s'! (Error: %s)", path, err)
+	}
+	err = json.Unmarshal(content, v)
+	if err != nil {
+		log.Fatalf("Could not parse file '%s'! (Error: %s)", path, err)
+	}
+}
+
+func getProperty(props map[string]interface{}, names ...string) string {
+	for _, name := range names {
+		if v, ok := props[name].(string); ok && v != "" && v != "-99" {
+			return v
+		}
+	}
+	return ""
+}
+
+func roundCoord(v float64) float64 {
+	return math.Round(v*coordPrecision) / coordPrecision
+}
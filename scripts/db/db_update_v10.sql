@@ -0,0 +1,8 @@
+ALTER TABLE location
+    ADD COLUMN local_time TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE location
+    ADD COLUMN time_zone TEXT NOT NULL DEFAULT '';
+
+UPDATE location
+    SET local_time = replace(time, ' ', 'T') || 'Z';
@@ -0,0 +1,26 @@
+ALTER TABLE location
+    ADD COLUMN lat_real REAL NOT NULL DEFAULT 0;
+
+ALTER TABLE location
+    ADD COLUMN lng_real REAL NOT NULL DEFAULT 0;
+
+UPDATE location
+    SET lat_real = CAST(lat AS REAL), lng_real = CAST(lng AS REAL);
+
+ALTER TABLE location
+    DROP COLUMN lat;
+
+ALTER TABLE location
+    DROP COLUMN lng;
+
+ALTER TABLE location
+    RENAME COLUMN lat_real TO lat;
+
+ALTER TABLE location
+    RENAME COLUMN lng_real TO lng;
+
+ALTER TABLE location
+    ADD COLUMN alt REAL;
+
+ALTER TABLE location
+    ADD COLUMN acc REAL;
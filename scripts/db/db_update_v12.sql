@@ -0,0 +1,7 @@
+ALTER TABLE location
+    ADD COLUMN end_time TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE location
+    ADD COLUMN end_local_time TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX location_time ON location (time);
@@ -0,0 +1,48 @@
+ALTER TABLE person
+    ADD COLUMN chng_time INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE person
+    ADD COLUMN nickname TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE person
+    ADD COLUMN email TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE person
+    ADD COLUMN phone TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE person
+    ADD COLUMN birthday TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE person
+    ADD COLUMN notes TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE person
+    ADD COLUMN avatar_hash TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE person
+    ADD COLUMN avatar_size INTEGER NOT NULL DEFAULT 0;
+
+UPDATE person
+    SET chng_time = CAST(strftime('%s', 'now') AS INTEGER);
+
+CREATE TABLE person_group (
+	id        INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT UNIQUE,
+	chng_time INTEGER NOT NULL,
+	name      TEXT NOT NULL,
+	desc      TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE person_group_member (
+	group_id  INTEGER NOT NULL,
+	person_id INTEGER NOT NULL,
+	PRIMARY KEY(group_id, person_id),
+	FOREIGN KEY(group_id) REFERENCES person_group(id) ON DELETE CASCADE,
+	FOREIGN KEY(person_id) REFERENCES person(id) ON DELETE CASCADE
+);
+
+CREATE INDEX person_group_member_person_id ON person_group_member (person_id);
+
+CREATE TABLE deleted_person_group (
+	id       INTEGER NOT NULL,
+	del_time INTEGER NOT NULL
+);
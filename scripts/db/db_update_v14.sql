@@ -0,0 +1,8 @@
+CREATE VIRTUAL TABLE location_search USING fts5(
+    name, description, persons, tokenize = 'unicode61 remove_diacritics 2');
+
+INSERT INTO location_search (rowid, name, description, persons)
+    SELECT l.id, COALESCE(l.name, ''), l.desc, COALESCE((SELECT group_concat(p.first_name || ' ' ||
+    p.last_name || CASE WHEN p.nickname = '' THEN '' ELSE ' ' || p.nickname END, ', ')
+    FROM location_person lp INNER JOIN person p ON lp.person_id = p.id
+    WHERE lp.location_id = l.id), '') FROM location l;
@@ -0,0 +1,4 @@
+CREATE VIRTUAL TABLE location_rtree USING rtree(id, min_lat, max_lat, min_lng, max_lng);
+
+INSERT INTO location_rtree (id, min_lat, max_lat, min_lng, max_lng)
+    SELECT id, lat, lat, lng, lng FROM location;
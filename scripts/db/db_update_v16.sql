@@ -0,0 +1,4 @@
+ALTER TABLE location
+    ADD COLUMN geohash TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX location_geohash ON location (geohash);
@@ -0,0 +1,20 @@
+CREATE INDEX track_point_lat_lng ON track_point (lat, lng);
+
+INSERT INTO setting (key, value) VALUES ('heatmap_revision', '0');
+
+CREATE TRIGGER location_insert_heatmap AFTER INSERT ON location
+	BEGIN UPDATE setting SET value = value + 1 WHERE key = 'heatmap_revision'; END;
+CREATE TRIGGER location_update_heatmap AFTER UPDATE ON location
+	BEGIN UPDATE setting SET value = value + 1 WHERE key = 'heatmap_revision'; END;
+CREATE TRIGGER location_delete_heatmap AFTER DELETE ON location
+	BEGIN UPDATE setting SET value = value + 1 WHERE key = 'heatmap_revision'; END;
+CREATE TRIGGER location_person_insert_heatmap AFTER INSERT ON location_person
+	BEGIN UPDATE setting SET value = value + 1 WHERE key = 'heatmap_revision'; END;
+CREATE TRIGGER location_person_delete_heatmap AFTER DELETE ON location_person
+	BEGIN UPDATE setting SET value = value + 1 WHERE key = 'heatmap_revision'; END;
+CREATE TRIGGER track_point_insert_heatmap AFTER INSERT ON track_point
+	BEGIN UPDATE setting SET value = value + 1 WHERE key = 'heatmap_revision'; END;
+CREATE TRIGGER track_point_update_heatmap AFTER UPDATE ON track_point
+	BEGIN UPDATE setting SET value = value + 1 WHERE key = 'heatmap_revision'; END;
+CREATE TRIGGER track_point_delete_heatmap AFTER DELETE ON track_point
+	BEGIN UPDATE setting SET value = value + 1 WHERE key = 'heatmap_revision'; END;
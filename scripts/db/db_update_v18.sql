@@ -0,0 +1,8 @@
+ALTER TABLE location
+    ADD COLUMN country TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE location
+    ADD COLUMN region TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE location
+    ADD COLUMN city TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,12 @@
+CREATE TABLE location_boundary (
+	location_id      INTEGER NOT NULL PRIMARY KEY UNIQUE,
+	lat              REAL NOT NULL,
+	lng              REAL NOT NULL,
+	country_code     TEXT NOT NULL,
+	subdivision_code TEXT NOT NULL,
+	FOREIGN KEY(location_id) REFERENCES location(id) ON DELETE CASCADE
+);
+
+CREATE INDEX location_boundary_country_code ON location_boundary (country_code);
+
+INSERT INTO setting (key, value) VALUES ('boundary_version', '');
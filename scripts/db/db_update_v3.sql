@@ -0,0 +1,4 @@
+CREATE TABLE deleted_person (
+	id       INTEGER NOT NULL,
+	del_time INTEGER NOT NULL
+);
@@ -0,0 +1,18 @@
+CREATE TABLE tag (
+	id        INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT UNIQUE,
+	chng_time INTEGER NOT NULL,
+	name      TEXT NOT NULL UNIQUE COLLATE NOCASE
+);
+
+CREATE TABLE location_tag (
+	location_id INTEGER NOT NULL,
+	tag_id      INTEGER NOT NULL,
+	PRIMARY KEY(location_id, tag_id),
+	FOREIGN KEY(location_id) REFERENCES location(id) ON DELETE CASCADE,
+	FOREIGN KEY(tag_id) REFERENCES tag(id) ON DELETE CASCADE
+);
+
+CREATE TABLE deleted_tag (
+	id       INTEGER NOT NULL,
+	del_time INTEGER NOT NULL
+);
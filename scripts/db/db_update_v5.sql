@@ -0,0 +1,16 @@
+CREATE TABLE attachment (
+	id           INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT UNIQUE,
+	location_id  INTEGER NOT NULL,
+	hash         TEXT NOT NULL,
+	file_name    TEXT NOT NULL,
+	content_type TEXT NOT NULL,
+	size         INTEGER NOT NULL,
+	width        INTEGER NOT NULL DEFAULT 0,
+	height       INTEGER NOT NULL DEFAULT 0,
+	crt_time     INTEGER NOT NULL,
+	FOREIGN KEY(location_id) REFERENCES location(id) ON DELETE CASCADE
+);
+
+CREATE INDEX attachment_location_id ON attachment (location_id);
+
+CREATE INDEX attachment_hash ON attachment (hash);
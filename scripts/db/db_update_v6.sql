@@ -0,0 +1,25 @@
+CREATE TABLE trip (
+	id         INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT UNIQUE,
+	chng_time  INTEGER NOT NULL,
+	name       TEXT NOT NULL,
+	start_time TEXT NOT NULL DEFAULT '',
+	end_time   TEXT NOT NULL DEFAULT '',
+	desc       TEXT NOT NULL DEFAULT '',
+	cover_id   INTEGER,
+	FOREIGN KEY(cover_id) REFERENCES attachment(id) ON DELETE SET NULL
+);
+
+CREATE TABLE trip_location (
+	trip_id     INTEGER NOT NULL,
+	location_id INTEGER NOT NULL,
+	PRIMARY KEY(trip_id, location_id),
+	FOREIGN KEY(trip_id) REFERENCES trip(id) ON DELETE CASCADE,
+	FOREIGN KEY(location_id) REFERENCES location(id) ON DELETE CASCADE
+);
+
+CREATE INDEX trip_location_location_id ON trip_location (location_id);
+
+CREATE TABLE deleted_trip (
+	id       INTEGER NOT NULL,
+	del_time INTEGER NOT NULL
+);
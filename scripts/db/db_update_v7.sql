@@ -0,0 +1,17 @@
+CREATE TABLE location_meta (
+	location_id INTEGER NOT NULL,
+	key         TEXT NOT NULL,
+	type        TEXT NOT NULL,
+	value       TEXT NOT NULL,
+	PRIMARY KEY(location_id, key),
+	FOREIGN KEY(location_id) REFERENCES location(id) ON DELETE CASCADE
+);
+
+CREATE INDEX location_meta_key ON location_meta (key, value);
+
+CREATE TABLE meta_field (
+	key      TEXT NOT NULL PRIMARY KEY UNIQUE,
+	type     TEXT NOT NULL,
+	required INTEGER NOT NULL DEFAULT 0,
+	desc     TEXT NOT NULL DEFAULT ''
+);
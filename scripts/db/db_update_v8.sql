@@ -0,0 +1,26 @@
+CREATE TABLE track (
+	id        INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT UNIQUE,
+	chng_time INTEGER NOT NULL,
+	name      TEXT NOT NULL,
+	desc      TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE track_point (
+	track_id INTEGER NOT NULL,
+	time     INTEGER NOT NULL,
+	lat      REAL NOT NULL,
+	lng      REAL NOT NULL,
+	alt      REAL,
+	acc      REAL,
+	speed    REAL,
+	bearing  REAL,
+	PRIMARY KEY(track_id, time),
+	FOREIGN KEY(track_id) REFERENCES track(id) ON DELETE CASCADE
+) WITHOUT ROWID;
+
+CREATE INDEX track_point_time ON track_point (time);
+
+CREATE TABLE deleted_track (
+	id       INTEGER NOT NULL,
+	del_time INTEGER NOT NULL
+);
@@ -0,0 +1,19 @@
+CREATE TABLE place (
+	id        INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT UNIQUE,
+	chng_time INTEGER NOT NULL,
+	name      TEXT NOT NULL,
+	lat       REAL NOT NULL,
+	lng       REAL NOT NULL,
+	radius    REAL NOT NULL,
+	desc      TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE deleted_place (
+	id       INTEGER NOT NULL,
+	del_time INTEGER NOT NULL
+);
+
+ALTER TABLE location
+    ADD COLUMN place_id INTEGER REFERENCES place(id) ON DELETE SET NULL;
+
+CREATE INDEX location_place_id ON location (place_id);
@@ -0,0 +1,92 @@
+//go:build ignore
+
+// This program creates the city file which is compiled into the server from a GeoNames cities file
+// (CC BY 4.0). The regions of the cities are determined with the subdivision boundaries of the
+// server. See README for details.
+//
+// Usage: go run scripts/geonames/generate.go <cities.txt> <output directory>
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"kellnhofer.com/tracker/storage"
+)
+
+func main() {
+	if len(os.Args) != 3 {
+		fmt.Println("Usage: go run scripts/geonames/generate.go <cities.txt> <output dir>")
+		os.Exit(1)
+	}
+
+	bStore := storage.NewBoundaryStore()
+	lines := readCities(os.Args[1], bStore)
+	writeCities(filepath.Join(os.Args[2], "cities.txt.gz"), lines)
+}
+
+// readCities reads the cities of a GeoNames cities file. The relevant columns are the name (1),
+// latitude (4), longitude (5) and country code (8). The cities are converted into lines with the
+// tab separated name, latitude, longitude, country code and region name.
+func readCities(path string, bStore *storage.BoundaryStore) []string {
+	file, err := os.Open(path)
+	if err != nil {
+		log.Fatalf("Could not read file '%s'! (Error: %s)", path, err)
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < 9 {
+			continue
+		}
+		lat, errLat := strconv.ParseFloat(fields[4], 64)
+		lng, errLng := strconv.ParseFloat(fields[5], 64)
+		if errLat != nil || errLng != nil || fields[1] == "" {
+			log.Printf("Skipping invalid city '%s'.", fields[1])
+			continue
+		}
+		country := fields[8]
+
+		// Subdivisions of other countries (e.g. near a border) are not used
+		region := ""
+		_, subdivision := bStore.FindBoundaries(lat, lng)
+		if strings.HasPrefix(subdivision, country+"-") {
+			region = bStore.GetName(subdivision)
+		}
+
+		lines = append(lines, strings.Join([]string{fields[1],
+			strconv.FormatFloat(lat, 'f', 4, 64), strconv.FormatFloat(lng, 'f', 4, 64), country,
+			region}, "\t"))
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatalf("Could not read file '%s'! (Error: %s)", path, err)
+	}
+	return lines
+}
+
+func writeCities(path string, lines []string) {
+	file, err := os.Create(path)
+	if err != nil {
+		log.Fatalf("Could not write file '%s'! (Error: %s)", path, err)
+	}
+	defer file.Close()
+
+	writer, _ := gzip.NewWriterLevel(file, gzip.BestCompression)
+	_, err = writer.Write([]byte(strings.Join(lines, "\n") + "\n"))
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		log.Fatalf("Could not write file '%s'! (Error: %s)", path, err)
+	}
+	log.Printf("Wrote %d cities to '%s'.", len(lines), path)
+}
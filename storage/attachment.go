@@ -0,0 +1,244 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	// Register image decoders
+	_ "image/gif"
+	_ "image/png"
+)
+
+// ThumbnailSizes maps the thumbnail size names to the maximum edge length in pixels.
+var ThumbnailSizes = map[string]int{
+	"small":  160,
+	"medium": 480,
+	"large":  1024,
+}
+
+// maxThumbnailPixels is the maximum number of pixels of an image for which thumbnails are created.
+// Larger images are not decoded to limit the memory usage.
+const maxThumbnailPixels = 50000000
+
+type AttachmentStore struct {
+	dir string
+}
+
+func NewAttachmentStore(dir string) *AttachmentStore {
+	err := os.MkdirAll(filepath.Join(dir, "thumbs"), 0755)
+	if err != nil {
+		log.Fatalf("Could not create attachment directory! (Error: %s)", err)
+	}
+
+	return &AttachmentStore{dir}
+}
+
+// --- Public methods ---
+
+// SaveFile stores the content of a file under its SHA-256 hash. It returns the hash, the size and
+// whether the content was not stored before.
+func (s AttachmentStore) SaveFile(content io.Reader) (string, int64, bool, error) {
+	tmpFile, err := ioutil.TempFile(s.dir, "upload-")
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to store attachment! (%s)", err)
+		return "", 0, false, errors.New(e)
+	}
+	tmpPath := tmpFile.Name()
+	defer os.Remove(tmpPath)
+
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmpFile, hasher), content)
+	tmpFile.Close()
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to store attachment! (%s)", err)
+		return "", 0, false, errors.New(e)
+	}
+
+	hash := hex.EncodeToString(hasher.Sum(nil))
+	path := s.getFilePath(hash)
+
+	if _, err := os.Stat(path); err == nil {
+		return hash, size, false, nil
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to store attachment! (%s)", err)
+		return "", 0, false, errors.New(e)
+	}
+
+	return hash, size, true, nil
+}
+
+// CreateThumbnails creates JPEG thumbnails in all sizes of ThumbnailSizes. If the file is not a
+// supported image or larger than maxThumbnailPixels, no thumbnails are created and false is
+// returned. Otherwise the dimensions of the original image are returned.
+func (s AttachmentStore) CreateThumbnails(hash string) (bool, int, int, error) {
+	file, err := os.Open(s.getFilePath(hash))
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to create thumbnails! (%s)", err)
+		return false, 0, 0, errors.New(e)
+	}
+	defer file.Close()
+
+	// Check the image dimensions before decoding the whole image
+	cfg, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return false, 0, 0, nil
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > maxThumbnailPixels {
+		log.Printf("Image '%s' is too large for thumbnails! (%dx%d)", hash, cfg.Width,
+			cfg.Height)
+		return false, 0, 0, nil
+	}
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to create thumbnails! (%s)", err)
+		return false, 0, 0, errors.New(e)
+	}
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return false, 0, 0, nil
+	}
+	bounds := img.Bounds()
+
+	for name, size := range ThumbnailSizes {
+		err = s.writeThumbnail(s.getThumbnailPath(hash, name), scaleImage(img, size))
+		if err != nil {
+			log.Print(err)
+			e := fmt.Sprintf("Failed to create thumbnails! (%s)", err)
+			return false, 0, 0, errors.New(e)
+		}
+	}
+
+	return true, bounds.Dx(), bounds.Dy(), nil
+}
+
+func (s AttachmentStore) OpenFile(hash string) (*os.File, error) {
+	return os.Open(s.getFilePath(hash))
+}
+
+func (s AttachmentStore) OpenThumbnail(hash string, size string) (*os.File, error) {
+	return os.Open(s.getThumbnailPath(hash, size))
+}
+
+// DeleteFile deletes the content and all thumbnails of a file.
+func (s AttachmentStore) DeleteFile(hash string) error {
+	err := os.Remove(s.getFilePath(hash))
+	if err != nil && !os.IsNotExist(err) {
+		log.Print(err)
+		e := fmt.Sprintf("Failed to delete attachment! (%s)", err)
+		return errors.New(e)
+	}
+
+	for name := range ThumbnailSizes {
+		err = os.Remove(s.getThumbnailPath(hash, name))
+		if err != nil && !os.IsNotExist(err) {
+			log.Print(err)
+			e := fmt.Sprintf("Failed to delete attachment thumbnail! (%s)", err)
+			return errors.New(e)
+		}
+	}
+
+	return nil
+}
+
+// --- Private methods ---
+
+func (s AttachmentStore) getFilePath(hash string) string {
+	return filepath.Join(s.dir, hash[:2], hash)
+}
+
+func (s AttachmentStore) getThumbnailPath(hash string, size string) string {
+	return filepath.Join(s.dir, "thumbs", fmt.Sprintf("%s_%s.jpg", hash, size))
+}
+
+func (s AttachmentStore) writeThumbnail(path string, img image.Image) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return jpeg.Encode(file, img, &jpeg.Options{Quality: 85})
+}
+
+// scaleImage scales an image down so that its longest edge is at most maxSize pixels. Each target
+// pixel is the average of the source pixels it covers.
+func scaleImage(src image.Image, maxSize int) image.Image {
+	sb := src.Bounds()
+	sw := sb.Dx()
+	sh := sb.Dy()
+
+	dw := sw
+	dh := sh
+	if sw > maxSize || sh > maxSize {
+		if sw >= sh {
+			dw = maxSize
+			dh = sh * maxSize / sw
+		} else {
+			dh = maxSize
+			dw = sw * maxSize / sh
+		}
+	}
+	if dw < 1 {
+		dw = 1
+	}
+	if dh < 1 {
+		dh = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for dy := 0; dy < dh; dy++ {
+		sy0 := sb.Min.Y + dy*sh/dh
+		sy1 := sb.Min.Y + (dy+1)*sh/dh
+		if sy1 <= sy0 {
+			sy1 = sy0 + 1
+		}
+		for dx := 0; dx < dw; dx++ {
+			sx0 := sb.Min.X + dx*sw/dw
+			sx1 := sb.Min.X + (dx+1)*sw/dw
+			if sx1 <= sx0 {
+				sx1 = sx0 + 1
+			}
+
+			var r, g, b, a, n uint64
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					pr, pg, pb, pa := src.At(sx, sy).RGBA()
+					r += uint64(pr)
+					g += uint64(pg)
+					b += uint64(pb)
+					a += uint64(pa)
+					n++
+				}
+			}
+
+			i := dst.PixOffset(dx, dy)
+			dst.Pix[i+0] = uint8(r / n >> 8)
+			dst.Pix[i+1] = uint8(g / n >> 8)
+			dst.Pix[i+2] = uint8(b / n >> 8)
+			dst.Pix[i+3] = uint8(a / n >> 8)
+		}
+	}
+
+	return dst
+}
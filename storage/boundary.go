@@ -0,0 +1,289 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"math"
+	"strings"
+
+	"kellnhofer.com/tracker/util"
+)
+
+// The gzipped boundary files are compiled into the binary. (See README for how they are created.)
+//
+//go:embed boundaries/countries.geojson.gz boundaries/subdivisions.geojson.gz
+//go:embed boundaries/timezones.geojson.gz
+var boundaryFiles embed.FS
+
+// Property names of the boundary codes and names. (The upper case names are used by Natural
+// Earth admin 0 files.)
+var (
+	countryCodeProps     = []string{"ISO_A2_EH", "ISO_A2", "iso_a2"}
+	subdivisionCodeProps = []string{"iso_3166_2", "ISO_3166_2"}
+	timeZoneProps        = []string{"tzid", "TZID"}
+	nameProps            = []string{"NAME", "name", "ADMIN", "admin"}
+)
+
+// boundaryTolerance is the distance in meters within which coordinates outside of all boundaries
+// are assigned to the nearest boundary. The bundled boundaries are simplified, so coordinates on
+// a coast or a border may be slightly outside of them.
+const boundaryTolerance = 25000
+
+// BoundaryStore contains the country, subdivision (e.g. state) and time zone boundaries for
+// point-in-polygon lookups. Countries are identified by their ISO 3166-1 alpha-2 code,
+// subdivisions by their ISO 3166-2 code and time zones by their IANA name.
+type BoundaryStore struct {
+	countries    []*boundary
+	subdivisions []*boundary
+	timeZones    []*boundary
+	names        map[string]string
+	version      string
+}
+
+type boundary struct {
+	code        string
+	countryCode string
+	// Bounding box: min lng, min lat, max lng, max lat
+	bbox     [4]float64
+	polygons [][][][]float64
+}
+
+type geoJsonFeatures struct {
+	Features []struct {
+		Properties map[string]interface{} `json:"properties"`
+		Geometry   *struct {
+			Type        string          `json:"type"`
+			Coordinates json.RawMessage `json:"coordinates"`
+		} `json:"geometry"`
+	} `json:"features"`
+}
+
+func NewBoundaryStore() *BoundaryStore {
+	s := &BoundaryStore{names: map[string]string{}}
+	hasher := sha256.New()
+
+	content := readBoundaryFile("boundaries/countries.geojson.gz")
+	hasher.Write(content)
+	s.countries = s.parseBoundaries(content, countryCodeProps)
+
+	content = readBoundaryFile("boundaries/subdivisions.geojson.gz")
+	hasher.Write(content)
+	s.subdivisions = s.parseBoundaries(content, subdivisionCodeProps)
+
+	content = readBoundaryFile("boundaries/timezones.geojson.gz")
+	hasher.Write(content)
+	s.timeZones = s.parseBoundaries(content, timeZoneProps)
+
+	s.version = hex.EncodeToString(hasher.Sum(nil))[:16]
+
+	if len(s.countries) == 0 && len(s.subdivisions) == 0 {
+		log.Printf("No boundary data available. Country lookup is disabled.")
+	}
+	if len(s.timeZones) == 0 {
+		log.Printf("No time zone boundaries available. Time zones are derived from cities.")
+	}
+
+	return s
+}
+
+// --- Public methods ---
+
+// Version returns a hash of the boundary data. It changes if other boundary files are embedded.
+func (s BoundaryStore) Version() string {
+	return s.version
+}
+
+// FindBoundaries returns the codes of the country and the subdivision which contain a coordinate
+// or are nearest to it (within the tolerance). An empty code is returned if there is no such
+// country or subdivision.
+func (s BoundaryStore) FindBoundaries(lat float64, lng float64) (string, string) {
+	country := findBoundary(s.countries, lat, lng, "")
+	subdivision := findBoundary(s.subdivisions, lat, lng, country.codeOrEmpty())
+	if subdivision == nil {
+		return country.codeOrEmpty(), ""
+	}
+	// Boundary files don't match exactly at borders, the subdivision is more precise then
+	return subdivision.countryCode, subdivision.code
+}
+
+// HasTimeZones returns true if time zone boundaries are available.
+func (s BoundaryStore) HasTimeZones() bool {
+	return len(s.timeZones) > 0
+}
+
+// FindTimeZone returns the IANA name of the time zone which contains a coordinate. An empty name
+// is returned if there is no such time zone.
+func (s BoundaryStore) FindTimeZone(lat float64, lng float64) string {
+	return findBoundary(s.timeZones, lat, lng, "").codeOrEmpty()
+}
+
+// GetName returns the name of a country or subdivision.
+func (s BoundaryStore) GetName(code string) string {
+	return s.names[code]
+}
+
+// --- Private methods ---
+
+func (s BoundaryStore) parseBoundaries(content []byte, codeProps []string) []*boundary {
+	var features geoJsonFeatures
+	err := json.Unmarshal(content, &features)
+	if err != nil {
+		log.Fatalf("Could not parse boundary file! (Error: %s)", err)
+	}
+
+	var bs []*boundary
+	for _, f := range features.Features {
+		code := getStringProperty(f.Properties, codeProps)
+		if code == "" || f.Geometry == nil {
+			continue
+		}
+
+		var polygons [][][][]float64
+		switch f.Geometry.Type {
+		case "Polygon":
+			var polygon [][][]float64
+			err = json.Unmarshal(f.Geometry.Coordinates, &polygon)
+			polygons = append(polygons, polygon)
+		case "MultiPolygon":
+			err = json.Unmarshal(f.Geometry.Coordinates, &polygons)
+		default:
+			continue
+		}
+		if err != nil {
+			log.Fatalf("Could not parse boundary '%s'! (Error: %s)", code, err)
+		}
+
+		// Subdivision codes start with the country code (e.g. "DE-BY")
+		countryCode := strings.SplitN(code, "-", 2)[0]
+		bs = append(bs, &boundary{code, countryCode, getBoundingBox(polygons), polygons})
+		if name := getStringProperty(f.Properties, nameProps); name != "" {
+			s.names[code] = name
+		}
+	}
+	return bs
+}
+
+func (b *boundary) contains(lat float64, lng float64) bool {
+	if lng < b.bbox[0] || lat < b.bbox[1] || lng > b.bbox[2] || lat > b.bbox[3] {
+		return false
+	}
+	for _, polygon := range b.polygons {
+		if util.PointInPolygon(lat, lng, polygon) {
+			return true
+		}
+	}
+	return false
+}
+
+// distance returns the distance in meters between a coordinate outside of the boundary and the
+// boundary. If the coordinate is farther away than maxDist, +Inf may be returned instead.
+func (b *boundary) distance(lat float64, lng float64, maxDist float64) float64 {
+	// Skip boundaries whose bounding box is too far away
+	dLat := maxDist / util.EarthRadius * 180 / math.Pi
+	dLng := dLat / math.Max(math.Cos(lat*math.Pi/180), 0.01)
+	if lng < b.bbox[0]-dLng || lat < b.bbox[1]-dLat || lng > b.bbox[2]+dLng ||
+		lat > b.bbox[3]+dLat {
+		return math.Inf(1)
+	}
+	dist := math.Inf(1)
+	for _, polygon := range b.polygons {
+		dist = math.Min(dist, util.PolygonDistance(lat, lng, polygon))
+	}
+	return dist
+}
+
+func (b *boundary) codeOrEmpty() string {
+	if b == nil {
+		return ""
+	}
+	return b.code
+}
+
+// findBoundary returns the first boundary which contains a coordinate. Boundaries of the
+// preferred country are checked first. If no boundary contains the coordinate, the nearest
+// boundary within the tolerance is returned. (Only boundaries of the preferred country, if there
+// is one.)
+func findBoundary(bs []*boundary, lat float64, lng float64, countryCode string) *boundary {
+	if countryCode != "" {
+		for _, b := range bs {
+			if b.countryCode == countryCode && b.contains(lat, lng) {
+				return b
+			}
+		}
+	}
+	for _, b := range bs {
+		if b.countryCode != countryCode && b.contains(lat, lng) {
+			return b
+		}
+	}
+	return findNearestBoundary(bs, lat, lng, countryCode)
+}
+
+// findNearestBoundary returns the nearest boundary within the tolerance. If a country code is
+// given, only boundaries of this country are considered.
+func findNearestBoundary(bs []*boundary, lat float64, lng float64,
+	countryCode string) *boundary {
+	var nearest *boundary
+	minDist := float64(boundaryTolerance)
+	for _, b := range bs {
+		if countryCode != "" && b.countryCode != countryCode {
+			continue
+		}
+		if dist := b.distance(lat, lng, minDist); dist < minDist {
+			nearest = b
+			minDist = dist
+		}
+	}
+	return nearest
+}
+
+func getBoundingBox(polygons [][][][]float64) [4]float64 {
+	bbox := [4]float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	for _, polygon := range polygons {
+		if len(polygon) == 0 {
+			continue
+		}
+		// Holes are inside of the outer ring
+		for _, pos := range polygon[0] {
+			if len(pos) < 2 {
+				continue
+			}
+			bbox[0] = math.Min(bbox[0], pos[0])
+			bbox[1] = math.Min(bbox[1], pos[1])
+			bbox[2] = math.Max(bbox[2], pos[0])
+			bbox[3] = math.Max(bbox[3], pos[1])
+		}
+	}
+	return bbox
+}
+
+func getStringProperty(props map[string]interface{}, names []string) string {
+	for _, name := range names {
+		if v, ok := props[name].(string); ok && v != "" && v != "-99" {
+			return v
+		}
+	}
+	return ""
+}
+
+func readBoundaryFile(name string) []byte {
+	content, err := boundaryFiles.ReadFile(name)
+	if err != nil {
+		log.Fatalf("Could not read boundary file! (Error: %s)", err)
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(content))
+	if err != nil {
+		log.Fatalf("Could not read boundary file! (Error: %s)", err)
+	}
+	content, err = io.ReadAll(reader)
+	if err != nil {
+		log.Fatalf("Could not read boundary file! (Error: %s)", err)
+	}
+	return content
+}
@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	_ "embed"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"kellnhofer.com/tracker/model"
+	"kellnhofer.com/tracker/util"
+)
+
+// maxCityDistance is the maximum distance (in meters) between a coordinate and its nearest city.
+const maxCityDistance = 100000
+
+// Cities of GeoNames (CC BY 4.0), see README. Each line contains the tab separated name, latitude,
+// longitude, country code and region name of a city.
+//
+//go:embed cities/cities.txt.gz
+var bundledCities []byte
+
+// CityStore is an in-memory index of cities for offline reverse geocoding. The cities are loaded
+// from a GeoNames cities file (e.g. "cities15000.txt"). The region names are loaded from an
+// optional GeoNames admin1 codes file ("admin1CodesASCII.txt"). If no cities file is configured or
+// the file doesn't exist, the bundled cities are used.
+type CityStore struct {
+	cities []*model.City
+	index  *util.PointIndex
+}
+
+func NewCityStore(citiesFile string, regionsFile string) *CityStore {
+	if citiesFile == "" {
+		return newBundledCityStore()
+	}
+	if _, err := os.Stat(citiesFile); os.IsNotExist(err) {
+		log.Printf("City file '%s' not found. Using bundled cities.", citiesFile)
+		return newBundledCityStore()
+	}
+
+	regions := map[string]string{}
+	if regionsFile != "" {
+		err := readGeoNamesFile(regionsFile, func(fields []string) {
+			if len(fields) >= 2 {
+				regions[fields[0]] = fields[1]
+			}
+		})
+		if err != nil && !os.IsNotExist(err) {
+			log.Fatalf("Could not read region file! (Error: %s)", err)
+		}
+	}
+
+	var cities []*model.City
+	var lats []float64
+	var lngs []float64
+	err := readGeoNamesFile(citiesFile, func(fields []string) {
+		city := parseGeoNamesCity(fields, regions)
+		if city != nil {
+			cities = append(cities, city)
+			lats = append(lats, city.Lat)
+			lngs = append(lngs, city.Lng)
+		}
+	})
+	if err != nil {
+		log.Fatalf("Could not read city file! (Error: %s)", err)
+	}
+	log.Printf("Loaded %d cities for reverse geocoding.", len(cities))
+
+	return &CityStore{cities, util.NewPointIndex(lats, lngs)}
+}
+
+func newBundledCityStore() *CityStore {
+	reader, err := gzip.NewReader(bytes.NewReader(bundledCities))
+	if err != nil {
+		log.Fatalf("Could not read bundled cities! (Error: %s)", err)
+	}
+
+	var cities []*model.City
+	var lats []float64
+	var lngs []float64
+	err = readGeoNamesLines(reader, func(fields []string) {
+		city := parseBundledCity(fields)
+		if city != nil {
+			cities = append(cities, city)
+			lats = append(lats, city.Lat)
+			lngs = append(lngs, city.Lng)
+		}
+	})
+	if err != nil {
+		log.Fatalf("Could not read bundled cities! (Error: %s)", err)
+	}
+	log.Printf("Loaded %d bundled cities for reverse geocoding.", len(cities))
+
+	return &CityStore{cities, util.NewPointIndex(lats, lngs)}
+}
+
+// --- Public methods ---
+
+// IsEmpty returns true if no cities were loaded.
+func (s CityStore) IsEmpty() bool {
+	return len(s.cities) == 0
+}
+
+// FindNearestCity returns the city nearest to a coordinate. If there is no city nearby, nil is
+// returned.
+func (s CityStore) FindNearestCity(lat float64, lng float64) *model.City {
+	i, ok := s.index.Nearest(lat, lng, maxCityDistance)
+	if !ok {
+		return nil
+	}
+	return s.cities[i]
+}
+
+// --- Private methods ---
+
+// readGeoNamesFile calls handle with the tab separated fields of each line of a file.
+func readGeoNamesFile(name string, handle func(fields []string)) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return readGeoNamesLines(file, handle)
+}
+
+// readGeoNamesLines calls handle with the tab separated fields of each line of a reader. Comment
+// lines are skipped.
+func readGeoNamesLines(r io.Reader, handle func(fields []string)) error {
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		if line != "" && !strings.HasPrefix(line, "#") {
+			handle(strings.Split(line, "\t"))
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// parseGeoNamesCity parses a line of a GeoNames cities file. The relevant columns are the name
+// (1), latitude (4), longitude (5), country code (8), admin1 code (10) and time zone (17).
+func parseGeoNamesCity(fields []string, regions map[string]string) *model.City {
+	if len(fields) < 11 {
+		return nil
+	}
+	lat, err := strconv.ParseFloat(fields[4], 64)
+	if err != nil {
+		return nil
+	}
+	lng, err := strconv.ParseFloat(fields[5], 64)
+	if err != nil || !util.IsValidCoordinate(lat, lng) {
+		return nil
+	}
+	country := fields[8]
+	region := regions[country+"."+fields[10]]
+	timeZone := ""
+	if len(fields) > 17 {
+		timeZone = fields[17]
+	}
+	return &model.City{fields[1], country, region, lat, lng, timeZone}
+}
+
+// parseBundledCity parses a line of the bundled cities file. The columns are the name (0), latitude
+// (1), longitude (2), country code (3) and region name (4). The time zone is not included.
+func parseBundledCity(fields []string) *model.City {
+	if len(fields) < 5 {
+		return nil
+	}
+	lat, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return nil
+	}
+	lng, err := strconv.ParseFloat(fields[2], 64)
+	if err != nil || !util.IsValidCoordinate(lat, lng) {
+		return nil
+	}
+	return &model.City{fields[0], fields[3], fields[4], lat, lng, ""}
+}
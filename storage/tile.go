@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"container/list"
+	"sync"
+)
+
+type tileCacheEntry struct {
+	key  string
+	data []byte
+}
+
+// TileCache is an in-memory LRU cache for rendered map tiles. All tiles belong to a revision of the
+// data. If a tile of another revision is stored, the cache is cleared.
+type TileCache struct {
+	mutex    sync.Mutex
+	maxBytes int
+	bytes    int
+	revision string
+	entries  map[string]*list.Element
+	order    *list.List
+}
+
+func NewTileCache(maxBytes int) *TileCache {
+	return &TileCache{maxBytes: maxBytes, entries: map[string]*list.Element{}, order: list.New()}
+}
+
+// --- Public methods ---
+
+// Get returns the cached tile or nil if the tile is not cached.
+func (c *TileCache) Get(revision string, key string) []byte {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if revision != c.revision {
+		return nil
+	}
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*tileCacheEntry).data
+}
+
+// Put stores a tile. The least recently used tiles are removed if the cache is full.
+func (c *TileCache) Put(revision string, key string, data []byte) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if revision != c.revision {
+		c.entries = map[string]*list.Element{}
+		c.order.Init()
+		c.bytes = 0
+		c.revision = revision
+	}
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+
+	c.entries[key] = c.order.PushFront(&tileCacheEntry{key, data})
+	c.bytes += len(data)
+
+	for c.bytes > c.maxBytes && c.order.Len() > 0 {
+		c.remove(c.order.Back())
+	}
+}
+
+// --- Private methods ---
+
+func (c *TileCache) remove(elem *list.Element) {
+	entry := elem.Value.(*tileCacheEntry)
+	c.order.Remove(elem)
+	delete(c.entries, entry.key)
+	c.bytes -= len(entry.data)
+}
@@ -14,6 +14,7 @@ import (
 	"kellnhofer.com/tracker/data"
 	"kellnhofer.com/tracker/middleware"
 	"kellnhofer.com/tracker/repo"
+	"kellnhofer.com/tracker/storage"
 )
 
 func createRoute(route *negroni.Negroni, handler http.HandlerFunc) http.Handler {
@@ -33,9 +34,48 @@ func main() {
 
 	// Create repos
 	locRepo := repo.NewLocationRepo(db)
+	perRepo := repo.NewPersonRepo(db)
+	tagRepo := repo.NewTagRepo(db)
+	attRepo := repo.NewAttachmentRepo(db)
+	tripRepo := repo.NewTripRepo(db)
+	metaRepo := repo.NewMetaRepo(db)
+	trackRepo := repo.NewTrackRepo(db)
+	placeRepo := repo.NewPlaceRepo(db)
+	groupRepo := repo.NewGroupRepo(db)
+	heatmapRepo := repo.NewHeatmapRepo(db)
+
+	// Compute missing location geohashes (e.g. after a database update)
+	err := locRepo.UpdateMissingGeohashes()
+	if err != nil {
+		log.Fatalf("Could not update location geohashes! (Error: %s)", err)
+	}
+
+	// Create stores
+	attStore := storage.NewAttachmentStore("./data/attachments")
+	cityStore := storage.NewCityStore(conf.CitiesFile, conf.RegionsFile)
+	boundaryStore := storage.NewBoundaryStore()
+
+	// Drop cached location countries if the boundary data has changed
+	err = locRepo.InvalidateLocationBoundaries(boundaryStore.Version())
+	if err != nil {
+		log.Fatalf("Could not invalidate location boundaries! (Error: %s)", err)
+	}
 
 	// Create controllers
-	locCtrl := controller.NewLocationController(locRepo)
+	locCtrl := controller.NewLocationController(locRepo, attRepo, metaRepo, placeRepo,
+		trackRepo, tripRepo, attStore, cityStore, boundaryStore)
+	perCtrl := controller.NewPersonController(conf, perRepo, attRepo, attStore)
+	tagCtrl := controller.NewTagController(tagRepo)
+	attCtrl := controller.NewAttachmentController(conf, locRepo, attRepo, attStore)
+	tripCtrl := controller.NewTripController(tripRepo, locRepo, attRepo)
+	metaCtrl := controller.NewMetaController(metaRepo)
+	trackCtrl := controller.NewTrackController(trackRepo)
+	placeCtrl := controller.NewPlaceController(placeRepo, locRepo)
+	groupCtrl := controller.NewGroupController(groupRepo, perRepo)
+	searchCtrl := controller.NewSearchController(locRepo)
+	statsCtrl := controller.NewStatsController(locRepo, boundaryStore)
+	heatmapCtrl := controller.NewHeatmapController(heatmapRepo)
+	timelineCtrl := controller.NewTimelineController(locRepo)
 
 	// Create router
 	router := mux.NewRouter().StrictSlash(true)
@@ -55,6 +95,14 @@ func main() {
 	apiRoute.Methods("POST").
 		Path("/loc").
 		Handler(locCtrl.CreateLocationHandler())
+	// GET /loc/clusters
+	apiRoute.Methods("GET").
+		Path("/loc/clusters").
+		Handler(locCtrl.GetLocationClustersHandler())
+	// POST /loc/geocode
+	apiRoute.Methods("POST").
+		Path("/loc/geocode").
+		Handler(locCtrl.GeocodeLocationsHandler())
 	// GET /loc/deleted
 	apiRoute.Methods("GET").
 		Path("/loc/deleted").
@@ -76,6 +124,341 @@ func main() {
 	apiRoute.Methods("DELETE").
 		Path("/loc/{id}").
 		Handler(locCtrl.DeleteLocationHandler())
+	// GET /loc/{id}/attachments
+	apiRoute.Methods("GET").
+		Path("/loc/{id}/attachments").
+		Handler(attCtrl.GetAttachmentsHandler())
+	// POST /loc/{id}/attachments
+	apiRoute.Methods("POST").
+		Path("/loc/{id}/attachments").
+		Handler(attCtrl.CreateAttachmentHandler())
+	// GET /loc/{id}/attachments/{attachment_id}
+	apiRoute.Methods("GET").
+		Path("/loc/{id}/attachments/{attachment_id}").
+		Handler(attCtrl.GetAttachmentHandler())
+	// GET /loc/{id}/attachments/{attachment_id}/thumbnail?size={size}
+	apiRoute.Methods("GET").
+		Path("/loc/{id}/attachments/{attachment_id}/thumbnail").
+		Handler(attCtrl.GetAttachmentThumbnailHandler())
+	// DELETE /loc/{id}/attachments/{attachment_id}
+	apiRoute.Methods("DELETE").
+		Path("/loc/{id}/attachments/{attachment_id}").
+		Handler(attCtrl.DeleteAttachmentHandler())
+	// GET /person
+	apiRoute.Methods("GET").
+		Path("/person").
+		Handler(perCtrl.GetPersonsHandler())
+	// GET /person?change_time={change_time}
+	apiRoute.Methods("GET").
+		Path("/person").
+		Queries("change_time", "{change_time}").
+		Handler(perCtrl.GetPersonsHandler())
+	// POST /person
+	apiRoute.Methods("POST").
+		Path("/person").
+		Handler(perCtrl.CreatePersonHandler())
+	// GET /person/duplicates
+	apiRoute.Methods("GET").
+		Path("/person/duplicates").
+		Handler(perCtrl.GetDuplicatePersonsHandler())
+	// POST /person/merge
+	apiRoute.Methods("POST").
+		Path("/person/merge").
+		Handler(perCtrl.MergePersonsHandler())
+	// GET /person/deleted
+	apiRoute.Methods("GET").
+		Path("/person/deleted").
+		Handler(perCtrl.GetDeletedPersonIdsHandler())
+	// GET /person/deleted?deletion_time={deletion_time}
+	apiRoute.Methods("GET").
+		Path("/person/deleted").
+		Queries("deletion_time", "{deletion_time}").
+		Handler(perCtrl.GetDeletedPersonIdsHandler())
+	// GET /person/{id}
+	apiRoute.Methods("GET").
+		Path("/person/{id}").
+		Handler(perCtrl.GetPersonHandler())
+	// PUT /person/{id}
+	apiRoute.Methods("PUT").
+		Path("/person/{id}").
+		Handler(perCtrl.ChangePersonHandler())
+	// GET /person/{id}/avatar?size={size}
+	apiRoute.Methods("GET").
+		Path("/person/{id}/avatar").
+		Handler(perCtrl.GetPersonAvatarHandler())
+	// PUT /person/{id}/avatar
+	apiRoute.Methods("PUT").
+		Path("/person/{id}/avatar").
+		Handler(perCtrl.ChangePersonAvatarHandler())
+	// DELETE /person/{id}/avatar
+	apiRoute.Methods("DELETE").
+		Path("/person/{id}/avatar").
+		Handler(perCtrl.DeletePersonAvatarHandler())
+	// GET /person/{id}/companions
+	apiRoute.Methods("GET").
+		Path("/person/{id}/companions").
+		Handler(perCtrl.GetPersonCompanionsHandler())
+	// GET /graph/persons
+	apiRoute.Methods("GET").
+		Path("/graph/persons").
+		Handler(perCtrl.GetPersonGraphHandler())
+	// GET /tag
+	apiRoute.Methods("GET").
+		Path("/tag").
+		Handler(tagCtrl.GetTagsHandler())
+	// GET /tag?change_time={change_time}
+	apiRoute.Methods("GET").
+		Path("/tag").
+		Queries("change_time", "{change_time}").
+		Handler(tagCtrl.GetTagsHandler())
+	// POST /tag
+	apiRoute.Methods("POST").
+		Path("/tag").
+		Handler(tagCtrl.CreateTagHandler())
+	// POST /tag/merge
+	apiRoute.Methods("POST").
+		Path("/tag/merge").
+		Handler(tagCtrl.MergeTagsHandler())
+	// GET /tag/deleted
+	apiRoute.Methods("GET").
+		Path("/tag/deleted").
+		Handler(tagCtrl.GetDeletedTagIdsHandler())
+	// GET /tag/deleted?deletion_time={deletion_time}
+	apiRoute.Methods("GET").
+		Path("/tag/deleted").
+		Queries("deletion_time", "{deletion_time}").
+		Handler(tagCtrl.GetDeletedTagIdsHandler())
+	// GET /tag/{id}
+	apiRoute.Methods("GET").
+		Path("/tag/{id}").
+		Handler(tagCtrl.GetTagHandler())
+	// PUT /tag/{id}
+	apiRoute.Methods("PUT").
+		Path("/tag/{id}").
+		Handler(tagCtrl.ChangeTagHandler())
+	// DELETE /tag/{id}
+	apiRoute.Methods("DELETE").
+		Path("/tag/{id}").
+		Handler(tagCtrl.DeleteTagHandler())
+
+	// GET /trip
+	apiRoute.Methods("GET").
+		Path("/trip").
+		Handler(tripCtrl.GetTripsHandler())
+	// GET /trip?change_time={change_time}
+	apiRoute.Methods("GET").
+		Path("/trip").
+		Queries("change_time", "{change_time}").
+		Handler(tripCtrl.GetTripsHandler())
+	// POST /trip
+	apiRoute.Methods("POST").
+		Path("/trip").
+		Handler(tripCtrl.CreateTripHandler())
+	// GET /trip/deleted
+	apiRoute.Methods("GET").
+		Path("/trip/deleted").
+		Handler(tripCtrl.GetDeletedTripIdsHandler())
+	// GET /trip/deleted?deletion_time={deletion_time}
+	apiRoute.Methods("GET").
+		Path("/trip/deleted").
+		Queries("deletion_time", "{deletion_time}").
+		Handler(tripCtrl.GetDeletedTripIdsHandler())
+	// GET /trip/{id}
+	apiRoute.Methods("GET").
+		Path("/trip/{id}").
+		Handler(tripCtrl.GetTripHandler())
+	// PUT /trip/{id}
+	apiRoute.Methods("PUT").
+		Path("/trip/{id}").
+		Handler(tripCtrl.ChangeTripHandler())
+	// DELETE /trip/{id}
+	apiRoute.Methods("DELETE").
+		Path("/trip/{id}").
+		Handler(tripCtrl.DeleteTripHandler())
+
+	// GET /meta/field
+	apiRoute.Methods("GET").
+		Path("/meta/field").
+		Handler(metaCtrl.GetMetaFieldsHandler())
+	// PUT /meta/field/{key}
+	apiRoute.Methods("PUT").
+		Path("/meta/field/{key}").
+		Handler(metaCtrl.SaveMetaFieldHandler())
+	// DELETE /meta/field/{key}
+	apiRoute.Methods("DELETE").
+		Path("/meta/field/{key}").
+		Handler(metaCtrl.DeleteMetaFieldHandler())
+
+	// GET /track
+	apiRoute.Methods("GET").
+		Path("/track").
+		Handler(trackCtrl.GetTracksHandler())
+	// GET /track?change_time={change_time}
+	apiRoute.Methods("GET").
+		Path("/track").
+		Queries("change_time", "{change_time}").
+		Handler(trackCtrl.GetTracksHandler())
+	// POST /track
+	apiRoute.Methods("POST").
+		Path("/track").
+		Handler(trackCtrl.CreateTrackHandler())
+	// GET /track/deleted
+	apiRoute.Methods("GET").
+		Path("/track/deleted").
+		Handler(trackCtrl.GetDeletedTrackIdsHandler())
+	// GET /track/deleted?deletion_time={deletion_time}
+	apiRoute.Methods("GET").
+		Path("/track/deleted").
+		Queries("deletion_time", "{deletion_time}").
+		Handler(trackCtrl.GetDeletedTrackIdsHandler())
+	// GET /track/{id}
+	apiRoute.Methods("GET").
+		Path("/track/{id}").
+		Handler(trackCtrl.GetTrackHandler())
+	// PUT /track/{id}
+	apiRoute.Methods("PUT").
+		Path("/track/{id}").
+		Handler(trackCtrl.ChangeTrackHandler())
+	// DELETE /track/{id}
+	apiRoute.Methods("DELETE").
+		Path("/track/{id}").
+		Handler(trackCtrl.DeleteTrackHandler())
+	// GET /track/{id}/points?from={from}&to={to}&tolerance={tolerance}&max_points={max_points}
+	apiRoute.Methods("GET").
+		Path("/track/{id}/points").
+		Handler(trackCtrl.GetTrackPointsHandler())
+	// POST /track/{id}/points
+	apiRoute.Methods("POST").
+		Path("/track/{id}/points").
+		Handler(trackCtrl.CreateTrackPointsHandler())
+
+	// GET /place
+	apiRoute.Methods("GET").
+		Path("/place").
+		Handler(placeCtrl.GetPlacesHandler())
+	// GET /place?change_time={change_time}
+	apiRoute.Methods("GET").
+		Path("/place").
+		Queries("change_time", "{change_time}").
+		Handler(placeCtrl.GetPlacesHandler())
+	// POST /place
+	apiRoute.Methods("POST").
+		Path("/place").
+		Handler(placeCtrl.CreatePlaceHandler())
+	// GET /place/match?lat={lat}&lng={lng}
+	apiRoute.Methods("GET").
+		Path("/place/match").
+		Handler(placeCtrl.MatchPlacesHandler())
+	// GET /place/deleted
+	apiRoute.Methods("GET").
+		Path("/place/deleted").
+		Handler(placeCtrl.GetDeletedPlaceIdsHandler())
+	// GET /place/deleted?deletion_time={deletion_time}
+	apiRoute.Methods("GET").
+		Path("/place/deleted").
+		Queries("deletion_time", "{deletion_time}").
+		Handler(placeCtrl.GetDeletedPlaceIdsHandler())
+	// GET /place/{id}
+	apiRoute.Methods("GET").
+		Path("/place/{id}").
+		Handler(placeCtrl.GetPlaceHandler())
+	// PUT /place/{id}
+	apiRoute.Methods("PUT").
+		Path("/place/{id}").
+		Handler(placeCtrl.ChangePlaceHandler())
+	// DELETE /place/{id}
+	apiRoute.Methods("DELETE").
+		Path("/place/{id}").
+		Handler(placeCtrl.DeletePlaceHandler())
+
+	// GET /group
+	apiRoute.Methods("GET").
+		Path("/group").
+		Handler(groupCtrl.GetGroupsHandler())
+	// GET /group?change_time={change_time}
+	apiRoute.Methods("GET").
+		Path("/group").
+		Queries("change_time", "{change_time}").
+		Handler(groupCtrl.GetGroupsHandler())
+	// POST /group
+	apiRoute.Methods("POST").
+		Path("/group").
+		Handler(groupCtrl.CreateGroupHandler())
+	// GET /group/deleted
+	apiRoute.Methods("GET").
+		Path("/group/deleted").
+		Handler(groupCtrl.GetDeletedGroupIdsHandler())
+	// GET /group/deleted?deletion_time={deletion_time}
+	apiRoute.Methods("GET").
+		Path("/group/deleted").
+		Queries("deletion_time", "{deletion_time}").
+		Handler(groupCtrl.GetDeletedGroupIdsHandler())
+	// GET /group/{id}
+	apiRoute.Methods("GET").
+		Path("/group/{id}").
+		Handler(groupCtrl.GetGroupHandler())
+	// PUT /group/{id}
+	apiRoute.Methods("PUT").
+		Path("/group/{id}").
+		Handler(groupCtrl.ChangeGroupHandler())
+	// DELETE /group/{id}
+	apiRoute.Methods("DELETE").
+		Path("/group/{id}").
+		Handler(groupCtrl.DeleteGroupHandler())
+
+	// GET /search?q={q}
+	apiRoute.Methods("GET").
+		Path("/search").
+		Queries("q", "{q}").
+		Handler(searchCtrl.SearchHandler())
+
+	// GET /stats
+	apiRoute.Methods("GET").
+		Path("/stats").
+		Handler(statsCtrl.GetStatsHandler())
+	// GET /stats/countries
+	apiRoute.Methods("GET").
+		Path("/stats/countries").
+		Handler(statsCtrl.GetCountryStatsHandler())
+
+	// GET /heatmap/{z}/{x}/{y}.png
+	apiRoute.Methods("GET").
+		Path("/heatmap/{z:[0-9]+}/{x:[0-9]+}/{y:[0-9]+}.png").
+		Handler(heatmapCtrl.GetHeatmapTileHandler())
+
+	// GET /timeline
+	apiRoute.Methods("GET").
+		Path("/timeline").
+		Handler(timelineCtrl.GetTimelineHandler())
+	// GET /memories
+	apiRoute.Methods("GET").
+		Path("/memories").
+		Handler(timelineCtrl.GetMemoriesHandler())
+
+	// GET /export/gpx
+	apiRoute.Methods("GET").
+		Path("/export/gpx").
+		Handler(locCtrl.ExportGpxHandler())
+	// POST /import/gpx
+	apiRoute.Methods("POST").
+		Path("/import/gpx").
+		Handler(locCtrl.ImportGpxHandler())
+	// GET /export/kml
+	apiRoute.Methods("GET").
+		Path("/export/kml").
+		Handler(locCtrl.ExportKmlHandler())
+	// GET /export/kmz
+	apiRoute.Methods("GET").
+		Path("/export/kmz").
+		Handler(locCtrl.ExportKmzHandler())
+	// POST /import/kml
+	apiRoute.Methods("POST").
+		Path("/import/kml").
+		Handler(locCtrl.ImportKmlHandler())
+	// POST /import/kmz
+	apiRoute.Methods("POST").
+		Path("/import/kmz").
+		Handler(locCtrl.ImportKmlHandler())
 
 	// Create middlewares
 	authMidw := middleware.NewAuthMiddleware(conf)
@@ -92,7 +475,7 @@ func main() {
 
 	// Start HTTP server
 	log.Printf("Listen on port '%d'.", conf.Port)
-	err := http.ListenAndServe(fmt.Sprintf(":%d", conf.Port), nil)
+	err = http.ListenAndServe(fmt.Sprintf(":%d", conf.Port), nil)
 	if err != nil {
 		log.Fatalf("Could not start server! (Error: %s)", err)
 	}
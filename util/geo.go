@@ -0,0 +1,138 @@
+package util
+
+import "math"
+
+// EarthRadius is the mean earth radius in meters.
+const EarthRadius = 6371008.8
+
+// --- Public methods ---
+
+// Distance returns the great-circle distance in meters between two coordinates (haversine
+// formula).
+func Distance(lat1 float64, lng1 float64, lat2 float64, lng2 float64) float64 {
+	phi1 := toRadians(lat1)
+	phi2 := toRadians(lat2)
+	dPhi := toRadians(lat2 - lat1)
+	dLambda := toRadians(lng2 - lng1)
+
+	a := math.Sin(dPhi/2)*math.Sin(dPhi/2) +
+		math.Cos(phi1)*math.Cos(phi2)*math.Sin(dLambda/2)*math.Sin(dLambda/2)
+	return 2 * EarthRadius * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// BoundingBox returns the smallest bounding box which contains all coordinates within radius
+// meters of a coordinate. If the box crosses the antimeridian, minLng is greater than maxLng. If it
+// contains a pole, it spans all longitudes.
+func BoundingBox(lat float64, lng float64, radius float64) (minLat float64, minLng float64,
+	maxLat float64, maxLng float64) {
+	dist := radius / EarthRadius * 180 / math.Pi
+	minLat = lat - dist
+	maxLat = lat + dist
+	if minLat <= -90 || maxLat >= 90 {
+		return math.Max(minLat, -90), -180, math.Min(maxLat, 90), 180
+	}
+
+	dLng := math.Asin(math.Sin(radius/EarthRadius)/math.Cos(toRadians(lat))) * 180 / math.Pi
+	if math.IsNaN(dLng) || dLng >= 180 {
+		return minLat, -180, maxLat, 180
+	}
+	minLng = lng - dLng
+	maxLng = lng + dLng
+	if minLng < -180 {
+		minLng += 360
+	}
+	if maxLng > 180 {
+		maxLng -= 360
+	}
+	return minLat, minLng, maxLat, maxLng
+}
+
+// IsValidCoordinate checks if latitude and longitude are finite and within their ranges.
+func IsValidCoordinate(lat float64, lng float64) bool {
+	if math.IsNaN(lat) || math.IsNaN(lng) || math.IsInf(lat, 0) || math.IsInf(lng, 0) {
+		return false
+	}
+	return lat >= -90 && lat <= 90 && lng >= -180 && lng <= 180
+}
+
+// SimplifyPath simplifies a path with the Ramer-Douglas-Peucker algorithm. Points which deviate
+// less than tolerance meters from the simplified path are dropped. It returns the indexes of the
+// kept points in ascending order.
+func SimplifyPath(lats []float64, lngs []float64, tolerance float64) []int {
+	n := len(lats)
+	if n <= 2 {
+		idxs := make([]int, n)
+		for i := range idxs {
+			idxs[i] = i
+		}
+		return idxs
+	}
+
+	keep := make([]bool, n)
+	keep[0] = true
+	keep[n-1] = true
+
+	// Process segments with a stack instead of recursion (tracks may be very long)
+	stack := [][2]int{{0, n - 1}}
+	for len(stack) > 0 {
+		seg := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		first := seg[0]
+		last := seg[1]
+
+		maxDist := 0.0
+		maxIdx := -1
+		for i := first + 1; i < last; i++ {
+			d := segmentDistance(lats[i], lngs[i], lats[first], lngs[first], lats[last],
+				lngs[last])
+			if d > maxDist {
+				maxDist = d
+				maxIdx = i
+			}
+		}
+
+		if maxIdx >= 0 && maxDist > tolerance {
+			keep[maxIdx] = true
+			stack = append(stack, [2]int{first, maxIdx}, [2]int{maxIdx, last})
+		}
+	}
+
+	var idxs []int
+	for i, k := range keep {
+		if k {
+			idxs = append(idxs, i)
+		}
+	}
+	return idxs
+}
+
+// --- Private methods ---
+
+// segmentDistance returns the approximate distance in meters between point p and the segment a-b.
+// The coordinates are projected to a local equirectangular plane around p.
+func segmentDistance(pLat float64, pLng float64, aLat float64, aLng float64, bLat float64,
+	bLng float64) float64 {
+	kx := math.Cos(toRadians(pLat)) * EarthRadius * math.Pi / 180
+	ky := EarthRadius * math.Pi / 180
+
+	ax := (aLng - pLng) * kx
+	ay := (aLat - pLat) * ky
+	bx := (bLng - pLng) * kx
+	by := (bLat - pLat) * ky
+
+	dx := bx - ax
+	dy := by - ay
+	l := dx*dx + dy*dy
+	t := 0.0
+	if l > 0 {
+		t = math.Max(0, math.Min(1, -(ax*dx+ay*dy)/l))
+	}
+
+	cx := ax + t*dx
+	cy := ay + t*dy
+	return math.Sqrt(cx*cx + cy*cy)
+}
+
+func toRadians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
@@ -0,0 +1,50 @@
+package util
+
+const geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// GeohashPrecision is the number of characters of stored geohashes (cells of a few centimeters).
+const GeohashPrecision = 12
+
+// --- Public methods ---
+
+// Geohash encodes a coordinate as geohash with the given number of characters. Each character
+// adds 5 bits, alternately halving the longitude and the latitude interval.
+func Geohash(lat float64, lng float64, precision int) string {
+	minLat, maxLat := -90.0, 90.0
+	minLng, maxLng := -180.0, 180.0
+
+	hash := make([]byte, 0, precision)
+	even := true
+	bit := 0
+	idx := 0
+	for len(hash) < precision {
+		if even {
+			mid := (minLng + maxLng) / 2
+			if lng >= mid {
+				idx = idx*2 + 1
+				minLng = mid
+			} else {
+				idx = idx * 2
+				maxLng = mid
+			}
+		} else {
+			mid := (minLat + maxLat) / 2
+			if lat >= mid {
+				idx = idx*2 + 1
+				minLat = mid
+			} else {
+				idx = idx * 2
+				maxLat = mid
+			}
+		}
+		even = !even
+
+		bit++
+		if bit == 5 {
+			hash = append(hash, geohashAlphabet[idx])
+			bit = 0
+			idx = 0
+		}
+	}
+	return string(hash)
+}
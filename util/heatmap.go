@@ -0,0 +1,92 @@
+package util
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// heatmapColors is the color ramp of the heatmap (from low to high density).
+var heatmapColors = []color.NRGBA{
+	{0, 0, 255, 0},
+	{0, 0, 255, 140},
+	{0, 255, 255, 170},
+	{0, 255, 0, 190},
+	{255, 255, 0, 210},
+	{255, 0, 0, 230},
+}
+
+// --- Public methods ---
+
+// RenderHeatmap renders the density of points into an image of size x size pixels. The points are
+// given in pixel coordinates of the image (they may be outside the image). Every point adds a
+// Gaussian kernel with the standard deviation sigma (in pixels) multiplied by its weight.
+func RenderHeatmap(xs []float64, ys []float64, weights []float64, size int,
+	sigma float64) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	if len(xs) == 0 {
+		return img
+	}
+
+	// Precompute kernel (cut off at 3 sigma)
+	r := int(math.Ceil(3 * sigma))
+	kSize := 2*r + 1
+	kernel := make([]float64, kSize*kSize)
+	for ky := -r; ky <= r; ky++ {
+		for kx := -r; kx <= r; kx++ {
+			d2 := float64(kx*kx + ky*ky)
+			kernel[(ky+r)*kSize+kx+r] = math.Exp(-d2 / (2 * sigma * sigma))
+		}
+	}
+
+	// Accumulate density
+	density := make([]float64, size*size)
+	for i := range xs {
+		cx := int(math.Floor(xs[i]))
+		cy := int(math.Floor(ys[i]))
+		if cx < -r || cy < -r || cx >= size+r || cy >= size+r {
+			continue
+		}
+		for ky := -r; ky <= r; ky++ {
+			py := cy + ky
+			if py < 0 || py >= size {
+				continue
+			}
+			for kx := -r; kx <= r; kx++ {
+				px := cx + kx
+				if px < 0 || px >= size {
+					continue
+				}
+				density[py*size+px] += weights[i] * kernel[(ky+r)*kSize+kx+r]
+			}
+		}
+	}
+
+	// Map density to colors (saturating, so that a few points are visible too)
+	for i, d := range density {
+		if d < 0.01 {
+			continue
+		}
+		img.SetNRGBA(i%size, i/size, heatmapColor(1-math.Exp(-d)))
+	}
+
+	return img
+}
+
+// --- Private methods ---
+
+func heatmapColor(v float64) color.NRGBA {
+	pos := v * float64(len(heatmapColors)-1)
+	i := int(pos)
+	if i >= len(heatmapColors)-1 {
+		return heatmapColors[len(heatmapColors)-1]
+	}
+	f := pos - float64(i)
+	a := heatmapColors[i]
+	b := heatmapColors[i+1]
+	return color.NRGBA{lerp(a.R, b.R, f), lerp(a.G, b.G, f), lerp(a.B, b.B, f), lerp(a.A, b.A, f)}
+}
+
+func lerp(a uint8, b uint8, f float64) uint8 {
+	return uint8(math.Round(float64(a) + (float64(b)-float64(a))*f))
+}
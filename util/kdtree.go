@@ -0,0 +1,103 @@
+package util
+
+import (
+	"math"
+	"sort"
+)
+
+// PointIndex is a k-d tree for nearest neighbour queries on coordinates. The coordinates are
+// stored as points on the unit sphere, so queries work across the antimeridian and at the poles.
+type PointIndex struct {
+	// Points in tree order: The median of each range is the node, the halves are its children.
+	points []indexPoint
+}
+
+type indexPoint struct {
+	pos [3]float64
+	idx int
+}
+
+// NewPointIndex builds an index of the given coordinates. Queries return indexes into these
+// slices.
+func NewPointIndex(lats []float64, lngs []float64) *PointIndex {
+	points := make([]indexPoint, len(lats))
+	for i := range points {
+		points[i] = indexPoint{toUnitVector(lats[i], lngs[i]), i}
+	}
+	buildPointTree(points, 0)
+	return &PointIndex{points}
+}
+
+// --- Public methods ---
+
+// Nearest returns the index of the coordinate nearest to lat/lng. If there is no coordinate
+// within maxDist meters, false is returned.
+func (pi PointIndex) Nearest(lat float64, lng float64, maxDist float64) (int, bool) {
+	// Compare squared chord lengths instead of great-circle distances
+	chord := 2 * math.Sin(math.Min(maxDist/EarthRadius, math.Pi)/2)
+	s := &pointSearch{toUnitVector(lat, lng), -1, chord * chord}
+	s.searchRange(pi.points, 0, len(pi.points), 0)
+	if s.best < 0 {
+		return 0, false
+	}
+	return pi.points[s.best].idx, true
+}
+
+// --- Private methods ---
+
+type pointSearch struct {
+	pos      [3]float64
+	best     int
+	bestDist float64
+}
+
+func (s *pointSearch) searchRange(points []indexPoint, start int, end int, depth int) {
+	if start >= end {
+		return
+	}
+	mid := (start + end) / 2
+	p := points[mid]
+
+	d := 0.0
+	for i := range p.pos {
+		d += (p.pos[i] - s.pos[i]) * (p.pos[i] - s.pos[i])
+	}
+	if d <= s.bestDist {
+		s.best = mid
+		s.bestDist = d
+	}
+
+	axis := depth % 3
+	diff := s.pos[axis] - p.pos[axis]
+	if diff < 0 {
+		s.searchRange(points, start, mid, depth+1)
+		if diff*diff <= s.bestDist {
+			s.searchRange(points, mid+1, end, depth+1)
+		}
+	} else {
+		s.searchRange(points, mid+1, end, depth+1)
+		if diff*diff <= s.bestDist {
+			s.searchRange(points, start, mid, depth+1)
+		}
+	}
+}
+
+func buildPointTree(points []indexPoint, depth int) {
+	if len(points) <= 1 {
+		return
+	}
+	axis := depth % 3
+	sort.Slice(points, func(i, j int) bool {
+		return points[i].pos[axis] < points[j].pos[axis]
+	})
+	mid := len(points) / 2
+	buildPointTree(points[:mid], depth+1)
+	buildPointTree(points[mid+1:], depth+1)
+}
+
+func toUnitVector(lat float64, lng float64) [3]float64 {
+	phi := toRadians(lat)
+	lambda := toRadians(lng)
+	return [3]float64{math.Cos(phi) * math.Cos(lambda), math.Cos(phi) * math.Sin(lambda),
+		math.Sin(phi)}
+}
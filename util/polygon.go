@@ -0,0 +1,54 @@
+package util
+
+import "math"
+
+// --- Public methods ---
+
+// PointInPolygon checks if a coordinate is inside a polygon. The first ring is the outer boundary,
+// the other rings are holes. Rings are lists of [lng, lat] positions like in GeoJSON. The polygon
+// must not cross the antimeridian.
+func PointInPolygon(lat float64, lng float64, rings [][][]float64) bool {
+	if len(rings) == 0 || !pointInRing(lat, lng, rings[0]) {
+		return false
+	}
+	for _, hole := range rings[1:] {
+		if pointInRing(lat, lng, hole) {
+			return false
+		}
+	}
+	return true
+}
+
+// PolygonDistance returns the approximate distance in meters between a coordinate and the nearest
+// edge of a polygon. Rings are lists of [lng, lat] positions like in GeoJSON.
+func PolygonDistance(lat float64, lng float64, rings [][][]float64) float64 {
+	dist := math.Inf(1)
+	for _, ring := range rings {
+		for i := 1; i < len(ring); i++ {
+			if len(ring[i-1]) < 2 || len(ring[i]) < 2 {
+				continue
+			}
+			dist = math.Min(dist, segmentDistance(lat, lng, ring[i-1][1], ring[i-1][0], ring[i][1],
+				ring[i][0]))
+		}
+	}
+	return dist
+}
+
+// --- Private methods ---
+
+// pointInRing checks with the even-odd rule (ray casting) if a coordinate is inside a ring.
+func pointInRing(lat float64, lng float64, ring [][]float64) bool {
+	in := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		if len(ring[i]) < 2 || len(ring[j]) < 2 {
+			continue
+		}
+		xi, yi := ring[i][0], ring[i][1]
+		xj, yj := ring[j][0], ring[j][1]
+		if (yi > lat) != (yj > lat) && lng < (xj-xi)*(lat-yi)/(yj-yi)+xi {
+			in = !in
+		}
+	}
+	return in
+}
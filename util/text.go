@@ -0,0 +1,66 @@
+package util
+
+import (
+	"strings"
+	"unicode"
+)
+
+var umlautReplacer = strings.NewReplacer("ä", "ae", "ö", "oe", "ü", "ue", "ß", "ss")
+
+// --- Public methods ---
+
+// NormalizeName converts a name into a form which can be used for comparison. Letters are
+// lower-cased, umlauts are replaced, punctuation is removed and whitespace is collapsed.
+func NormalizeName(name string) string {
+	name = umlautReplacer.Replace(strings.ToLower(name))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsSpace(r) {
+			return r
+		}
+		if r == '-' || r == '.' || r == '\'' {
+			return ' '
+		}
+		return -1
+	}, name)
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// CleanTagName removes surrounding whitespace and leading hash signs from a tag name.
+func CleanTagName(name string) string {
+	return strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(name), "#"))
+}
+
+// LevenshteinDistance returns the number of single character edits needed to turn a into b.
+func LevenshteinDistance(a string, b string) int {
+	ra := []rune(a)
+	rb := []rune(b)
+
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(minInt(prev[j]+1, cur[j-1]+1), prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+
+	return prev[len(rb)]
+}
+
+// --- Private methods ---
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
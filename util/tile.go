@@ -0,0 +1,62 @@
+package util
+
+import "math"
+
+// TileSize is the edge length of map tiles in pixels.
+const TileSize = 256
+
+// MaxTileLat is the maximum latitude of Web Mercator map tiles.
+const MaxTileLat = 85.05112878
+
+// --- Public methods ---
+
+// WorldSize returns the width (and height) of the world in pixels at a zoom level.
+func WorldSize(zoom int) float64 {
+	return float64(TileSize) * math.Exp2(float64(zoom))
+}
+
+// ToWorldPixel converts a coordinate into pixel coordinates of the Web Mercator projection at a
+// zoom level.
+func ToWorldPixel(lat float64, lng float64, zoom int) (float64, float64) {
+	size := WorldSize(zoom)
+	lat = math.Max(-MaxTileLat, math.Min(MaxTileLat, lat))
+	sinLat := math.Sin(toRadians(lat))
+	x := (lng + 180) / 360 * size
+	y := (0.5 - math.Log((1+sinLat)/(1-sinLat))/(4*math.Pi)) * size
+	return x, y
+}
+
+// FromWorldPixel converts pixel coordinates of the Web Mercator projection at a zoom level into a
+// coordinate. The longitude is not normalized (it's outside [-180, 180] if x is outside the
+// world).
+func FromWorldPixel(x float64, y float64, zoom int) (float64, float64) {
+	size := WorldSize(zoom)
+	lng := x/size*360 - 180
+	n := math.Pi - 2*math.Pi*y/size
+	lat := 180 / math.Pi * math.Atan(math.Sinh(n))
+	return lat, lng
+}
+
+// TileBoundingBox returns the bounding box of a map tile extended by margin pixels. If the box
+// crosses the antimeridian, minLng is greater than maxLng.
+func TileBoundingBox(zoom int, x int, y int, margin float64) (minLat float64, minLng float64,
+	maxLat float64, maxLng float64) {
+	left := float64(x*TileSize) - margin
+	right := float64((x+1)*TileSize) + margin
+	top := float64(y*TileSize) - margin
+	bottom := float64((y+1)*TileSize) + margin
+
+	maxLat, minLng = FromWorldPixel(left, top, zoom)
+	minLat, maxLng = FromWorldPixel(right, bottom, zoom)
+
+	if maxLng-minLng >= 360 {
+		return minLat, -180, maxLat, 180
+	}
+	if minLng < -180 {
+		minLng += 360
+	}
+	if maxLng > 180 {
+		maxLng -= 360
+	}
+	return minLat, minLng, maxLat, maxLng
+}